@@ -1,19 +1,44 @@
 package main
 
 import (
+	"flag"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/hotschmoe/protectorate/internal/cli"
 	"github.com/hotschmoe/protectorate/internal/config"
+	"github.com/hotschmoe/protectorate/internal/egress"
 	"github.com/hotschmoe/protectorate/internal/envoy"
 )
 
 func main() {
-	cfg := config.LoadEnvoyConfig()
+	if len(os.Args) > 1 && os.Args[1] == "egress-proxy" {
+		runEgressProxy(os.Args[2:])
+		return
+	}
+	if cli.IsCommand(os.Args[1:]) {
+		os.Exit(cli.Run(os.Args[1:]))
+	}
+
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "serve" {
+		args = args[1:]
+	}
+	fs := flag.NewFlagSet("envoy", flag.ExitOnError)
+	configPath := fs.String("config", os.Getenv("ENVOY_CONFIG"), "YAML config file; environment variables override it")
+	fs.Parse(args)
+
+	cfg, err := config.LoadEnvoyConfig(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	srv, err := envoy.NewServer(cfg)
+	srv, err := envoy.NewServer(cfg, *configPath)
 	if err != nil {
 		log.Fatalf("failed to create server: %v", err)
 	}
@@ -26,11 +51,41 @@ func main() {
 	}()
 
 	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-	<-sigCh
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range sigCh {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		srv.Reload()
+	}
 
 	log.Println("shutting down...")
 	if err := srv.Shutdown(); err != nil {
 		log.Printf("shutdown error: %v", err)
 	}
 }
+
+// runEgressProxy runs the forward proxy that envoy starts, from its own
+// image, for sleeves with an egress allowlist.
+func runEgressProxy(args []string) {
+	fs := flag.NewFlagSet("egress-proxy", flag.ExitOnError)
+	listen := fs.String("listen", ":3128", "address to listen on")
+	allow := fs.String("allow", "", "comma-separated domains sleeves may reach, including subdomains")
+	deny := fs.String("deny", "", "comma-separated domains refused even if allowed")
+	fs.Parse(args)
+
+	policy := egress.Policy{Allow: egress.ParseList(*allow), Deny: egress.ParseList(*deny)}
+	proxy := egress.New(func(string) egress.Policy { return policy }, nil, func(req egress.Request) {
+		switch {
+		case !req.Allowed:
+			log.Printf("%s %s %s refused: %v", req.Client, req.Method, req.Host, req.Err)
+		case req.Err != nil:
+			log.Printf("%s %s %s failed: %v", req.Client, req.Method, req.Host, req.Err)
+		default:
+			log.Printf("%s %s %s out=%d in=%d %s", req.Client, req.Method, req.Host, req.BytesOut, req.BytesIn, req.Duration.Round(time.Millisecond))
+		}
+	})
+
+	log.Printf("egress proxy listening on %s, allowing [%s]", *listen, strings.Join(policy.Allow, ", "))
+	log.Fatal(http.ListenAndServe(*listen, proxy))
+}
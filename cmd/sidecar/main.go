@@ -0,0 +1,36 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/hotschmoe/protectorate/internal/config"
+	"github.com/hotschmoe/protectorate/internal/sidecar"
+)
+
+func main() {
+	cfg := config.LoadSidecarConfig()
+
+	srv, err := sidecar.NewServer(cfg)
+	if err != nil {
+		log.Fatalf("failed to create sidecar: %v", err)
+	}
+
+	go func() {
+		log.Printf("sidecar starting on port %d (sleeve %s, cli %s)", cfg.Port, cfg.SleeveName, cfg.CLI)
+		if err := srv.Start(); err != nil {
+			log.Fatalf("sidecar error: %v", err)
+		}
+	}()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	<-sigCh
+
+	log.Println("shutting down...")
+	if err := srv.Shutdown(); err != nil {
+		log.Printf("shutdown error: %v", err)
+	}
+}
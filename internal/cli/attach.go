@@ -0,0 +1,152 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/term"
+)
+
+// ttyd message types. Client frames carry input or a resize; server frames
+// carry output, a window title or client preferences.
+const (
+	ttydInput  = '0'
+	ttydResize = '1'
+	ttydOutput = '0'
+)
+
+// detachKey is Ctrl-], as in telnet. Ctrl-C and Ctrl-D belong to the sleeve.
+const detachKey = 0x1d
+
+// ttyConn serializes writes to a ttyd WebSocket; gorilla allows only one
+// concurrent writer.
+type ttyConn struct {
+	conn *websocket.Conn
+	mu   sync.Mutex
+}
+
+func (t *ttyConn) write(msg []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.conn.WriteMessage(websocket.BinaryMessage, msg)
+}
+
+func (t *ttyConn) send(msgType byte, data []byte) error {
+	return t.write(append([]byte{msgType}, data...))
+}
+
+func (t *ttyConn) resize(fd int) error {
+	cols, rows, err := term.GetSize(fd)
+	if err != nil {
+		return err
+	}
+	data, _ := json.Marshal(map[string]int{"columns": cols, "rows": rows})
+	return t.send(ttydResize, data)
+}
+
+func sleeveAttach(c *command, args []string) error {
+	fs := newFlagSet("sleeve attach", c.opts)
+	rest, err := c.parse(fs, args, 1, "NAME")
+	if err != nil {
+		return err
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return fmt.Errorf("attach requires a terminal")
+	}
+	cols, rows, err := term.GetSize(fd)
+	if err != nil {
+		return fmt.Errorf("failed to get terminal size: %w", err)
+	}
+
+	conn, err := c.client.DialTerminal(rest[0])
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	tty := &ttyConn{conn: conn}
+
+	// ttyd waits for an init message with the initial size before it
+	// starts relaying the session.
+	initMsg, _ := json.Marshal(map[string]interface{}{"AuthToken": "", "columns": cols, "rows": rows})
+	if err := tty.write(initMsg); err != nil {
+		return fmt.Errorf("failed to start session: %w", err)
+	}
+
+	fmt.Fprintf(c.stderr, "attached to %s; press Ctrl-] to detach\n", rest[0])
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("failed to set raw mode: %w", err)
+	}
+	defer func() {
+		term.Restore(fd, state)
+		fmt.Fprintln(c.stderr)
+	}()
+
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	defer signal.Stop(winch)
+
+	closed := make(chan error, 1)
+	go func() {
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				closed <- err
+				return
+			}
+			if len(msg) > 0 && msg[0] == ttydOutput {
+				os.Stdout.Write(msg[1:])
+			}
+		}
+	}()
+
+	detached := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				detached <- err
+				return
+			}
+			input := buf[:n]
+			i := bytes.IndexByte(input, detachKey)
+			if i >= 0 {
+				input = input[:i]
+			}
+			if len(input) > 0 {
+				if err := tty.send(ttydInput, input); err != nil {
+					detached <- err
+					return
+				}
+			}
+			if i >= 0 {
+				detached <- nil
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-winch:
+			tty.resize(fd)
+		case err := <-detached:
+			return err
+		case err := <-closed:
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				return nil
+			}
+			return fmt.Errorf("connection closed: %w", err)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+// Package cli implements the envoy command-line client. It talks to a running
+// envoy over its HTTP API, so it works the same against a local or remote
+// envoy.
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+const usage = `Usage: envoy [serve] [-config FILE]
+       envoy <command> <subcommand> [flags] [args]
+
+Commands:
+  sleeve ls                          List sleeves
+  sleeve spawn -workspace NAME       Spawn a sleeve (-name, -profile, -template, -prompt)
+  sleeve kill NAME...                Kill sleeves
+  sleeve logs NAME                   Print the sleeve's terminal scrollback (-lines)
+  sleeve attach NAME                 Attach to the sleeve's terminal (Ctrl-] detaches)
+
+  workspace ls                       List workspaces
+  workspace create NAME              Create an empty workspace
+  workspace clone URL                Clone a repo into a new workspace (-name, -wait)
+  workspace branches NAME            List local and remote branches
+  workspace switch NAME BRANCH       Check out a branch
+  workspace pull NAME                Pull from origin
+
+  secret ls                          List stored secrets (never their values)
+  secret set NAME                    Store or rotate a secret read from stdin (-from-file, -scope)
+  secret rm NAME...                  Remove secrets no sleeve uses
+
+Global flags (also accepted after the subcommand):
+  -url URL   envoy address (default $ENVOY_URL or http://localhost:7470)
+  -json      print JSON instead of tables
+`
+
+// options are the flags shared by every command.
+type options struct {
+	url  string
+	json bool
+}
+
+// command is a CLI invocation after the global flags and command names.
+type command struct {
+	opts   *options
+	client *Client
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// IsCommand reports whether args select a CLI command rather than the server,
+// which runs for no arguments, "serve", or a leading -config flag.
+func IsCommand(args []string) bool {
+	if len(args) == 0 || args[0] == "serve" {
+		return false
+	}
+	flagName := strings.SplitN(strings.TrimLeft(args[0], "-"), "=", 2)[0]
+	return !(strings.HasPrefix(args[0], "-") && flagName == "config")
+}
+
+// Run executes the CLI with args (without the program name) and returns the
+// process exit code.
+func Run(args []string) int {
+	opts := &options{}
+	global := newFlagSet("envoy", opts)
+	global.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	if err := global.Parse(args); err != nil {
+		return 2
+	}
+	args = global.Args()
+
+	if len(args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	var handlers map[string]func(*command, []string) error
+	switch args[0] {
+	case "sleeve", "sleeves":
+		handlers = sleeveCommands
+	case "workspace", "workspaces", "ws":
+		handlers = workspaceCommands
+	case "secret", "secrets":
+		handlers = secretCommands
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+
+	handler, ok := handlers[args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown %s subcommand %q\n\n%s", args[0], args[1], usage)
+		return 2
+	}
+
+	cmd := &command{opts: opts, stdout: os.Stdout, stderr: os.Stderr}
+	if err := handler(cmd, args[2:]); err != nil {
+		if err == flag.ErrHelp {
+			return 2
+		}
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// newFlagSet returns a flag set with the global flags bound to opts.
+func newFlagSet(name string, opts *options) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	defaultURL := os.Getenv("ENVOY_URL")
+	if defaultURL == "" {
+		defaultURL = "http://localhost:7470"
+	}
+	if opts.url != "" {
+		defaultURL = opts.url
+	}
+	fs.StringVar(&opts.url, "url", defaultURL, "envoy address")
+	fs.BoolVar(&opts.json, "json", opts.json, "print JSON")
+	return fs
+}
+
+// parse parses a subcommand's flags and connects the client. It requires
+// exactly nargs positional arguments, or at least -nargs if nargs is negative.
+func (c *command) parse(fs *flag.FlagSet, args []string, nargs int, argsUsage string) ([]string, error) {
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, "Usage: envoy %s [flags] %s\n", fs.Name(), argsUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	rest := fs.Args()
+	if (nargs >= 0 && len(rest) != nargs) || (nargs < 0 && len(rest) < -nargs) {
+		fs.Usage()
+		return nil, flag.ErrHelp
+	}
+
+	c.client = NewClient(c.opts.url)
+	return rest, nil
+}
+
+// print writes v as indented JSON when -json is set, otherwise calls table.
+func (c *command) print(v interface{}, table func(w *tabwriter.Writer)) error {
+	if c.opts.json {
+		enc := json.NewEncoder(c.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	table(w)
+	return w.Flush()
+}
+
+// row writes tab-separated cells as one table row.
+func row(w io.Writer, cells ...string) {
+	fmt.Fprintln(w, strings.Join(cells, "\t"))
+}
+
+// dash renders empty table cells as "-".
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// splitList parses a comma-separated flag value, dropping empty items.
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
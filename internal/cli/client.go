@@ -0,0 +1,214 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hotschmoe/protectorate/internal/protocol"
+)
+
+// Client is a minimal client for the envoy HTTP API.
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+func NewClient(baseURL string) *Client {
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		http:    &http.Client{Timeout: 2 * time.Minute},
+	}
+}
+
+// APIError is a non-2xx response from envoy.
+type APIError struct {
+	Status  int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("envoy returned %d: %s", e.Status, e.Message)
+}
+
+func (c *Client) ListSleeves() ([]protocol.SleeveInfo, error) {
+	var sleeves []protocol.SleeveInfo
+	err := c.do(http.MethodGet, "/api/sleeves", nil, &sleeves)
+	return sleeves, err
+}
+
+func (c *Client) SpawnSleeve(req protocol.SpawnSleeveRequest) (*protocol.SleeveInfo, error) {
+	var sleeve protocol.SleeveInfo
+	if err := c.do(http.MethodPost, "/api/sleeves", req, &sleeve); err != nil {
+		return nil, err
+	}
+	return &sleeve, nil
+}
+
+func (c *Client) KillSleeve(name string) error {
+	return c.do(http.MethodDelete, "/api/sleeves/"+url.PathEscape(name), nil, nil)
+}
+
+func (c *Client) SleeveScreen(name string, history int) (*protocol.SleeveScreen, error) {
+	var screen protocol.SleeveScreen
+	path := fmt.Sprintf("/api/sleeves/%s/screen?history=%d", url.PathEscape(name), history)
+	if err := c.do(http.MethodGet, path, nil, &screen); err != nil {
+		return nil, err
+	}
+	return &screen, nil
+}
+
+// DialTerminal opens the sleeve's terminal WebSocket, which envoy proxies to
+// the ttyd inside the sleeve.
+func (c *Client) DialTerminal(name string) (*websocket.Conn, error) {
+	u, err := url.Parse(c.baseURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	default:
+		u.Scheme = "ws"
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/sleeves/" + url.PathEscape(name) + "/terminal"
+
+	dialer := websocket.Dialer{
+		Subprotocols:     []string{"tty"},
+		HandshakeTimeout: 10 * time.Second,
+	}
+	header := http.Header{}
+	if user := os.Getenv("USER"); user != "" {
+		header.Set("X-Protectorate-Actor", user)
+	}
+
+	conn, resp, err := dialer.Dial(u.String(), header)
+	if err != nil && resp != nil {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &APIError{Status: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+	return conn, err
+}
+
+func (c *Client) ListWorkspaces() ([]protocol.WorkspaceInfo, error) {
+	var workspaces []protocol.WorkspaceInfo
+	err := c.do(http.MethodGet, "/api/workspaces", nil, &workspaces)
+	return workspaces, err
+}
+
+func (c *Client) CreateWorkspace(name string) (*protocol.WorkspaceInfo, error) {
+	var ws protocol.WorkspaceInfo
+	if err := c.do(http.MethodPost, "/api/workspaces", map[string]string{"name": name}, &ws); err != nil {
+		return nil, err
+	}
+	return &ws, nil
+}
+
+func (c *Client) CloneWorkspace(req protocol.CloneWorkspaceRequest) (*protocol.CloneJob, error) {
+	var job protocol.CloneJob
+	if err := c.do(http.MethodPost, "/api/workspaces/clone", req, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (c *Client) CloneJob(id string) (*protocol.CloneJob, error) {
+	var job protocol.CloneJob
+	if err := c.do(http.MethodGet, "/api/workspaces/clone?id="+url.QueryEscape(id), nil, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (c *Client) Branches(wsPath string) (*protocol.BranchListResponse, error) {
+	var branches protocol.BranchListResponse
+	if err := c.do(http.MethodGet, "/api/workspaces/branches?workspace="+url.QueryEscape(wsPath), nil, &branches); err != nil {
+		return nil, err
+	}
+	return &branches, nil
+}
+
+func (c *Client) SwitchBranch(wsPath, branch string) (*protocol.WorkspaceInfo, error) {
+	var ws protocol.WorkspaceInfo
+	path := "/api/workspaces/branches?action=switch&workspace=" + url.QueryEscape(wsPath)
+	req := protocol.SwitchBranchRequest{Workspace: wsPath, Branch: branch}
+	if err := c.do(http.MethodPost, path, req, &ws); err != nil {
+		return nil, err
+	}
+	return &ws, nil
+}
+
+func (c *Client) Pull(wsPath string) (*protocol.FetchResult, error) {
+	var result protocol.FetchResult
+	path := "/api/workspaces/branches?action=pull&workspace=" + url.QueryEscape(wsPath)
+	if err := c.do(http.MethodPost, path, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) ListSecrets() ([]protocol.SecretInfo, error) {
+	var secrets []protocol.SecretInfo
+	err := c.do(http.MethodGet, "/api/secrets", nil, &secrets)
+	return secrets, err
+}
+
+func (c *Client) PutSecret(name string, req protocol.PutSecretRequest) (*protocol.SecretRotation, error) {
+	var rotation protocol.SecretRotation
+	if err := c.do(http.MethodPut, "/api/secrets/"+url.PathEscape(name), req, &rotation); err != nil {
+		return nil, err
+	}
+	return &rotation, nil
+}
+
+func (c *Client) DeleteSecret(name string) error {
+	return c.do(http.MethodDelete, "/api/secrets/"+url.PathEscape(name), nil, nil)
+}
+
+// do sends body as JSON and decodes the response into out, if non-nil.
+func (c *Client) do(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	// Attribute CLI operations to the local user in envoy's audit log.
+	if user := os.Getenv("USER"); user != "" {
+		req.Header.Set("X-Protectorate-Actor", user)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &APIError{Status: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
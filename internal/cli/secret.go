@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/hotschmoe/protectorate/internal/protocol"
+)
+
+var secretCommands = map[string]func(*command, []string) error{
+	"ls":   secretList,
+	"list": secretList,
+	"set":  secretSet,
+	"rm":   secretRemove,
+}
+
+func secretList(c *command, args []string) error {
+	fs := newFlagSet("secret ls", c.opts)
+	if _, err := c.parse(fs, args, 0, ""); err != nil {
+		return err
+	}
+
+	secrets, err := c.client.ListSecrets()
+	if err != nil {
+		return err
+	}
+
+	return c.print(secrets, func(w *tabwriter.Writer) {
+		row(w, "NAME", "VERSION", "SCOPE", "SLEEVES", "UPDATED")
+		for _, sec := range secrets {
+			row(w, sec.Name, strconv.Itoa(sec.Version), dash(strings.Join(sec.Scope, ",")),
+				dash(strings.Join(sec.Sleeves, ",")), sec.UpdatedAt.Format("2006-01-02 15:04"))
+		}
+	})
+}
+
+// secretSet reads the value from a file or stdin rather than a flag, so it
+// does not end up in shell history.
+func secretSet(c *command, args []string) error {
+	fs := newFlagSet("secret set", c.opts)
+	fromFile := fs.String("from-file", "", "read the value from this file (default: stdin, without its trailing newline)")
+	scope := fs.String("scope", "", "comma-separated sleeve name patterns allowed to use it, e.g. web-* (default: unchanged, or every sleeve)")
+	rest, err := c.parse(fs, args, 1, "NAME")
+	if err != nil {
+		return err
+	}
+
+	var value []byte
+	if *fromFile != "" {
+		value, err = os.ReadFile(*fromFile)
+	} else {
+		value, err = io.ReadAll(os.Stdin)
+		value = []byte(strings.TrimSuffix(strings.TrimSuffix(string(value), "\n"), "\r"))
+	}
+	if err != nil {
+		return err
+	}
+
+	req := protocol.PutSecretRequest{Value: string(value)}
+	if *scope != "" {
+		list := splitList(*scope)
+		req.Scope = &list
+	}
+
+	rotation, err := c.client.PutSecret(rest[0], req)
+	if err != nil {
+		return err
+	}
+
+	if c.opts.json {
+		return c.print(rotation, nil)
+	}
+	fmt.Fprintf(c.stdout, "stored %s version %d\n", rotation.Secret.Name, rotation.Secret.Version)
+	if len(rotation.Updated) > 0 {
+		fmt.Fprintf(c.stdout, "updated in %s\n", strings.Join(rotation.Updated, ", "))
+	}
+	if len(rotation.Stale) > 0 {
+		fmt.Fprintf(c.stdout, "still the old value in the env of %s until resleeved\n", strings.Join(rotation.Stale, ", "))
+	}
+	failed := make([]string, 0, len(rotation.Errors))
+	for name := range rotation.Errors {
+		failed = append(failed, name)
+	}
+	sort.Strings(failed)
+	for _, name := range failed {
+		fmt.Fprintf(c.stderr, "%s: %s\n", name, rotation.Errors[name])
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to update %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func secretRemove(c *command, args []string) error {
+	fs := newFlagSet("secret rm", c.opts)
+	names, err := c.parse(fs, args, -1, "NAME...")
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, name := range names {
+		if err := c.client.DeleteSecret(name); err != nil {
+			fmt.Fprintf(c.stderr, "%s: %v\n", name, err)
+			failed = append(failed, name)
+			continue
+		}
+		if !c.opts.json {
+			fmt.Fprintf(c.stdout, "removed %s\n", name)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to remove %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hotschmoe/protectorate/internal/protocol"
+)
+
+var sleeveCommands = map[string]func(*command, []string) error{
+	"ls":     sleeveList,
+	"list":   sleeveList,
+	"spawn":  sleeveSpawn,
+	"kill":   sleeveKill,
+	"logs":   sleeveLogs,
+	"attach": sleeveAttach,
+}
+
+func sleeveList(c *command, args []string) error {
+	fs := newFlagSet("sleeve ls", c.opts)
+	if _, err := c.parse(fs, args, 0, ""); err != nil {
+		return err
+	}
+
+	sleeves, err := c.client.ListSleeves()
+	if err != nil {
+		return err
+	}
+
+	return c.print(sleeves, func(w *tabwriter.Writer) {
+		row(w, "NAME", "STATUS", "HEALTH", "WORKSPACE", "PROFILE", "AGENT", "UPTIME")
+		for _, sl := range sleeves {
+			agent := "-"
+			if sl.AgentStatus != nil {
+				agent = sl.AgentStatus.State
+			}
+			row(w, sl.Name, sl.Status, dash(sl.Health), workspaceName(sl.Workspace),
+				dash(sl.Profile), agent, time.Since(sl.SpawnTime).Round(time.Minute).String())
+		}
+	})
+}
+
+func sleeveSpawn(c *command, args []string) error {
+	fs := newFlagSet("sleeve spawn", c.opts)
+	var req protocol.SpawnSleeveRequest
+	fs.StringVar(&req.Workspace, "workspace", "", "workspace name or path (required)")
+	fs.StringVar(&req.Name, "name", "", "sleeve name (default: next free name)")
+	fs.StringVar(&req.Profile, "profile", "", "AI CLI to run, e.g. claude-code")
+	fs.StringVar(&req.Template, "template", "", "sleeve template")
+	fs.StringVar(&req.Prompt, "prompt", "", "prompt to send once the CLI has started")
+	fs.StringVar(&req.NetworkPolicy, "network", "", "network policy: shared, isolated or none")
+	egress := fs.String("egress", "", "comma-separated domains the sleeve may reach (implies isolated)")
+	egressDeny := fs.String("egress-deny", "", "comma-separated domains the sleeve may not reach")
+	secretEnv := fs.String("secret-env", "", "comma-separated VAR=secret pairs to set as env vars")
+	secretFile := fs.String("secret-file", "", "comma-separated secrets to write to /run/secrets, as secret or secret=file")
+	if _, err := c.parse(fs, args, 0, ""); err != nil {
+		return err
+	}
+	req.Egress = splitList(*egress)
+	req.EgressDeny = splitList(*egressDeny)
+	for _, pair := range splitList(*secretEnv) {
+		env, name, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("-secret-env: %q is not VAR=secret", pair)
+		}
+		req.Secrets = append(req.Secrets, protocol.SecretRef{Name: name, Env: env})
+	}
+	for _, item := range splitList(*secretFile) {
+		name, file, _ := strings.Cut(item, "=")
+		req.Secrets = append(req.Secrets, protocol.SecretRef{Name: name, File: file})
+	}
+	if req.Workspace == "" {
+		fs.Usage()
+		return fmt.Errorf("-workspace required")
+	}
+
+	wsPath, err := c.workspacePath(req.Workspace)
+	if err != nil {
+		return err
+	}
+	req.Workspace = wsPath
+
+	sleeve, err := c.client.SpawnSleeve(req)
+	if err != nil {
+		return err
+	}
+
+	return c.print(sleeve, func(w *tabwriter.Writer) {
+		row(w, "NAME", "CONTAINER", "WORKSPACE", "TERMINAL")
+		row(w, sleeve.Name, sleeve.ContainerID, workspaceName(sleeve.Workspace), "/sleeves/"+sleeve.Name+"/terminal")
+	})
+}
+
+func sleeveKill(c *command, args []string) error {
+	fs := newFlagSet("sleeve kill", c.opts)
+	names, err := c.parse(fs, args, -1, "NAME...")
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, name := range names {
+		if err := c.client.KillSleeve(name); err != nil {
+			fmt.Fprintf(c.stderr, "%s: %v\n", name, err)
+			failed = append(failed, name)
+			continue
+		}
+		if !c.opts.json {
+			fmt.Fprintf(c.stdout, "killed %s\n", name)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to kill %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func sleeveLogs(c *command, args []string) error {
+	fs := newFlagSet("sleeve logs", c.opts)
+	lines := fs.Int("lines", 1000, "scrollback lines to include")
+	rest, err := c.parse(fs, args, 1, "NAME")
+	if err != nil {
+		return err
+	}
+
+	screen, err := c.client.SleeveScreen(rest[0], *lines)
+	if err != nil {
+		return err
+	}
+
+	if c.opts.json {
+		return c.print(screen, nil)
+	}
+	_, err = fmt.Fprint(c.stdout, screen.Content)
+	return err
+}
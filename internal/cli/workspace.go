@@ -0,0 +1,215 @@
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hotschmoe/protectorate/internal/protocol"
+)
+
+const clonePollInterval = 2 * time.Second
+
+var workspaceCommands = map[string]func(*command, []string) error{
+	"ls":       workspaceList,
+	"list":     workspaceList,
+	"create":   workspaceCreate,
+	"clone":    workspaceClone,
+	"branches": workspaceBranches,
+	"switch":   workspaceSwitch,
+	"pull":     workspacePull,
+}
+
+func workspaceList(c *command, args []string) error {
+	fs := newFlagSet("workspace ls", c.opts)
+	if _, err := c.parse(fs, args, 0, ""); err != nil {
+		return err
+	}
+
+	workspaces, err := c.client.ListWorkspaces()
+	if err != nil {
+		return err
+	}
+
+	return c.print(workspaces, func(w *tabwriter.Writer) {
+		row(w, "NAME", "BRANCH", "DIRTY", "AHEAD", "BEHIND", "SLEEVE")
+		for _, ws := range workspaces {
+			branch, dirty, ahead, behind := "-", "-", "-", "-"
+			if ws.Git != nil {
+				branch = ws.Git.Branch
+				dirty = strconv.Itoa(ws.Git.UncommittedCount)
+				ahead = strconv.Itoa(ws.Git.AheadCount)
+				behind = strconv.Itoa(ws.Git.BehindCount)
+			}
+			row(w, ws.Name, branch, dirty, ahead, behind, dash(ws.SleeveName))
+		}
+	})
+}
+
+func workspaceCreate(c *command, args []string) error {
+	fs := newFlagSet("workspace create", c.opts)
+	rest, err := c.parse(fs, args, 1, "NAME")
+	if err != nil {
+		return err
+	}
+
+	ws, err := c.client.CreateWorkspace(rest[0])
+	if err != nil {
+		return err
+	}
+
+	return c.print(ws, func(w *tabwriter.Writer) {
+		row(w, "NAME", "PATH")
+		row(w, ws.Name, ws.Path)
+	})
+}
+
+func workspaceClone(c *command, args []string) error {
+	fs := newFlagSet("workspace clone", c.opts)
+	name := fs.String("name", "", "workspace name (default: derived from the URL)")
+	wait := fs.Bool("wait", false, "wait for the clone to finish")
+	rest, err := c.parse(fs, args, 1, "URL")
+	if err != nil {
+		return err
+	}
+
+	job, err := c.client.CloneWorkspace(protocol.CloneWorkspaceRequest{RepoURL: rest[0], Name: *name})
+	if err != nil {
+		return err
+	}
+
+	for *wait && job.Status == "cloning" {
+		time.Sleep(clonePollInterval)
+		if job, err = c.client.CloneJob(job.ID); err != nil {
+			return err
+		}
+	}
+
+	if err := c.print(job, func(w *tabwriter.Writer) {
+		row(w, "JOB", "WORKSPACE", "STATUS")
+		row(w, job.ID, workspaceName(job.Workspace), job.Status)
+	}); err != nil {
+		return err
+	}
+
+	if job.Status == "failed" {
+		return fmt.Errorf("clone failed: %s", job.Error)
+	}
+	return nil
+}
+
+func workspaceBranches(c *command, args []string) error {
+	fs := newFlagSet("workspace branches", c.opts)
+	rest, err := c.parse(fs, args, 1, "NAME")
+	if err != nil {
+		return err
+	}
+
+	wsPath, err := c.workspacePath(rest[0])
+	if err != nil {
+		return err
+	}
+
+	branches, err := c.client.Branches(wsPath)
+	if err != nil {
+		return err
+	}
+
+	return c.print(branches, func(w *tabwriter.Writer) {
+		row(w, "", "BRANCH")
+		for _, b := range branches.Local {
+			current := ""
+			if b == branches.Current {
+				current = "*"
+			}
+			row(w, current, b)
+		}
+		for _, b := range branches.Remote {
+			row(w, "", b)
+		}
+	})
+}
+
+func workspaceSwitch(c *command, args []string) error {
+	fs := newFlagSet("workspace switch", c.opts)
+	rest, err := c.parse(fs, args, 2, "NAME BRANCH")
+	if err != nil {
+		return err
+	}
+
+	wsPath, err := c.workspacePath(rest[0])
+	if err != nil {
+		return err
+	}
+
+	ws, err := c.client.SwitchBranch(wsPath, rest[1])
+	if err != nil {
+		return err
+	}
+
+	return c.print(ws, func(w *tabwriter.Writer) {
+		branch := rest[1]
+		if ws.Git != nil {
+			branch = ws.Git.Branch
+		}
+		row(w, "NAME", "BRANCH")
+		row(w, workspaceName(wsPath), branch)
+	})
+}
+
+func workspacePull(c *command, args []string) error {
+	fs := newFlagSet("workspace pull", c.opts)
+	rest, err := c.parse(fs, args, 1, "NAME")
+	if err != nil {
+		return err
+	}
+
+	wsPath, err := c.workspacePath(rest[0])
+	if err != nil {
+		return err
+	}
+
+	result, err := c.client.Pull(wsPath)
+	if err != nil {
+		return err
+	}
+
+	if err := c.print(result, func(w *tabwriter.Writer) {
+		row(w, dash(result.Message))
+	}); err != nil {
+		return err
+	}
+
+	if !result.Success {
+		return fmt.Errorf("pull failed")
+	}
+	return nil
+}
+
+// workspacePath resolves a workspace name to the path envoy expects. An
+// absolute path is passed through unchanged.
+func (c *command) workspacePath(name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return name, nil
+	}
+
+	workspaces, err := c.client.ListWorkspaces()
+	if err != nil {
+		return "", err
+	}
+	for _, ws := range workspaces {
+		if ws.Name == name {
+			return ws.Path, nil
+		}
+	}
+	return "", fmt.Errorf("workspace %q not found", name)
+}
+
+func workspaceName(path string) string {
+	if path == "" {
+		return "-"
+	}
+	return filepath.Base(path)
+}
@@ -1,47 +1,130 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // EnvoyConfig defines the configuration for the Envoy manager service.
+// The yaml tags are the keys of the envoy config file.
 type EnvoyConfig struct {
-	PollInterval  time.Duration
-	IdleThreshold time.Duration
-	MaxSleeves    int
-	Port          int
-	Docker        DockerConfig
-	Gitea         GiteaConfig
-	Mirror        MirrorConfig
+	PollInterval  time.Duration `yaml:"poll_interval"`
+	IdleThreshold time.Duration `yaml:"idle_threshold"`
+	MaxSleeves    int           `yaml:"max_sleeves"`
+	Port          int           `yaml:"port"`
+	DataDir       string        `yaml:"data_dir"`
+	TemplatesDir  string        `yaml:"templates_dir"`
+	Docker        DockerConfig  `yaml:"docker"`
+	Gitea         GiteaConfig   `yaml:"gitea"`
+	Mirror        MirrorConfig  `yaml:"mirror"`
+	Audit         AuditConfig   `yaml:"audit"`
+	Probe         ProbeConfig   `yaml:"probe"`
+	Pool          PoolConfig    `yaml:"pool"`
+	Fleet         FleetConfig   `yaml:"fleet"`
+	Proxy         ProxyConfig   `yaml:"proxy"`
+	Secrets       SecretsConfig `yaml:"secrets"`
 }
 
 // DockerConfig defines Docker-specific configuration.
 type DockerConfig struct {
-	Network             string
-	WorkspaceRoot       string
-	WorkspaceHostRoot   string
-	CredentialsHostPath string
-	SettingsHostPath    string
-	PluginsHostPath     string
-	SleeveImage         string
+	Network             string `yaml:"network"`
+	WorkspaceRoot       string `yaml:"workspace_root"`
+	WorkspaceHostRoot   string `yaml:"workspace_host_root"`
+	CredentialsHostPath string `yaml:"credentials_host_path"`
+	SettingsHostPath    string `yaml:"settings_host_path"`
+	PluginsHostPath     string `yaml:"plugins_host_path"`
+	SleeveImage         string `yaml:"sleeve_image"`
+	EgressProxyImage    string `yaml:"egress_proxy_image"`
+	CredentialsSecret   string `yaml:"credentials_secret"`
 }
 
 // GiteaConfig defines Gitea configuration.
 type GiteaConfig struct {
-	URL      string
-	User     string
-	Password string
-	Token    string
+	URL      string `yaml:"url"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Token    string `yaml:"token"`
 }
 
 // MirrorConfig defines GitHub mirror configuration.
 type MirrorConfig struct {
-	Enabled   bool
-	Frequency string
-	GitHubOrg string
-	Token     string
+	Enabled   bool     `yaml:"enabled"`
+	Frequency string   `yaml:"frequency"`
+	GitHubOrg string   `yaml:"github_org"`
+	Token     string   `yaml:"github_token"`
+	GitHubURL string   `yaml:"github_url"`
+	Repos     []string `yaml:"repos"`
+}
+
+// Interval returns the time between mirror runs. Frequency is hourly, daily,
+// weekly or a duration such as "6h".
+func (m MirrorConfig) Interval() (time.Duration, error) {
+	switch m.Frequency {
+	case "hourly":
+		return time.Hour, nil
+	case "daily":
+		return 24 * time.Hour, nil
+	case "weekly":
+		return 7 * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(m.Frequency)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%q is not hourly, daily, weekly or a positive duration", m.Frequency)
+	}
+	return d, nil
+}
+
+// ProxyConfig defines the forward proxy envoy runs for sleeves. Allow and
+// Deny apply to sleeves without lists of their own; Deny also applies to
+// sleeves that have one.
+type ProxyConfig struct {
+	Port  int      `yaml:"port"`
+	Host  string   `yaml:"host"`
+	Allow []string `yaml:"allow"`
+	Deny  []string `yaml:"deny"`
+}
+
+// SecretsConfig defines the encrypted secrets store. Key is a base64
+// AES-256 key; without it the key is read from KeyFile, which is created
+// with a random key if missing.
+type SecretsConfig struct {
+	Path    string `yaml:"path"`
+	Key     string `yaml:"key"`
+	KeyFile string `yaml:"key_file"`
+}
+
+// AuditConfig defines audit log configuration. TrustedProxies lists the
+// addresses or CIDR ranges of reverse proxies whose X-Forwarded-For header
+// is believed when recording a request's source IP.
+type AuditConfig struct {
+	Path           string   `yaml:"path"`
+	MaxSizeMB      int      `yaml:"max_size_mb"`
+	MaxBackups     int      `yaml:"max_backups"`
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// ProbeConfig defines sleeve health probing configuration.
+type ProbeConfig struct {
+	Interval         time.Duration `yaml:"interval"`
+	Timeout          time.Duration `yaml:"timeout"`
+	FailureThreshold int           `yaml:"failures"`
+	Policy           string        `yaml:"unhealthy_policy"` // restart, resleeve, notify
+}
+
+// PoolConfig defines the warm sleeve pool configuration.
+type PoolConfig struct {
+	Size     int      `yaml:"size"`     // pre-started sleeves per profile, 0 = disabled
+	Profiles []string `yaml:"profiles"` // AI CLI profiles to keep warm
+}
+
+// FleetConfig defines the declarative fleet file and its reconciler.
+type FleetConfig struct {
+	Path     string        `yaml:"file"`
+	Interval time.Duration `yaml:"reconcile_interval"` // 0 = reconcile only on request
 }
 
 // getEnv returns the environment variable value or a default.
@@ -62,79 +145,306 @@ func getEnvInt(key string, defaultVal int) int {
 	return defaultVal
 }
 
-// getEnvDuration returns the environment variable as duration or a default.
-func getEnvDuration(key string, defaultVal time.Duration) time.Duration {
+// getEnvBool returns the environment variable as bool or a default.
+func getEnvBool(key string, defaultVal bool) bool {
 	if val := os.Getenv(key); val != "" {
-		if d, err := time.ParseDuration(val); err == nil {
-			return d
+		if b, err := strconv.ParseBool(val); err == nil {
+			return b
 		}
 	}
 	return defaultVal
 }
 
-// getEnvBool returns the environment variable as bool or a default.
-func getEnvBool(key string, defaultVal bool) bool {
+// envOverlay applies set environment variables over a config. Unlike the
+// getEnv helpers it records unparseable values instead of ignoring them.
+type envOverlay struct {
+	errs []string
+}
+
+func (e *envOverlay) fail(key, val, kind string) {
+	e.errs = append(e.errs, fmt.Sprintf("%s: %q is not a valid %s", key, val, kind))
+}
+
+func (e *envOverlay) str(key string, dst *string) {
 	if val := os.Getenv(key); val != "" {
-		if b, err := strconv.ParseBool(val); err == nil {
-			return b
+		*dst = val
+	}
+}
+
+func (e *envOverlay) int(key string, dst *int) {
+	if val := os.Getenv(key); val != "" {
+		i, err := strconv.Atoi(val)
+		if err != nil {
+			e.fail(key, val, "integer")
+			return
 		}
+		*dst = i
 	}
-	return defaultVal
 }
 
-// LoadEnvoyConfig loads configuration from environment variables with sensible defaults.
-// All settings can be overridden via environment variables.
-//
-// Environment variables:
-//
-//	ENVOY_PORT              - HTTP server port (default: 7470)
-//	ENVOY_POLL_INTERVAL     - Sleeve poll interval (default: 1h)
-//	ENVOY_IDLE_THRESHOLD    - Idle timeout, 0 = never (default: 0)
-//	ENVOY_MAX_SLEEVES       - Maximum concurrent sleeves (default: 10)
-//
-//	DOCKER_NETWORK          - Docker network name (default: raven)
-//	WORKSPACE_ROOT          - Container path for workspaces (default: /home/claude/workspaces)
-//	WORKSPACE_HOST_ROOT     - Host path for workspaces (required for sleeve mounts)
-//	CREDENTIALS_HOST_PATH   - Host path to Claude credentials file
-//	SETTINGS_HOST_PATH      - Host path to Claude settings file
-//	PLUGINS_HOST_PATH       - Host path to Claude plugins directory
-//	SLEEVE_IMAGE            - Docker image for sleeves (default: ghcr.io/hotschmoe/protectorate-sleeve:latest)
-//
-//	GITEA_URL               - Gitea server URL (default: http://gitea:3000)
-//	GITEA_USER              - Gitea username
-//	GITEA_PASSWORD          - Gitea password
-//	GITEA_TOKEN             - Gitea API token
-//
-//	MIRROR_ENABLED          - Enable GitHub mirroring (default: false)
-//	MIRROR_FREQUENCY        - Mirror frequency (default: daily)
-//	MIRROR_GITHUB_ORG       - GitHub organization to mirror
-//	MIRROR_GITHUB_TOKEN     - GitHub API token for mirroring
-func LoadEnvoyConfig() *EnvoyConfig {
+func (e *envOverlay) duration(key string, dst *time.Duration) {
+	if val := os.Getenv(key); val != "" {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			e.fail(key, val, "duration (e.g. 30s, 5m, 1h)")
+			return
+		}
+		*dst = d
+	}
+}
+
+func (e *envOverlay) bool(key string, dst *bool) {
+	if val := os.Getenv(key); val != "" {
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			e.fail(key, val, "boolean")
+			return
+		}
+		*dst = b
+	}
+}
+
+// list parses a comma-separated list.
+func (e *envOverlay) list(key string, dst *[]string) {
+	val := os.Getenv(key)
+	if val == "" {
+		return
+	}
+
+	var list []string
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	*dst = list
+}
+
+// defaultEnvoyConfig returns the built-in defaults. Paths under DataDir are
+// left empty and derived once DataDir is final.
+func defaultEnvoyConfig() *EnvoyConfig {
 	return &EnvoyConfig{
-		Port:          getEnvInt("ENVOY_PORT", 7470),
-		PollInterval:  getEnvDuration("ENVOY_POLL_INTERVAL", 1*time.Hour),
-		IdleThreshold: getEnvDuration("ENVOY_IDLE_THRESHOLD", 0),
-		MaxSleeves:    getEnvInt("ENVOY_MAX_SLEEVES", 10),
+		Port:         7470,
+		PollInterval: 1 * time.Hour,
+		MaxSleeves:   10,
+		DataDir:      "/home/claude/.envoy",
 		Docker: DockerConfig{
-			Network:             getEnv("DOCKER_NETWORK", "raven"),
-			WorkspaceRoot:       getEnv("WORKSPACE_ROOT", "/home/claude/workspaces"),
-			WorkspaceHostRoot:   getEnv("WORKSPACE_HOST_ROOT", ""),
-			CredentialsHostPath: getEnv("CREDENTIALS_HOST_PATH", ""),
-			SettingsHostPath:    getEnv("SETTINGS_HOST_PATH", ""),
-			PluginsHostPath:     getEnv("PLUGINS_HOST_PATH", ""),
-			SleeveImage:         getEnv("SLEEVE_IMAGE", "ghcr.io/hotschmoe/protectorate-sleeve:latest"),
+			Network:       "raven",
+			WorkspaceRoot: "/home/claude/workspaces",
+			SleeveImage:   "ghcr.io/hotschmoe/protectorate-sleeve:latest",
 		},
 		Gitea: GiteaConfig{
-			URL:      getEnv("GITEA_URL", "http://gitea:3000"),
-			User:     getEnv("GITEA_USER", ""),
-			Password: getEnv("GITEA_PASSWORD", ""),
-			Token:    getEnv("GITEA_TOKEN", ""),
+			URL: "http://gitea:3000",
 		},
 		Mirror: MirrorConfig{
-			Enabled:   getEnvBool("MIRROR_ENABLED", false),
-			Frequency: getEnv("MIRROR_FREQUENCY", "daily"),
-			GitHubOrg: getEnv("MIRROR_GITHUB_ORG", ""),
-			Token:     getEnv("MIRROR_GITHUB_TOKEN", ""),
+			Frequency: "daily",
+			GitHubURL: "https://github.com",
+		},
+		Audit: AuditConfig{
+			MaxSizeMB:  10,
+			MaxBackups: 5,
+		},
+		Probe: ProbeConfig{
+			Interval:         30 * time.Second,
+			Timeout:          5 * time.Second,
+			FailureThreshold: 3,
+			Policy:           "restart",
+		},
+		Pool: PoolConfig{
+			Profiles: []string{"claude-code"},
+		},
+		Fleet: FleetConfig{
+			Interval: 1 * time.Minute,
 		},
+		Proxy: ProxyConfig{
+			Port:  3128,
+			Allow: []string{"*"},
+		},
+	}
+}
+
+// LoadEnvoyConfig loads configuration from built-in defaults, then the YAML
+// config file at path (skipped if path is empty), then environment
+// variables, so a set environment variable always wins. The result is
+// validated; the returned error lists every problem found.
+//
+// Environment variables (config file keys in brackets):
+//
+//	ENVOY_PORT              - HTTP server port [port] (default: 7470)
+//	ENVOY_POLL_INTERVAL     - Sleeve poll interval [poll_interval] (default: 1h)
+//	ENVOY_IDLE_THRESHOLD    - Idle timeout, 0 = never [idle_threshold] (default: 0)
+//	ENVOY_MAX_SLEEVES       - Maximum concurrent sleeves [max_sleeves] (default: 10)
+//	ENVOY_DATA_DIR          - Directory for envoy state files [data_dir] (default: /home/claude/.envoy)
+//	ENVOY_TEMPLATES_DIR     - Directory of sleeve template YAML files [templates_dir] (default: $ENVOY_DATA_DIR/templates)
+//
+//	DOCKER_NETWORK          - Docker network name [docker.network] (default: raven)
+//	WORKSPACE_ROOT          - Container path for workspaces [docker.workspace_root] (default: /home/claude/workspaces)
+//	WORKSPACE_HOST_ROOT     - Host path for workspaces [docker.workspace_host_root] (default: detected from envoy's container)
+//	CREDENTIALS_HOST_PATH   - Host path to Claude credentials file [docker.credentials_host_path] (default: detected)
+//	SETTINGS_HOST_PATH      - Host path to Claude settings file [docker.settings_host_path] (default: detected)
+//	PLUGINS_HOST_PATH       - Host path to Claude plugins directory [docker.plugins_host_path] (default: detected)
+//	SLEEVE_IMAGE            - Docker image for sleeves [docker.sleeve_image] (default: ghcr.io/hotschmoe/protectorate-sleeve:latest)
+//	EGRESS_PROXY_IMAGE      - Image with the envoy binary, run as the egress proxy for allowlisted sleeves [docker.egress_proxy_image] (default: envoy's own image)
+//	CREDENTIALS_SECRET      - Stored secret written into every sleeve as its Claude credentials, instead of mounting CREDENTIALS_HOST_PATH [docker.credentials_secret]
+//
+//	GITEA_URL               - Gitea server URL [gitea.url] (default: http://gitea:3000)
+//	GITEA_USER              - Gitea username [gitea.user]
+//	GITEA_PASSWORD          - Gitea password [gitea.password]
+//	GITEA_TOKEN             - Gitea API token [gitea.token]
+//
+//	MIRROR_ENABLED          - Enable GitHub mirroring [mirror.enabled] (default: false)
+//	MIRROR_FREQUENCY        - Mirror frequency: hourly, daily, weekly or a duration [mirror.frequency] (default: daily)
+//	MIRROR_GITHUB_ORG       - GitHub organization to mirror [mirror.github_org]
+//	MIRROR_GITHUB_TOKEN     - GitHub API token for mirroring [mirror.github_token]
+//	MIRROR_GITHUB_URL       - Git host to push to, e.g. file:///srv/mirrors for testing [mirror.github_url] (default: https://github.com)
+//	MIRROR_REPOS            - Comma-separated workspaces and Gitea owner/name repos, empty = all workspaces [mirror.repos]
+//
+//	AUDIT_LOG_PATH          - Audit log file [audit.path] (default: $ENVOY_DATA_DIR/audit.log)
+//	AUDIT_MAX_SIZE_MB       - Rotate audit log after this size [audit.max_size_mb] (default: 10)
+//	AUDIT_MAX_BACKUPS       - Rotated audit logs to keep [audit.max_backups] (default: 5)
+//	AUDIT_TRUSTED_PROXIES   - Comma-separated proxy IPs or CIDRs whose X-Forwarded-For is trusted [audit.trusted_proxies]
+//
+//	SLEEVE_PROBE_INTERVAL   - Sleeve health probe interval, 0 = disabled [probe.interval] (default: 30s)
+//	SLEEVE_PROBE_TIMEOUT    - Timeout for a single probe [probe.timeout] (default: 5s)
+//	SLEEVE_PROBE_FAILURES   - Consecutive failures before acting [probe.failures] (default: 3)
+//	SLEEVE_UNHEALTHY_POLICY - restart, resleeve or notify [probe.unhealthy_policy] (default: restart)
+//
+//	SLEEVE_POOL_SIZE        - Warm sleeves kept per profile, 0 = disabled [pool.size] (default: 0)
+//	SLEEVE_POOL_PROFILES    - Comma-separated profiles to keep warm [pool.profiles] (default: claude-code)
+//
+//	FLEET_FILE              - Declarative fleet file [fleet.file] (default: $ENVOY_DATA_DIR/protectorate.yaml)
+//	FLEET_RECONCILE_INTERVAL - How often to converge on the fleet file, 0 = on request only [fleet.reconcile_interval] (default: 1m)
+//
+//	SLEEVE_PROXY_PORT       - Port of the forward proxy sleeves use, 0 = disabled [proxy.port] (default: 3128)
+//	SLEEVE_PROXY_HOST       - Host sleeves reach envoy's proxy at [proxy.host] (default: envoy's container name)
+//	SLEEVE_PROXY_ALLOW      - Comma-separated domains sleeves may reach [proxy.allow] (default: *)
+//	SLEEVE_PROXY_DENY       - Comma-separated domains no sleeve may reach [proxy.deny]
+//
+//	SECRETS_PATH            - Encrypted secrets store [secrets.path] (default: $ENVOY_DATA_DIR/secrets.json)
+//	SECRETS_KEY             - Base64 AES-256 master key for the store [secrets.key]
+//	SECRETS_KEY_FILE        - File holding the master key, created if missing [secrets.key_file] (default: $ENVOY_DATA_DIR/secrets.key)
+func LoadEnvoyConfig(path string) (*EnvoyConfig, error) {
+	cfg := defaultEnvoyConfig()
+
+	if path != "" {
+		if err := loadConfigFile(path, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	env := &envOverlay{}
+	env.int("ENVOY_PORT", &cfg.Port)
+	env.duration("ENVOY_POLL_INTERVAL", &cfg.PollInterval)
+	env.duration("ENVOY_IDLE_THRESHOLD", &cfg.IdleThreshold)
+	env.int("ENVOY_MAX_SLEEVES", &cfg.MaxSleeves)
+	env.str("ENVOY_DATA_DIR", &cfg.DataDir)
+	env.str("ENVOY_TEMPLATES_DIR", &cfg.TemplatesDir)
+
+	env.str("DOCKER_NETWORK", &cfg.Docker.Network)
+	env.str("WORKSPACE_ROOT", &cfg.Docker.WorkspaceRoot)
+	env.str("WORKSPACE_HOST_ROOT", &cfg.Docker.WorkspaceHostRoot)
+	env.str("CREDENTIALS_HOST_PATH", &cfg.Docker.CredentialsHostPath)
+	env.str("SETTINGS_HOST_PATH", &cfg.Docker.SettingsHostPath)
+	env.str("PLUGINS_HOST_PATH", &cfg.Docker.PluginsHostPath)
+	env.str("SLEEVE_IMAGE", &cfg.Docker.SleeveImage)
+	env.str("EGRESS_PROXY_IMAGE", &cfg.Docker.EgressProxyImage)
+
+	env.str("GITEA_URL", &cfg.Gitea.URL)
+	env.str("GITEA_USER", &cfg.Gitea.User)
+	env.str("GITEA_PASSWORD", &cfg.Gitea.Password)
+	env.str("GITEA_TOKEN", &cfg.Gitea.Token)
+
+	env.bool("MIRROR_ENABLED", &cfg.Mirror.Enabled)
+	env.str("MIRROR_FREQUENCY", &cfg.Mirror.Frequency)
+	env.str("MIRROR_GITHUB_ORG", &cfg.Mirror.GitHubOrg)
+	env.str("MIRROR_GITHUB_TOKEN", &cfg.Mirror.Token)
+	env.str("MIRROR_GITHUB_URL", &cfg.Mirror.GitHubURL)
+	env.list("MIRROR_REPOS", &cfg.Mirror.Repos)
+
+	env.str("AUDIT_LOG_PATH", &cfg.Audit.Path)
+	env.int("AUDIT_MAX_SIZE_MB", &cfg.Audit.MaxSizeMB)
+	env.int("AUDIT_MAX_BACKUPS", &cfg.Audit.MaxBackups)
+	env.list("AUDIT_TRUSTED_PROXIES", &cfg.Audit.TrustedProxies)
+
+	env.duration("SLEEVE_PROBE_INTERVAL", &cfg.Probe.Interval)
+	env.duration("SLEEVE_PROBE_TIMEOUT", &cfg.Probe.Timeout)
+	env.int("SLEEVE_PROBE_FAILURES", &cfg.Probe.FailureThreshold)
+	env.str("SLEEVE_UNHEALTHY_POLICY", &cfg.Probe.Policy)
+
+	env.int("SLEEVE_POOL_SIZE", &cfg.Pool.Size)
+	env.list("SLEEVE_POOL_PROFILES", &cfg.Pool.Profiles)
+
+	env.str("FLEET_FILE", &cfg.Fleet.Path)
+	env.duration("FLEET_RECONCILE_INTERVAL", &cfg.Fleet.Interval)
+
+	env.int("SLEEVE_PROXY_PORT", &cfg.Proxy.Port)
+	env.str("SLEEVE_PROXY_HOST", &cfg.Proxy.Host)
+	env.list("SLEEVE_PROXY_ALLOW", &cfg.Proxy.Allow)
+	env.list("SLEEVE_PROXY_DENY", &cfg.Proxy.Deny)
+
+	env.str("CREDENTIALS_SECRET", &cfg.Docker.CredentialsSecret)
+	env.str("SECRETS_PATH", &cfg.Secrets.Path)
+	env.str("SECRETS_KEY", &cfg.Secrets.Key)
+	env.str("SECRETS_KEY_FILE", &cfg.Secrets.KeyFile)
+
+	if cfg.TemplatesDir == "" {
+		cfg.TemplatesDir = filepath.Join(cfg.DataDir, "templates")
+	}
+	if cfg.Audit.Path == "" {
+		cfg.Audit.Path = filepath.Join(cfg.DataDir, "audit.log")
+	}
+	if cfg.Fleet.Path == "" {
+		cfg.Fleet.Path = filepath.Join(cfg.DataDir, "protectorate.yaml")
+	}
+	if cfg.Secrets.Path == "" {
+		cfg.Secrets.Path = filepath.Join(cfg.DataDir, "secrets.json")
+	}
+	if cfg.Secrets.KeyFile == "" {
+		cfg.Secrets.KeyFile = filepath.Join(cfg.DataDir, "secrets.key")
+	}
+
+	problems := append(env.errs, cfg.validate()...)
+	if len(problems) > 0 {
+		return nil, &ValidationError{Source: path, Problems: problems}
+	}
+	return cfg, nil
+}
+
+// SidecarConfig defines the configuration for the in-sleeve sidecar.
+type SidecarConfig struct {
+	Port          int
+	SleeveName    string
+	CLI           string
+	WorkspacePath string
+	User          string
+	TmuxSession   string
+	TTYDPort      int
+	Pooled        bool
+}
+
+// LoadSidecarConfig loads sidecar configuration from environment variables.
+//
+// Environment variables:
+//
+//	SIDECAR_PORT     - HTTP server port (default: 8080)
+//	SLEEVE_NAME      - Name of this sleeve (default: hostname)
+//	SLEEVE_CLI       - AI CLI to run: claude-code, gemini-cli, opencode (default: claude-code)
+//	SLEEVE_WORKSPACE - Workspace mount inside the sleeve (default: /home/claude/workspace)
+//	SLEEVE_USER      - Unprivileged user that runs tmux and the CLI (default: claude)
+//	TMUX_SESSION     - tmux session name (default: main)
+//	TTYD_PORT        - ttyd port (default: 7681)
+//	SLEEVE_POOLED    - Wait for envoy to claim the sleeve before starting the CLI (default: false)
+func LoadSidecarConfig() *SidecarConfig {
+	hostname, _ := os.Hostname()
+
+	return &SidecarConfig{
+		Port:          getEnvInt("SIDECAR_PORT", 8080),
+		SleeveName:    getEnv("SLEEVE_NAME", hostname),
+		CLI:           getEnv("SLEEVE_CLI", "claude-code"),
+		WorkspacePath: getEnv("SLEEVE_WORKSPACE", "/home/claude/workspace"),
+		User:          getEnv("SLEEVE_USER", "claude"),
+		TmuxSession:   getEnv("TMUX_SESSION", "main"),
+		TTYDPort:      getEnvInt("TTYD_PORT", 7681),
+		Pooled:        getEnvBool("SLEEVE_POOLED", false),
 	}
 }
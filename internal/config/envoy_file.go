@@ -0,0 +1,162 @@
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationError lists every problem found in an envoy configuration.
+type ValidationError struct {
+	Source   string // config file, or "" if only env vars were read
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	source := "environment"
+	if e.Source != "" {
+		source = e.Source + " and environment"
+	}
+	return fmt.Sprintf("invalid configuration (%s):\n  %s", source, strings.Join(e.Problems, "\n  "))
+}
+
+// loadConfigFile decodes the YAML config file at path over cfg. Unknown keys
+// are rejected so a typo does not silently leave a default in place.
+func loadConfigFile(path string, cfg *EnvoyConfig) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	// An empty file is valid and leaves the defaults alone.
+	if err := dec.Decode(cfg); err != nil && err != io.EOF {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// validate returns a description of each invalid setting, naming both the
+// environment variable and the config file key.
+func (c *EnvoyConfig) validate() []string {
+	var problems []string
+	check := func(ok bool, env, key, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s (%s): %s", env, key, fmt.Sprintf(format, args...)))
+		}
+	}
+	absolute := func(path, env, key string) {
+		check(path == "" || filepath.IsAbs(path), env, key, "%q must be an absolute path", path)
+	}
+
+	check(c.Port > 0 && c.Port <= 65535, "ENVOY_PORT", "port", "%d is not a valid port", c.Port)
+	check(c.PollInterval > 0, "ENVOY_POLL_INTERVAL", "poll_interval", "must be positive, got %s", c.PollInterval)
+	check(c.IdleThreshold >= 0, "ENVOY_IDLE_THRESHOLD", "idle_threshold", "must not be negative, got %s", c.IdleThreshold)
+	check(c.MaxSleeves > 0, "ENVOY_MAX_SLEEVES", "max_sleeves", "must be at least 1, got %d", c.MaxSleeves)
+	check(c.DataDir != "", "ENVOY_DATA_DIR", "data_dir", "must be set")
+	absolute(c.DataDir, "ENVOY_DATA_DIR", "data_dir")
+	absolute(c.TemplatesDir, "ENVOY_TEMPLATES_DIR", "templates_dir")
+
+	check(c.Docker.Network != "", "DOCKER_NETWORK", "docker.network", "must be set")
+	check(c.Docker.SleeveImage != "", "SLEEVE_IMAGE", "docker.sleeve_image", "must be set")
+	check(c.Docker.WorkspaceRoot != "", "WORKSPACE_ROOT", "docker.workspace_root", "must be set")
+	absolute(c.Docker.WorkspaceRoot, "WORKSPACE_ROOT", "docker.workspace_root")
+	absolute(c.Docker.WorkspaceHostRoot, "WORKSPACE_HOST_ROOT", "docker.workspace_host_root")
+	absolute(c.Docker.CredentialsHostPath, "CREDENTIALS_HOST_PATH", "docker.credentials_host_path")
+	absolute(c.Docker.SettingsHostPath, "SETTINGS_HOST_PATH", "docker.settings_host_path")
+	absolute(c.Docker.PluginsHostPath, "PLUGINS_HOST_PATH", "docker.plugins_host_path")
+
+	if c.Gitea.URL != "" {
+		u, err := url.Parse(c.Gitea.URL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"GITEA_URL", "gitea.url", "%q is not an http(s) URL", c.Gitea.URL)
+	}
+
+	if c.Mirror.Enabled {
+		_, err := c.Mirror.Interval()
+		check(err == nil, "MIRROR_FREQUENCY", "mirror.frequency", "%v", err)
+		check(c.Mirror.GitHubOrg != "", "MIRROR_GITHUB_ORG", "mirror.github_org", "must be set when mirroring is enabled")
+		u, err := url.Parse(c.Mirror.GitHubURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https" || u.Scheme == "file"),
+			"MIRROR_GITHUB_URL", "mirror.github_url", "%q is not an http(s) or file URL", c.Mirror.GitHubURL)
+	}
+
+	absolute(c.Audit.Path, "AUDIT_LOG_PATH", "audit.path")
+	check(c.Audit.MaxSizeMB >= 0, "AUDIT_MAX_SIZE_MB", "audit.max_size_mb", "must not be negative, got %d", c.Audit.MaxSizeMB)
+	check(c.Audit.MaxBackups >= 0, "AUDIT_MAX_BACKUPS", "audit.max_backups", "must not be negative, got %d", c.Audit.MaxBackups)
+	for _, proxy := range c.Audit.TrustedProxies {
+		_, addrErr := netip.ParseAddr(proxy)
+		_, prefixErr := netip.ParsePrefix(proxy)
+		check(addrErr == nil || prefixErr == nil, "AUDIT_TRUSTED_PROXIES", "audit.trusted_proxies", "%q is not an IP address or CIDR range", proxy)
+	}
+
+	check(c.Probe.Interval >= 0, "SLEEVE_PROBE_INTERVAL", "probe.interval", "must not be negative, got %s", c.Probe.Interval)
+	check(c.Probe.Timeout > 0, "SLEEVE_PROBE_TIMEOUT", "probe.timeout", "must be positive, got %s", c.Probe.Timeout)
+	check(c.Probe.FailureThreshold > 0, "SLEEVE_PROBE_FAILURES", "probe.failures", "must be at least 1, got %d", c.Probe.FailureThreshold)
+	switch c.Probe.Policy {
+	case "restart", "resleeve", "notify":
+	default:
+		check(false, "SLEEVE_UNHEALTHY_POLICY", "probe.unhealthy_policy", "%q is not one of restart, resleeve, notify", c.Probe.Policy)
+	}
+
+	check(c.Pool.Size >= 0, "SLEEVE_POOL_SIZE", "pool.size", "must not be negative, got %d", c.Pool.Size)
+	check(c.Pool.Size == 0 || len(c.Pool.Profiles) > 0, "SLEEVE_POOL_PROFILES", "pool.profiles", "must list at least one profile when the pool is enabled")
+
+	absolute(c.Fleet.Path, "FLEET_FILE", "fleet.file")
+	check(c.Fleet.Interval >= 0, "FLEET_RECONCILE_INTERVAL", "fleet.reconcile_interval", "must not be negative, got %s", c.Fleet.Interval)
+
+	check(c.Proxy.Port >= 0 && c.Proxy.Port <= 65535, "SLEEVE_PROXY_PORT", "proxy.port", "%d is not a valid port", c.Proxy.Port)
+	check(c.Proxy.Port == 0 || c.Proxy.Port != c.Port, "SLEEVE_PROXY_PORT", "proxy.port", "must differ from ENVOY_PORT %d", c.Port)
+
+	absolute(c.Secrets.Path, "SECRETS_PATH", "secrets.path")
+	absolute(c.Secrets.KeyFile, "SECRETS_KEY_FILE", "secrets.key_file")
+	if c.Secrets.Key != "" {
+		key, err := base64.StdEncoding.DecodeString(c.Secrets.Key)
+		check(err == nil && len(key) == 32, "SECRETS_KEY", "secrets.key", "must be 32 bytes, base64 encoded")
+	}
+
+	return problems
+}
+
+const redacted = "[redacted]"
+
+// Redacted returns a copy of the config with credentials replaced, safe to
+// log or serve.
+func (c *EnvoyConfig) Redacted() *EnvoyConfig {
+	out := *c
+	out.Pool.Profiles = append([]string(nil), c.Pool.Profiles...)
+	out.Mirror.Repos = append([]string(nil), c.Mirror.Repos...)
+	out.Proxy.Allow = append([]string(nil), c.Proxy.Allow...)
+	out.Proxy.Deny = append([]string(nil), c.Proxy.Deny...)
+	out.Audit.TrustedProxies = append([]string(nil), c.Audit.TrustedProxies...)
+	for _, secret := range []*string{&out.Gitea.Password, &out.Gitea.Token, &out.Mirror.Token, &out.Secrets.Key} {
+		if *secret != "" {
+			*secret = redacted
+		}
+	}
+	return &out
+}
+
+// Document renders the config as a generic document keyed like the config
+// file, with durations as strings such as "30s". Encoding it as JSON or YAML
+// gives output that can be pasted back into a config file.
+func (c *EnvoyConfig) Document() (map[string]interface{}, error) {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Fleet is the desired state declared in the fleet file (protectorate.yaml):
+//
+//	workspaces:
+//	  - name: api
+//	    repo: https://github.com/example/api.git
+//	    branch: main
+//	  - name: scratch            # no repo: an empty workspace
+//	sleeves:
+//	  - name: quell
+//	    workspace: api
+//	    profile: claude-code
+//	  - name: rei
+//	    workspace: api
+//	    template: heavy
+//	prune: false
+//
+// Workspaces are never deleted. Sleeves the reconciler spawned are killed
+// once they are removed from the file; with prune, every sleeve not in the
+// file is killed.
+type Fleet struct {
+	Workspaces []FleetWorkspace `yaml:"workspaces" json:"workspaces"`
+	Sleeves    []FleetSleeve    `yaml:"sleeves" json:"sleeves"`
+	Prune      bool             `yaml:"prune" json:"prune"`
+}
+
+// FleetWorkspace is a desired workspace, cloned from Repo when set.
+type FleetWorkspace struct {
+	Name   string `yaml:"name" json:"name"`
+	Repo   string `yaml:"repo" json:"repo,omitempty"`
+	Branch string `yaml:"branch" json:"branch,omitempty"`
+}
+
+// FleetSleeve is a desired sleeve. Workspace is a workspace name, either
+// declared under workspaces or already present in the workspace root.
+type FleetSleeve struct {
+	Name      string `yaml:"name" json:"name"`
+	Workspace string `yaml:"workspace" json:"workspace"`
+	Profile   string `yaml:"profile" json:"profile,omitempty"`
+	Template  string `yaml:"template" json:"template,omitempty"`
+}
+
+// LoadFleet reads and validates the fleet file at path.
+func LoadFleet(path string) (*Fleet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fleet Fleet
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&fleet); err != nil {
+		return nil, fmt.Errorf("fleet file %s: %w", path, err)
+	}
+
+	if err := fleet.validate(); err != nil {
+		return nil, fmt.Errorf("fleet file %s: %w", path, err)
+	}
+
+	return &fleet, nil
+}
+
+func (f *Fleet) validate() error {
+	workspaces := make(map[string]bool)
+	for i, ws := range f.Workspaces {
+		if ws.Name == "" {
+			return fmt.Errorf("workspaces[%d]: name required", i)
+		}
+		if !validWorkspaceName(ws.Name) {
+			return fmt.Errorf("workspaces[%d]: invalid name %q", i, ws.Name)
+		}
+		if workspaces[ws.Name] {
+			return fmt.Errorf("workspaces[%d]: duplicate name %q", i, ws.Name)
+		}
+		if ws.Repo != "" && !strings.HasPrefix(ws.Repo, "https://") {
+			return fmt.Errorf("workspaces[%d]: repo must be an HTTPS URL", i)
+		}
+		if ws.Branch != "" && ws.Repo == "" {
+			return fmt.Errorf("workspaces[%d]: branch requires repo", i)
+		}
+		workspaces[ws.Name] = true
+	}
+
+	sleeves := make(map[string]bool)
+	for i, sl := range f.Sleeves {
+		if sl.Name == "" {
+			return fmt.Errorf("sleeves[%d]: name required", i)
+		}
+		if sleeves[sl.Name] {
+			return fmt.Errorf("sleeves[%d]: duplicate name %q", i, sl.Name)
+		}
+		if sl.Workspace == "" {
+			return fmt.Errorf("sleeves[%d]: workspace required", i)
+		}
+		if !validWorkspaceName(sl.Workspace) {
+			return fmt.Errorf("sleeves[%d]: workspace must be a workspace name, not a path", i)
+		}
+		sleeves[sl.Name] = true
+	}
+
+	return nil
+}
+
+// validWorkspaceName reports whether name can only refer to a directory
+// directly under the workspace root.
+func validWorkspaceName(name string) bool {
+	return !strings.ContainsAny(name, "/\\.")
+}
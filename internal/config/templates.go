@@ -0,0 +1,161 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SleeveTemplate defines a named, reusable sleeve spawn spec.
+//
+// Templates are YAML files in ENVOY_TEMPLATES_DIR; the file name without the
+// extension is the template name:
+//
+//	# templates/heavy.yaml
+//	description: Claude with extra memory and a shared package cache
+//	image: ghcr.io/hotschmoe/protectorate-sleeve:latest
+//	profile: claude-code
+//	resources:
+//	  memory: 8g
+//	  cpus: 4
+//	  pids_limit: 2048
+//	env:
+//	  NODE_OPTIONS: --max-old-space-size=6144
+//	mounts:
+//	  - source: /srv/cache/npm
+//	    target: /home/claude/.npm
+//	network: buildnet
+//	network_policy: isolated
+//	egress:
+//	  - github.com
+//	  - registry.npmjs.org
+//	egress_deny:
+//	  - gist.github.com
+//	secrets:
+//	  - name: github-token
+//	    env: GITHUB_TOKEN
+//	  - name: npmrc
+//	    file: .npmrc
+//	prompt: Read .cstack/PLAN.md and continue with the next open item.
+type SleeveTemplate struct {
+	Name          string            `yaml:"-" json:"name"`
+	Description   string            `yaml:"description" json:"description,omitempty"`
+	Image         string            `yaml:"image" json:"image,omitempty"`
+	Profile       string            `yaml:"profile" json:"profile,omitempty"`
+	Resources     TemplateResources `yaml:"resources" json:"resources"`
+	Env           map[string]string `yaml:"env" json:"env,omitempty"`
+	Mounts        []TemplateMount   `yaml:"mounts" json:"mounts,omitempty"`
+	Network       string            `yaml:"network" json:"network,omitempty"`
+	NetworkPolicy string            `yaml:"network_policy" json:"network_policy,omitempty"`
+	Egress        []string          `yaml:"egress" json:"egress,omitempty"`
+	EgressDeny    []string          `yaml:"egress_deny" json:"egress_deny,omitempty"`
+	Secrets       []TemplateSecret  `yaml:"secrets" json:"secrets,omitempty"`
+	Prompt        string            `yaml:"prompt" json:"prompt,omitempty"`
+}
+
+// TemplateResources defines container resource limits. Zero values mean no limit.
+type TemplateResources struct {
+	Memory    string  `yaml:"memory" json:"memory,omitempty"` // e.g. 512m, 4g
+	CPUs      float64 `yaml:"cpus" json:"cpus,omitempty"`
+	PidsLimit int64   `yaml:"pids_limit" json:"pids_limit,omitempty"`
+}
+
+// TemplateMount defines an extra bind mount. Source is a host path.
+type TemplateMount struct {
+	Source   string `yaml:"source" json:"source"`
+	Target   string `yaml:"target" json:"target"`
+	ReadOnly bool   `yaml:"read_only" json:"read_only,omitempty"`
+}
+
+// TemplateSecret delivers a stored secret as an env var, a file under
+// /run/secrets, or both. With neither it is a file named after the secret.
+type TemplateSecret struct {
+	Name string `yaml:"name" json:"name"`
+	Env  string `yaml:"env" json:"env,omitempty"`
+	File string `yaml:"file" json:"file,omitempty"`
+}
+
+// LoadSleeveTemplates reads every *.yaml and *.yml file in dir. A missing
+// directory yields no templates; an invalid file is an error naming the file.
+func LoadSleeveTemplates(dir string) (map[string]*SleeveTemplate, error) {
+	templates := make(map[string]*SleeveTemplate)
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return templates, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if e.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+
+		path := filepath.Join(dir, e.Name())
+		tmpl, err := loadSleeveTemplate(path)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", path, err)
+		}
+
+		tmpl.Name = strings.TrimSuffix(e.Name(), ext)
+		if _, dup := templates[tmpl.Name]; dup {
+			return nil, fmt.Errorf("template %s: duplicate template name %q", path, tmpl.Name)
+		}
+		templates[tmpl.Name] = tmpl
+	}
+
+	return templates, nil
+}
+
+// TemplateNames returns the template names in sorted order.
+func TemplateNames(templates map[string]*SleeveTemplate) []string {
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func loadSleeveTemplate(path string) (*SleeveTemplate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tmpl SleeveTemplate
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&tmpl); err != nil {
+		return nil, err
+	}
+
+	for i, m := range tmpl.Mounts {
+		if !filepath.IsAbs(m.Source) || !filepath.IsAbs(m.Target) {
+			return nil, fmt.Errorf("mounts[%d]: source and target must be absolute paths", i)
+		}
+	}
+	if tmpl.Resources.CPUs < 0 || tmpl.Resources.PidsLimit < 0 {
+		return nil, fmt.Errorf("resources must not be negative")
+	}
+	switch tmpl.NetworkPolicy {
+	case "", "shared", "isolated", "none":
+	default:
+		return nil, fmt.Errorf("network_policy %q is not one of shared, isolated, none", tmpl.NetworkPolicy)
+	}
+	for i, sec := range tmpl.Secrets {
+		if sec.Name == "" {
+			return nil, fmt.Errorf("secrets[%d]: name required", i)
+		}
+	}
+
+	return &tmpl, nil
+}
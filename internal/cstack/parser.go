@@ -0,0 +1,179 @@
+package cstack
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var listItemPrefix = regexp.MustCompile(`^(\d+\.|[-*])\s+`)
+
+// ParseCurrent reads and parses .cstack/CURRENT.md in the given workspace.
+func ParseCurrent(workspacePath string) (*CurrentState, error) {
+	path := filepath.Join(workspacePath, StackDir, "CURRENT.md")
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := parseCurrent(f)
+	if err != nil {
+		return nil, err
+	}
+	state.LastModified = info.ModTime()
+	return state, nil
+}
+
+// ExtractStatus returns only the status field of CURRENT.md.
+func ExtractStatus(workspacePath string) (SleeveStatus, error) {
+	state, err := ParseCurrent(workspacePath)
+	if err != nil {
+		return "", err
+	}
+	return state.Status, nil
+}
+
+// ParsePlan reads .cstack/PLAN.md and counts its checklist items.
+func ParsePlan(workspacePath string) (*PlanState, error) {
+	path := filepath.Join(workspacePath, StackDir, "PLAN.md")
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &PlanState{LastModified: info.ModTime()}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		countCheckbox(strings.TrimSpace(scanner.Text()), &plan.Progress)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// ReadStack parses CURRENT.md and PLAN.md and reports the most recent
+// modification time of any file in .cstack/ as the last activity.
+// Returns os.ErrNotExist if the workspace has no .cstack/ directory.
+func ReadStack(workspacePath string) (*Stack, error) {
+	dir := filepath.Join(workspacePath, StackDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	stack := &Stack{}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if info.ModTime().After(stack.LastActivity) {
+			stack.LastActivity = info.ModTime()
+		}
+	}
+
+	if current, err := ParseCurrent(workspacePath); err == nil {
+		stack.Current = current
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if plan, err := ParsePlan(workspacePath); err == nil {
+		stack.Plan = plan
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return stack, nil
+}
+
+func parseCurrent(r io.Reader) (*CurrentState, error) {
+	sections := make(map[string][]string)
+	section := ""
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t")
+		if strings.HasPrefix(line, "## ") {
+			section = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(line, "## ")))
+			continue
+		}
+		if section == "" || strings.TrimSpace(line) == "" {
+			continue
+		}
+		sections[section] = append(sections[section], strings.TrimSpace(line))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	state := &CurrentState{
+		Status:    StatusIdle,
+		Blockers:  []string{},
+		NextSteps: []string{},
+	}
+
+	if lines := sections["status"]; len(lines) > 0 {
+		state.Status = SleeveStatus(strings.ToLower(lines[0]))
+	}
+
+	if lines := sections["task"]; len(lines) > 0 {
+		state.Task = strings.Join(lines, " ")
+	}
+
+	for _, line := range sections["progress"] {
+		countCheckbox(line, &state.Progress)
+	}
+
+	for _, line := range sections["blockers"] {
+		if item := listItem(line); item != "" {
+			state.Blockers = append(state.Blockers, item)
+		}
+	}
+
+	for _, line := range sections["next steps"] {
+		if item := listItem(line); item != "" {
+			state.NextSteps = append(state.NextSteps, item)
+		}
+	}
+
+	return state, nil
+}
+
+// countCheckbox adds a "- [ ]" or "- [x]" line to p.
+func countCheckbox(line string, p *Progress) {
+	switch {
+	case strings.HasPrefix(line, "- [x]"), strings.HasPrefix(line, "- [X]"):
+		p.Total++
+		p.Completed++
+	case strings.HasPrefix(line, "- [ ]"):
+		p.Total++
+	}
+}
+
+// listItem strips list markers and returns "" for placeholder entries like "(none)".
+func listItem(line string) string {
+	item := strings.TrimSpace(listItemPrefix.ReplaceAllString(line, ""))
+	if strings.EqualFold(item, "(none)") || strings.EqualFold(item, "none") {
+		return ""
+	}
+	return item
+}
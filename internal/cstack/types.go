@@ -0,0 +1,45 @@
+package cstack
+
+import "time"
+
+// StackDir is the cortical stack directory inside a workspace.
+const StackDir = ".cstack"
+
+// SleeveStatus is the agent-reported state from CURRENT.md.
+type SleeveStatus string
+
+const (
+	StatusIdle    SleeveStatus = "idle"
+	StatusWorking SleeveStatus = "working"
+	StatusBlocked SleeveStatus = "blocked"
+	StatusDone    SleeveStatus = "done"
+)
+
+// Progress counts checklist items under a "## Progress" heading.
+type Progress struct {
+	Total     int
+	Completed int
+}
+
+// CurrentState is the parsed contents of .cstack/CURRENT.md.
+type CurrentState struct {
+	Status       SleeveStatus
+	Task         string
+	Progress     Progress
+	Blockers     []string
+	NextSteps    []string
+	LastModified time.Time
+}
+
+// PlanState is the parsed contents of .cstack/PLAN.md.
+type PlanState struct {
+	Progress     Progress
+	LastModified time.Time
+}
+
+// Stack is everything envoy reads from a workspace's .cstack/ directory.
+type Stack struct {
+	Current      *CurrentState
+	Plan         *PlanState
+	LastActivity time.Time
+}
@@ -0,0 +1,345 @@
+// Package egress is an HTTP forward proxy that lets sleeves reach only the
+// domains they are allowed to. It handles CONNECT for HTTPS and absolute-URI
+// requests for plain HTTP; it never sees inside TLS.
+//
+// Whatever the policy allows, the proxy never connects to loopback, private,
+// link-local or unspecified addresses, or to the host it runs on: otherwise a
+// sleeve could reach envoy's API or other sleeves through it, appearing to
+// come from the proxy. The check is made on the resolved address as the
+// connection is dialed, so a name that resolves differently the second time
+// gains nothing.
+package egress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const dialTimeout = 10 * time.Second
+
+// Policy decides which hosts may be reached. An entry matches the domain
+// itself and every subdomain, so "github.com" also allows "api.github.com";
+// "*" matches everything. Deny wins over Allow, and an empty Allow allows
+// nothing.
+type Policy struct {
+	Allow []string
+	Deny  []string
+}
+
+// ParseList splits a comma-separated domain list, dropping empty entries.
+func ParseList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// Permits reports whether host, with or without a port, may be reached.
+func (p Policy) Permits(host string) bool {
+	host = hostname(host)
+	return !matchesAny(p.Deny, host) && matchesAny(p.Allow, host)
+}
+
+func matchesAny(domains []string, host string) bool {
+	for _, d := range domains {
+		d = strings.TrimPrefix(strings.ToLower(d), "*.")
+		d = strings.TrimPrefix(d, ".")
+		if d == "*" || host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+func hostname(hostport string) string {
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		hostport = h
+	}
+	return strings.TrimSuffix(strings.ToLower(hostport), ".")
+}
+
+// Request describes one proxied request once it has finished.
+type Request struct {
+	Client   string // remote address of the client
+	Method   string // CONNECT for tunnels
+	Host     string // host:port requested
+	Allowed  bool
+	BytesOut int64 // client to upstream
+	BytesIn  int64 // upstream to client
+	Duration time.Duration
+	Err      error
+}
+
+// Proxy is an http.Handler serving as a forward proxy.
+type Proxy struct {
+	policy    func(client string) Policy
+	blocked   func(netip.AddrPort) bool
+	done      func(Request)
+	local     map[netip.Addr]bool // this host's own addresses
+	dialer    *net.Dialer
+	transport *http.Transport
+
+	// lookup resolves a host before it is checked; tests replace it.
+	lookup func(ctx context.Context, host string) ([]netip.Addr, error)
+}
+
+// New returns a proxy that looks up the policy for each client by its remote
+// address. blocked, if not nil, refuses addresses beyond the ones the proxy
+// always refuses, such as sleeve containers. done, if not nil, is called
+// after every request, including refused ones.
+func New(policy func(client string) Policy, blocked func(netip.AddrPort) bool, done func(Request)) *Proxy {
+	p := &Proxy{
+		policy:  policy,
+		blocked: blocked,
+		done:    done,
+		local:   make(map[netip.Addr]bool),
+		lookup: func(ctx context.Context, host string) ([]netip.Addr, error) {
+			return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		},
+	}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, a := range addrs {
+			if prefix, err := netip.ParsePrefix(a.String()); err == nil {
+				p.local[prefix.Addr().Unmap()] = true
+			}
+		}
+	}
+
+	p.dialer = &net.Dialer{Timeout: dialTimeout, Control: p.control}
+	p.transport = &http.Transport{
+		Proxy:               nil,
+		DialContext:         p.dialer.DialContext,
+		TLSHandshakeTimeout: dialTimeout,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	return p
+}
+
+// blockedError reports a target address the proxy refuses to connect to.
+type blockedError struct {
+	addr netip.AddrPort
+}
+
+func (e *blockedError) Error() string {
+	return fmt.Sprintf("address %s is not reachable through the proxy", e.addr)
+}
+
+// check refuses addresses a sleeve must never reach through the proxy.
+func (p *Proxy) check(addr netip.AddrPort) error {
+	ip := addr.Addr().Unmap()
+	addr = netip.AddrPortFrom(ip, addr.Port())
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		p.local[ip] || (p.blocked != nil && p.blocked(addr)) {
+		return &blockedError{addr}
+	}
+	return nil
+}
+
+// control runs on every outgoing connection once its address is resolved.
+func (p *Proxy) control(network, address string, _ syscall.RawConn) error {
+	addr, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	return p.check(addr)
+}
+
+// resolve checks every address hostport resolves to, so a refused target is
+// reported before any connection is attempted. A plain HTTP target without a
+// port uses port 80.
+func (p *Proxy) resolve(ctx context.Context, hostport string) error {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host, port = hostport, "80"
+	}
+	n, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port %q", port)
+	}
+
+	addrs, err := p.lookup(ctx, strings.Trim(host, "[]"))
+	if err != nil {
+		return err
+	}
+	for _, a := range addrs {
+		if err := p.check(netip.AddrPortFrom(a, uint16(n))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := Request{
+		Client: r.RemoteAddr,
+		Method: r.Method,
+		Host:   r.Host,
+	}
+	if r.Method != http.MethodConnect {
+		req.Host = r.URL.Host
+	}
+	start := time.Now()
+	defer func() {
+		req.Duration = time.Since(start)
+		if p.done != nil {
+			p.done(req)
+		}
+	}()
+
+	if req.Host == "" {
+		req.Err = fmt.Errorf("not a proxy request")
+		http.Error(w, "this is a forward proxy; send absolute-URI or CONNECT requests", http.StatusBadRequest)
+		return
+	}
+
+	if !p.policy(r.RemoteAddr).Permits(req.Host) {
+		req.Err = fmt.Errorf("host %s not allowed", hostname(req.Host))
+		http.Error(w, "egress to "+hostname(req.Host)+" is not allowed", http.StatusForbidden)
+		return
+	}
+
+	if err := p.resolve(r.Context(), req.Host); err != nil {
+		req.Err = err
+		upstreamError(w, r, err)
+		return
+	}
+	req.Allowed = true
+
+	if r.Method == http.MethodConnect {
+		req.BytesOut, req.BytesIn, req.Err = p.tunnel(w, r)
+	} else {
+		req.BytesOut, req.BytesIn, req.Err = p.forward(w, r)
+	}
+}
+
+// tunnel connects the client to r.Host and relays bytes both ways until
+// either side closes.
+func (p *Proxy) tunnel(w http.ResponseWriter, r *http.Request) (out, in int64, err error) {
+	upstream, err := p.dialer.DialContext(r.Context(), "tcp", r.Host)
+	if err != nil {
+		upstreamError(w, r, err)
+		return 0, 0, err
+	}
+	defer upstream.Close()
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "hijacking not supported", http.StatusInternalServerError)
+		return 0, 0, fmt.Errorf("hijacking not supported")
+	}
+	client, buf, err := hijacker.Hijack()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer client.Close()
+
+	if _, err := client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		return 0, 0, err
+	}
+
+	done := make(chan int64, 1)
+	go func() {
+		// Bytes the client sent after the CONNECT line are already buffered.
+		n, _ := io.Copy(upstream, io.MultiReader(io.LimitReader(buf, int64(buf.Reader.Buffered())), client))
+		if tcp, ok := upstream.(*net.TCPConn); ok {
+			tcp.CloseWrite()
+		}
+		done <- n
+	}()
+	in, _ = io.Copy(client, upstream)
+	if tcp, ok := client.(*net.TCPConn); ok {
+		tcp.CloseWrite()
+	}
+	out = <-done
+	return out, in, nil
+}
+
+// forward sends a plain HTTP request upstream and copies the response back.
+func (p *Proxy) forward(w http.ResponseWriter, r *http.Request) (out, in int64, err error) {
+	outReq := r.Clone(r.Context())
+	outReq.RequestURI = ""
+	removeHopHeaders(outReq.Header)
+
+	body := &countingReader{r: r.Body}
+	if r.Body != nil && r.Body != http.NoBody {
+		outReq.Body = body
+	}
+
+	resp, err := p.transport.RoundTrip(outReq)
+	if err != nil {
+		upstreamError(w, r, err)
+		return body.n, 0, err
+	}
+	defer resp.Body.Close()
+
+	removeHopHeaders(resp.Header)
+	for k, vs := range resp.Header {
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	in, err = io.Copy(w, resp.Body)
+	return body.n, in, err
+}
+
+// upstreamError answers a request whose target could not be reached: 403 if
+// the target is an address the proxy refuses, 502 otherwise.
+func upstreamError(w http.ResponseWriter, r *http.Request, err error) {
+	var blocked *blockedError
+	if errors.As(err, &blocked) {
+		host := r.Host
+		if r.Method != http.MethodConnect {
+			host = r.URL.Host
+		}
+		http.Error(w, "egress to "+hostname(host)+" is not allowed", http.StatusForbidden)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadGateway)
+}
+
+// hopHeaders apply to a single connection and are not forwarded.
+var hopHeaders = []string{
+	"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authenticate",
+	"Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+func removeHopHeaders(h http.Header) {
+	for _, f := range h["Connection"] {
+		for _, name := range strings.Split(f, ",") {
+			h.Del(strings.TrimSpace(name))
+		}
+	}
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
+
+type countingReader struct {
+	r io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) Close() error {
+	return c.r.Close()
+}
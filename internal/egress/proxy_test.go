@@ -0,0 +1,88 @@
+package egress
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+// newTestProxy returns a proxy allowing every domain, with names resolved
+// from hosts instead of DNS, and a pointer to the last finished request.
+func newTestProxy(hosts map[string]string, blocked func(netip.AddrPort) bool) (*Proxy, *Request) {
+	last := &Request{}
+	p := New(func(string) Policy { return Policy{Allow: []string{"*"}} }, blocked, func(req Request) { *last = req })
+	p.lookup = func(_ context.Context, host string) ([]netip.Addr, error) {
+		if addr, err := netip.ParseAddr(host); err == nil {
+			return []netip.Addr{addr}, nil
+		}
+		if ip, ok := hosts[host]; ok {
+			return []netip.Addr{netip.MustParseAddr(ip)}, nil
+		}
+		return nil, fmt.Errorf("no such host %s", host)
+	}
+	return p, last
+}
+
+func TestProxyRefusesInternalTargets(t *testing.T) {
+	sleeveIP := netip.MustParseAddr("198.51.100.7")
+	p, last := newTestProxy(map[string]string{
+		"envoy":        "172.18.0.2",
+		"sleeve-quell": "198.51.100.7",
+	}, func(addr netip.AddrPort) bool { return addr.Addr() == sleeveIP })
+
+	targets := []string{
+		"127.0.0.1:7470",
+		"envoy:7470",
+		"172.18.0.5:7681",
+		"sleeve-quell:7681",
+		"198.51.100.7:7681",
+		"[::1]:7470",
+		"169.254.169.254:80",
+		"0.0.0.0:7470",
+	}
+	for _, target := range targets {
+		for _, method := range []string{http.MethodConnect, http.MethodGet} {
+			url := target
+			if method == http.MethodGet {
+				url = "http://" + target + "/api/sleeves"
+			}
+			rec := httptest.NewRecorder()
+			p.ServeHTTP(rec, httptest.NewRequest(method, url, nil))
+
+			if rec.Code != http.StatusForbidden {
+				t.Errorf("%s %s: status %d, want %d", method, target, rec.Code, http.StatusForbidden)
+			}
+			if last.Allowed {
+				t.Errorf("%s %s: recorded as allowed", method, target)
+			}
+		}
+	}
+}
+
+// A name that resolved to a public address when checked but to a refused
+// one when dialed is still refused.
+func TestProxyChecksDialedAddress(t *testing.T) {
+	reached := false
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+	defer upstream.Close()
+
+	p, _ := newTestProxy(nil, nil)
+	p.lookup = func(context.Context, string) ([]netip.Addr, error) {
+		return []netip.Addr{netip.MustParseAddr("93.184.216.34")}, nil
+	}
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, upstream.URL, nil))
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if reached {
+		t.Error("request reached the loopback upstream")
+	}
+}
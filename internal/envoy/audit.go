@@ -0,0 +1,286 @@
+package envoy
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hotschmoe/protectorate/internal/config"
+	"github.com/hotschmoe/protectorate/internal/protocol"
+)
+
+// AuditLog is an append-only JSON lines log of mutating API operations.
+// The active file is rotated to path.1, path.2, ... once it exceeds maxSize.
+type AuditLog struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// AuditFilter narrows the entries returned by Query. Zero values match everything.
+type AuditFilter struct {
+	Action  string
+	Actor   string
+	Target  string
+	Outcome string
+	Since   time.Time
+	Until   time.Time
+	Limit   int
+}
+
+func NewAuditLog(cfg config.AuditConfig) (*AuditLog, error) {
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+
+	a := &AuditLog{
+		path:       cfg.Path,
+		maxSize:    int64(cfg.MaxSizeMB) * 1024 * 1024,
+		maxBackups: cfg.MaxBackups,
+	}
+
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *AuditLog) open() error {
+	f, err := os.OpenFile(a.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat audit log: %w", err)
+	}
+
+	a.file = f
+	a.size = info.Size()
+	return nil
+}
+
+// rotate shifts path.N-1 -> path.N, ..., path -> path.1 and reopens path.
+// Caller must hold a.mu.
+func (a *AuditLog) rotate() error {
+	a.file.Close()
+
+	if a.maxBackups <= 0 {
+		os.Remove(a.path)
+		return a.open()
+	}
+
+	os.Remove(fmt.Sprintf("%s.%d", a.path, a.maxBackups))
+	for i := a.maxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", a.path, i), fmt.Sprintf("%s.%d", a.path, i+1))
+	}
+	os.Rename(a.path, a.path+".1")
+
+	return a.open()
+}
+
+// Record appends an entry to the log. Failures are logged, never returned,
+// so that auditing cannot break the operation being audited.
+func (a *AuditLog) Record(entry protocol.AuditEntry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("audit: failed to encode entry: %v", err)
+		return
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.maxSize > 0 && a.size+int64(len(line)) > a.maxSize && a.size > 0 {
+		if err := a.rotate(); err != nil {
+			log.Printf("audit: failed to rotate log: %v", err)
+			return
+		}
+	}
+
+	n, err := a.file.Write(line)
+	a.size += int64(n)
+	if err != nil {
+		log.Printf("audit: failed to write entry: %v", err)
+	}
+}
+
+// Query returns matching entries across the active and rotated files, newest first.
+func (a *AuditLog) Query(f AuditFilter) ([]protocol.AuditEntry, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	files := []string{a.path}
+	for i := 1; i <= a.maxBackups; i++ {
+		files = append(files, fmt.Sprintf("%s.%d", a.path, i))
+	}
+
+	limit := f.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+
+	result := make([]protocol.AuditEntry, 0)
+	for _, path := range files {
+		entries, err := readAuditFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		for i := len(entries) - 1; i >= 0; i-- {
+			if !f.matches(entries[i]) {
+				continue
+			}
+			result = append(result, entries[i])
+			if len(result) >= limit {
+				return result, nil
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func (a *AuditLog) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.file.Close()
+}
+
+func readAuditFile(path string) ([]protocol.AuditEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []protocol.AuditEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e protocol.AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+func (f AuditFilter) matches(e protocol.AuditEntry) bool {
+	if f.Action != "" && e.Action != f.Action {
+		return false
+	}
+	if f.Actor != "" && e.Actor != f.Actor {
+		return false
+	}
+	if f.Target != "" && e.Target != f.Target {
+		return false
+	}
+	if f.Outcome != "" && e.Outcome != f.Outcome {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && e.Time.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+// requestActor identifies who made a request: the X-Protectorate-Actor header,
+// then basic auth user, falling back to "anonymous".
+func requestActor(r *http.Request) string {
+	if actor := r.Header.Get("X-Protectorate-Actor"); actor != "" {
+		return actor
+	}
+	if user, _, ok := r.BasicAuth(); ok && user != "" {
+		return user
+	}
+	return "anonymous"
+}
+
+// requestSourceIP returns the IP r came from. X-Forwarded-For is only
+// believed when r comes from one of the trusted proxies, and then only as far
+// back as the proxies are trusted: each appends the address it saw, so the
+// rightmost address that is not a trusted proxy is the client, while anything
+// further left was written by the client.
+func requestSourceIP(r *http.Request, trusted []string) string {
+	ip := clientIP(r.RemoteAddr)
+	if !isTrustedProxy(ip, trusted) {
+		return ip
+	}
+
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		ip = hop
+		if !isTrustedProxy(hop, trusted) {
+			break
+		}
+	}
+	return ip
+}
+
+// isTrustedProxy reports whether ip is one of the addresses or within one of
+// the CIDR ranges in trusted.
+func isTrustedProxy(ip string, trusted []string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, t := range trusted {
+		if prefix, err := netip.ParsePrefix(t); err == nil {
+			if prefix.Contains(addr) {
+				return true
+			}
+		} else if a, err := netip.ParseAddr(t); err == nil && a.Unmap() == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// audit records the outcome of a mutating operation performed for r.
+func (s *Server) audit(r *http.Request, action, target string, details map[string]string, opErr error) {
+	entry := protocol.AuditEntry{
+		Time:     time.Now(),
+		Actor:    requestActor(r),
+		SourceIP: requestSourceIP(r, s.cfg.Load().Audit.TrustedProxies),
+		Action:   action,
+		Target:   target,
+		Details:  details,
+		Outcome:  "success",
+	}
+	if opErr != nil {
+		entry.Outcome = "failure"
+		entry.Error = opErr.Error()
+	}
+	s.auditLog.Record(entry)
+}
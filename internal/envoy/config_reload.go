@@ -0,0 +1,187 @@
+package envoy
+
+import (
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hotschmoe/protectorate/internal/config"
+	"github.com/hotschmoe/protectorate/internal/protocol"
+)
+
+// LiveConfig is the envoy configuration shared by the managers. A reload
+// swaps it atomically; an operation that reads several settings should Load
+// once so it never mixes old and new values.
+type LiveConfig struct {
+	ptr atomic.Pointer[config.EnvoyConfig]
+}
+
+func NewLiveConfig(cfg *config.EnvoyConfig) *LiveConfig {
+	lc := &LiveConfig{}
+	lc.ptr.Store(cfg)
+	return lc
+}
+
+func (lc *LiveConfig) Load() *config.EnvoyConfig {
+	return lc.ptr.Load()
+}
+
+// restartSettings are config keys, or key prefixes ending in ".", that are
+// read once at startup: the listener, the background loops, and the paths
+// and network that running sleeves and state files already use.
+var restartSettings = []string{
+	"port",
+	"data_dir",
+	"poll_interval",
+	"docker.network",
+	"docker.workspace_root",
+	"audit.",
+	"probe.",
+	"fleet.",
+	"mirror.",
+	"proxy.port",
+	"secrets.",
+}
+
+func needsRestart(key string) bool {
+	for _, setting := range restartSettings {
+		if key == setting || (strings.HasSuffix(setting, ".") && strings.HasPrefix(key, setting)) {
+			return true
+		}
+	}
+	return false
+}
+
+// keepRestartSettings copies the settings listed in restartSettings from cur
+// into next, so the live config shows what envoy is actually running with.
+func keepRestartSettings(next, cur *config.EnvoyConfig) {
+	next.Port = cur.Port
+	next.DataDir = cur.DataDir
+	next.PollInterval = cur.PollInterval
+	next.Docker.Network = cur.Docker.Network
+	next.Docker.WorkspaceRoot = cur.Docker.WorkspaceRoot
+	next.Audit = cur.Audit
+	next.Probe = cur.Probe
+	next.Fleet = cur.Fleet
+	next.Mirror = cur.Mirror
+	next.Proxy.Port = cur.Proxy.Port
+	next.Secrets = cur.Secrets
+}
+
+// changedSettings returns the sorted config keys whose values differ.
+func changedSettings(a, b *config.EnvoyConfig) ([]string, error) {
+	docA, err := a.Document()
+	if err != nil {
+		return nil, err
+	}
+	docB, err := b.Document()
+	if err != nil {
+		return nil, err
+	}
+
+	flatA, flatB := make(map[string]interface{}), make(map[string]interface{})
+	flattenDocument("", docA, flatA)
+	flattenDocument("", docB, flatB)
+
+	var changed []string
+	for key, val := range flatA {
+		if !reflect.DeepEqual(val, flatB[key]) {
+			changed = append(changed, key)
+		}
+	}
+	for key := range flatB {
+		if _, ok := flatA[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// flattenDocument maps nested config sections to dotted keys such as
+// "docker.sleeve_image".
+func flattenDocument(prefix string, doc map[string]interface{}, out map[string]interface{}) {
+	for key, val := range doc {
+		if section, ok := val.(map[string]interface{}); ok {
+			flattenDocument(prefix+key+".", section, out)
+			continue
+		}
+		out[prefix+key] = val
+	}
+}
+
+// reload re-reads the config file and environment and swaps in the result.
+// An invalid config leaves the current one in place.
+func (s *Server) reload() (*protocol.ConfigReload, error) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	next, err := config.LoadEnvoyConfig(s.configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Compare with detected host paths filled in as they would be at
+	// startup, so only explicit changes are reported.
+	cur := s.cfg.Load()
+	proposed := *next
+	s.sleeves.host.fill(&proposed)
+	changed, err := changedSettings(cur, &proposed)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &protocol.ConfigReload{
+		ConfigFile:      s.configPath,
+		Applied:         []string{},
+		RestartRequired: []string{},
+		ReloadedAt:      time.Now(),
+	}
+	for _, key := range changed {
+		if needsRestart(key) {
+			result.RestartRequired = append(result.RestartRequired, key)
+		} else {
+			result.Applied = append(result.Applied, key)
+		}
+	}
+
+	keepRestartSettings(next, cur)
+	s.sleeves.host.fill(next)
+	s.cfg.ptr.Store(next)
+
+	// Let the pool grow or shrink to a new size now rather than on its next tick.
+	s.pool.signal()
+
+	return result, nil
+}
+
+// Reload reloads the configuration on SIGHUP, logging and auditing the result.
+func (s *Server) Reload() {
+	result, err := s.reload()
+
+	entry := protocol.AuditEntry{
+		Actor:   "envoy",
+		Action:  "config.reload",
+		Target:  s.configPath,
+		Details: map[string]string{"trigger": "SIGHUP"},
+		Outcome: outcomeLabel(err),
+		Error:   errString(err),
+	}
+	if err != nil {
+		s.auditLog.Record(entry)
+		log.Printf("config reload failed, keeping current config: %v", err)
+		return
+	}
+
+	entry.Details["applied"] = strings.Join(result.Applied, ",")
+	entry.Details["restart_required"] = strings.Join(result.RestartRequired, ",")
+	s.auditLog.Record(entry)
+
+	log.Printf("config reloaded: applied [%s]", strings.Join(result.Applied, ", "))
+	if len(result.RestartRequired) > 0 {
+		log.Printf("config reload: restart envoy to apply [%s]", strings.Join(result.RestartRequired, ", "))
+	}
+}
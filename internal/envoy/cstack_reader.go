@@ -0,0 +1,87 @@
+package envoy
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/hotschmoe/protectorate/internal/cstack"
+	"github.com/hotschmoe/protectorate/internal/protocol"
+)
+
+// readAgentStatus parses the cortical stack in a workspace. Returns nil if the
+// workspace has no .cstack/ directory.
+func readAgentStatus(workspace string) (*protocol.AgentStatus, error) {
+	stack, err := cstack.ReadStack(workspace)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	status := &protocol.AgentStatus{
+		State:        string(cstack.StatusIdle),
+		Blockers:     []string{},
+		LastActivity: stack.LastActivity,
+		UpdatedAt:    time.Now(),
+	}
+
+	if cur := stack.Current; cur != nil {
+		status.State = string(cur.Status)
+		status.CurrentTask = cur.Task
+		status.Progress = protocol.Progress{
+			Total:     cur.Progress.Total,
+			Completed: cur.Progress.Completed,
+		}
+		status.Blockers = cur.Blockers
+		status.NextSteps = cur.NextSteps
+	}
+
+	if plan := stack.Plan; plan != nil {
+		status.PlanProgress = &protocol.Progress{
+			Total:     plan.Progress.Total,
+			Completed: plan.Progress.Completed,
+		}
+	}
+
+	return status, nil
+}
+
+// RefreshAgentStatus re-reads .cstack/ for every sleeve's workspace.
+func (m *SleeveManager) RefreshAgentStatus() {
+	for _, sl := range m.List() {
+		status, err := readAgentStatus(sl.Workspace)
+		if err != nil {
+			log.Printf("sleeve %s: failed to read cstack: %v", sl.Name, err)
+			continue
+		}
+
+		m.mu.Lock()
+		if sleeve, ok := m.sleeves[sl.Name]; ok {
+			sleeve.AgentStatus = status
+		}
+		m.mu.Unlock()
+	}
+}
+
+// PollAgentStatus refreshes agent status immediately and then every interval
+// until stop is closed.
+func (m *SleeveManager) PollAgentStatus(interval time.Duration, stop <-chan struct{}) {
+	m.RefreshAgentStatus()
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.RefreshAgentStatus()
+		case <-stop:
+			return
+		}
+	}
+}
@@ -1,14 +1,20 @@
 package envoy
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"strings"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
 )
 
 type DockerClient struct {
@@ -46,7 +52,7 @@ func (d *DockerClient) ListContainers() ([]ContainerInfo, error) {
 
 	containers, err := d.cli.ContainerList(ctx, container.ListOptions{All: true})
 	if err != nil {
-		return nil, err
+		return nil, dockerErr("container_list", err)
 	}
 
 	result := make([]ContainerInfo, 0, len(containers))
@@ -89,7 +95,7 @@ func (d *DockerClient) ListNetworks() ([]NetworkInfo, error) {
 
 	networks, err := d.cli.NetworkList(ctx, network.ListOptions{})
 	if err != nil {
-		return nil, err
+		return nil, dockerErr("network_list", err)
 	}
 
 	result := make([]NetworkInfo, 0, len(networks))
@@ -110,7 +116,7 @@ func (d *DockerClient) CreateContainer(name, image string, config *container.Con
 
 	resp, err := d.cli.ContainerCreate(ctx, config, hostConfig, networkConfig, nil, name)
 	if err != nil {
-		return "", err
+		return "", dockerErr("container_create", err)
 	}
 
 	return resp.ID, nil
@@ -118,17 +124,76 @@ func (d *DockerClient) CreateContainer(name, image string, config *container.Con
 
 func (d *DockerClient) StartContainer(id string) error {
 	ctx := context.Background()
-	return d.cli.ContainerStart(ctx, id, container.StartOptions{})
+	return dockerErr("container_start", d.cli.ContainerStart(ctx, id, container.StartOptions{}))
 }
 
 func (d *DockerClient) StopContainer(id string) error {
 	ctx := context.Background()
-	return d.cli.ContainerStop(ctx, id, container.StopOptions{})
+	return dockerErr("container_stop", d.cli.ContainerStop(ctx, id, container.StopOptions{}))
+}
+
+func (d *DockerClient) RestartContainer(id string) error {
+	ctx := context.Background()
+	return dockerErr("container_restart", d.cli.ContainerRestart(ctx, id, container.StopOptions{}))
+}
+
+func (d *DockerClient) PauseContainer(id string) error {
+	ctx := context.Background()
+	return dockerErr("container_pause", d.cli.ContainerPause(ctx, id))
+}
+
+func (d *DockerClient) UnpauseContainer(id string) error {
+	ctx := context.Background()
+	return dockerErr("container_unpause", d.cli.ContainerUnpause(ctx, id))
 }
 
 func (d *DockerClient) RemoveContainer(id string) error {
 	ctx := context.Background()
-	return d.cli.ContainerRemove(ctx, id, container.RemoveOptions{Force: true})
+	return dockerErr("container_remove", d.cli.ContainerRemove(ctx, id, container.RemoveOptions{Force: true}))
+}
+
+func (d *DockerClient) RenameContainer(id, name string) error {
+	ctx := context.Background()
+	return dockerErr("container_rename", d.cli.ContainerRename(ctx, id, name))
+}
+
+// CommitContainer saves the container's filesystem as image ref. Bind and
+// tmpfs mounts are not included. env entries replace those of the container.
+func (d *DockerClient) CommitContainer(id, ref string, labels map[string]string, env []string) (string, error) {
+	ctx := context.Background()
+	resp, err := d.cli.ContainerCommit(ctx, id, container.CommitOptions{
+		Reference: ref,
+		Pause:     true,
+		Config:    &container.Config{Labels: labels, Env: env},
+	})
+	if err != nil {
+		return "", dockerErr("container_commit", err)
+	}
+	return resp.ID, nil
+}
+
+func (d *DockerClient) RemoveImage(ref string) error {
+	ctx := context.Background()
+	_, err := d.cli.ImageRemove(ctx, ref, image.RemoveOptions{PruneChildren: true})
+	return dockerErr("image_remove", err)
+}
+
+// ImageID returns the ID of the image ref names, or "" if there is none.
+func (d *DockerClient) ImageID(ref string) (string, error) {
+	ctx := context.Background()
+	img, _, err := d.cli.ImageInspectWithRaw(ctx, ref)
+	if client.IsErrNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", dockerErr("image_inspect", err)
+	}
+	return img.ID, nil
+}
+
+func (d *DockerClient) TagImage(source, ref string) error {
+	ctx := context.Background()
+	return dockerErr("image_tag", d.cli.ImageTag(ctx, source, ref))
 }
 
 func (d *DockerClient) GetContainerByName(name string) (*types.Container, error) {
@@ -139,7 +204,7 @@ func (d *DockerClient) GetContainerByName(name string) (*types.Container, error)
 
 	containers, err := d.cli.ContainerList(ctx, container.ListOptions{All: true, Filters: f})
 	if err != nil {
-		return nil, err
+		return nil, dockerErr("container_list", err)
 	}
 
 	for _, c := range containers {
@@ -158,7 +223,7 @@ func (d *DockerClient) EnsureNetwork(name string) error {
 
 	networks, err := d.cli.NetworkList(ctx, network.ListOptions{})
 	if err != nil {
-		return err
+		return dockerErr("network_list", err)
 	}
 
 	for _, n := range networks {
@@ -168,7 +233,162 @@ func (d *DockerClient) EnsureNetwork(name string) error {
 	}
 
 	_, err = d.cli.NetworkCreate(ctx, name, network.CreateOptions{Driver: "bridge"})
-	return err
+	return dockerErr("network_create", err)
+}
+
+func (d *DockerClient) ConnectNetwork(networkName, containerID string) error {
+	ctx := context.Background()
+	return dockerErr("network_connect", d.cli.NetworkConnect(ctx, networkName, containerID, nil))
+}
+
+// CreateNetwork creates a bridge network. An internal network has no route
+// out of the host; its containers can only reach each other.
+func (d *DockerClient) CreateNetwork(name string, internal bool, labels map[string]string) error {
+	ctx := context.Background()
+	_, err := d.cli.NetworkCreate(ctx, name, network.CreateOptions{
+		Driver:   "bridge",
+		Internal: internal,
+		Labels:   labels,
+	})
+	return dockerErr("network_create", err)
+}
+
+func (d *DockerClient) DisconnectNetwork(networkName, containerID string) error {
+	ctx := context.Background()
+	return dockerErr("network_disconnect", d.cli.NetworkDisconnect(ctx, networkName, containerID, true))
+}
+
+func (d *DockerClient) RemoveNetwork(name string) error {
+	ctx := context.Background()
+	return dockerErr("network_remove", d.cli.NetworkRemove(ctx, name))
+}
+
+func (d *DockerClient) Ping(ctx context.Context) error {
+	_, err := d.cli.Ping(ctx)
+	return dockerErr("ping", err)
+}
+
+func (d *DockerClient) NetworkExists(ctx context.Context, name string) (bool, error) {
+	networks, err := d.cli.NetworkList(ctx, network.ListOptions{})
+	if err != nil {
+		return false, dockerErr("network_list", err)
+	}
+
+	for _, n := range networks {
+		if n.Name == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ExecOptions describes a one-off command to run inside a container.
+type ExecOptions struct {
+	User       string
+	WorkingDir string
+	Env        []string
+	Cmd        []string
+}
+
+// ExecResult is the captured outcome of an exec.
+type ExecResult struct {
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	ExitCode int    `json:"exit_code"`
+}
+
+// Exec runs a command inside the container and waits for it to exit. If ctx
+// is cancelled the attached stream is closed and ctx.Err() is returned; the
+// process itself keeps running inside the container.
+func (d *DockerClient) Exec(ctx context.Context, id string, opts ExecOptions) (*ExecResult, error) {
+	exec, err := d.cli.ContainerExecCreate(ctx, id, container.ExecOptions{
+		User:         opts.User,
+		WorkingDir:   opts.WorkingDir,
+		Env:          opts.Env,
+		Cmd:          opts.Cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return nil, dockerErr("exec_create", err)
+	}
+
+	resp, err := d.cli.ContainerExecAttach(ctx, exec.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return nil, dockerErr("exec_attach", err)
+	}
+	defer resp.Close()
+
+	var stdout, stderr bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		_, err := stdcopy.StdCopy(&stdout, &stderr, resp.Reader)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return nil, err
+		}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	inspect, err := d.cli.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return nil, dockerErr("exec_inspect", err)
+	}
+
+	return &ExecResult{
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		ExitCode: inspect.ExitCode,
+	}, nil
+}
+
+// ExecInteractive starts a TTY exec with stdin attached and returns its ID and
+// the hijacked stream. The caller must Close the stream.
+func (d *DockerClient) ExecInteractive(ctx context.Context, id string, opts ExecOptions) (string, types.HijackedResponse, error) {
+	exec, err := d.cli.ContainerExecCreate(ctx, id, container.ExecOptions{
+		User:         opts.User,
+		WorkingDir:   opts.WorkingDir,
+		Env:          opts.Env,
+		Cmd:          opts.Cmd,
+		Tty:          true,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return "", types.HijackedResponse{}, dockerErr("exec_create", err)
+	}
+
+	resp, err := d.cli.ContainerExecAttach(ctx, exec.ID, container.ExecAttachOptions{Tty: true})
+	if err != nil {
+		return "", types.HijackedResponse{}, dockerErr("exec_attach", err)
+	}
+
+	return exec.ID, resp, nil
+}
+
+func (d *DockerClient) ResizeExec(ctx context.Context, execID string, rows, cols uint) error {
+	return dockerErr("exec_resize", d.cli.ContainerExecResize(ctx, execID, container.ResizeOptions{Height: rows, Width: cols}))
+}
+
+// ExecCommand runs cmd inside the container as user and returns its combined
+// output. A non-zero exit code is reported as an error.
+func (d *DockerClient) ExecCommand(id, user string, cmd []string) (string, error) {
+	res, err := d.Exec(context.Background(), id, ExecOptions{User: user, Cmd: cmd})
+	if err != nil {
+		return "", err
+	}
+
+	out := res.Stdout + res.Stderr
+	if res.ExitCode != 0 {
+		return out, fmt.Errorf("command exited with code %d: %s", res.ExitCode, strings.TrimSpace(out))
+	}
+	return out, nil
 }
 
 func (d *DockerClient) ListSleeveContainers() ([]types.Container, error) {
@@ -177,10 +397,29 @@ func (d *DockerClient) ListSleeveContainers() ([]types.Container, error) {
 	f := filters.NewArgs()
 	f.Add("label", "protectorate.sleeve=true")
 
-	return d.cli.ContainerList(ctx, container.ListOptions{All: true, Filters: f})
+	containers, err := d.cli.ContainerList(ctx, container.ListOptions{All: true, Filters: f})
+	return containers, dockerErr("container_list", err)
+}
+
+// ReadFile returns the contents of a file in the container's filesystem,
+// which need not be running.
+func (d *DockerClient) ReadFile(id, path string) ([]byte, error) {
+	ctx := context.Background()
+	rc, _, err := d.cli.CopyFromContainer(ctx, id, path)
+	if err != nil {
+		return nil, dockerErr("container_copy", err)
+	}
+	defer rc.Close()
+
+	tr := tar.NewReader(rc)
+	if _, err := tr.Next(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return io.ReadAll(io.LimitReader(tr, 1<<20))
 }
 
 func (d *DockerClient) InspectContainer(id string) (types.ContainerJSON, error) {
 	ctx := context.Background()
-	return d.cli.ContainerInspect(ctx, id)
+	info, err := d.cli.ContainerInspect(ctx, id)
+	return info, dockerErr("container_inspect", err)
 }
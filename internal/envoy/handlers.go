@@ -2,10 +2,14 @@ package envoy
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/hotschmoe/protectorate/internal/gitea"
 	"github.com/hotschmoe/protectorate/internal/protocol"
 )
 
@@ -15,8 +19,7 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleAuthStatus(w http.ResponseWriter, r *http.Request) {
-	credPath := "/home/claude/.claude/.credentials.json"
-	_, err := os.Stat(credPath)
+	_, err := os.Stat(credentialsPath)
 	authenticated := err == nil
 
 	w.Header().Set("Content-Type", "application/json")
@@ -60,8 +63,18 @@ func (s *Server) handleSleeves(w http.ResponseWriter, r *http.Request) {
 		}
 
 		sleeve, err := s.sleeves.Spawn(req)
+		target := req.Name
+		if sleeve != nil {
+			target = sleeve.Name
+		}
+		s.audit(r, "sleeve.spawn", target, map[string]string{"workspace": req.Workspace, "template": req.Template}, err)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			errMsg := err.Error()
+			if strings.HasPrefix(errMsg, "template") || strings.HasPrefix(errMsg, "invalid") || strings.HasPrefix(errMsg, "secret") {
+				http.Error(w, errMsg, http.StatusBadRequest)
+			} else {
+				http.Error(w, errMsg, http.StatusInternalServerError)
+			}
 			return
 		}
 
@@ -76,13 +89,36 @@ func (s *Server) handleSleeves(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) handleSleeveByName(w http.ResponseWriter, r *http.Request) {
 	path := strings.TrimPrefix(r.URL.Path, "/api/sleeves/")
-	name := strings.Split(path, "/")[0]
+	parts := strings.Split(path, "/")
+	name := parts[0]
 
 	if name == "" {
 		http.Error(w, "sleeve name required", http.StatusBadRequest)
 		return
 	}
 
+	if len(parts) > 1 {
+		switch parts[1] {
+		case "loop":
+			action := ""
+			if len(parts) > 2 {
+				action = parts[2]
+			}
+			s.handleSleeveLoop(w, r, name, action)
+		case "input":
+			s.handleSleeveInput(w, r, name)
+		case "screen":
+			s.handleSleeveScreen(w, r, name)
+		case "exec":
+			s.handleSleeveExec(w, r, name)
+		case "pause", "unpause", "stop", "start", "hibernate", "wake":
+			s.handleSleeveLifecycle(w, r, name, parts[1])
+		default:
+			http.NotFound(w, r)
+		}
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
 		sleeve, err := s.sleeves.Get(name)
@@ -95,7 +131,9 @@ func (s *Server) handleSleeveByName(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(sleeve)
 
 	case http.MethodDelete:
-		if err := s.sleeves.Kill(name); err != nil {
+		err := s.sleeves.Kill(name)
+		s.audit(r, "sleeve.kill", name, nil, err)
+		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -111,17 +149,26 @@ func (s *Server) handleSleeveTerminal(w http.ResponseWriter, r *http.Request) {
 	path := strings.TrimPrefix(r.URL.Path, "/sleeves/")
 	parts := strings.Split(path, "/")
 
-	if len(parts) < 2 || parts[1] != "terminal" {
+	if len(parts) < 2 || (parts[1] != "terminal" && parts[1] != "shell") {
 		http.Error(w, "invalid path", http.StatusBadRequest)
 		return
 	}
 
 	name := parts[0]
+	if parts[1] == "shell" {
+		s.handleSleeveShell(w, r, name)
+		return
+	}
+
 	sleeve, err := s.sleeves.Get(name)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
+	if sleeve.TTYDAddress == "" {
+		http.Error(w, "sleeve has no network; use /sleeves/"+name+"/shell", http.StatusConflict)
+		return
+	}
 
 	s.proxyWebSocket(w, r, sleeve.TTYDAddress)
 }
@@ -173,16 +220,35 @@ func (s *Server) handleWorkspaces(w http.ResponseWriter, r *http.Request) {
 
 	case http.MethodPost:
 		var req struct {
-			Name string `json:"name"`
+			Name        string `json:"name"`
+			Gitea       bool   `json:"gitea,omitempty"` // also create a Gitea repo as origin
+			Description string `json:"description,omitempty"`
+			Private     bool   `json:"private,omitempty"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "invalid request body", http.StatusBadRequest)
 			return
 		}
 
-		ws, err := s.workspaces.Create(req.Name)
+		var ws *protocol.WorkspaceInfo
+		var err error
+		if req.Gitea {
+			var repo *gitea.Repo
+			ws, repo, err = s.workspaces.CreateOnGitea(req.Name, protocol.PublishWorkspaceRequest{
+				Description: req.Description,
+				Private:     req.Private,
+			})
+			details := map[string]string{"gitea": "true"}
+			if repo != nil {
+				details["repo"] = repo.CloneURL
+			}
+			s.audit(r, "workspace.create", req.Name, details, err)
+		} else {
+			ws, err = s.workspaces.Create(req.Name)
+			s.audit(r, "workspace.create", req.Name, nil, err)
+		}
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			http.Error(w, err.Error(), giteaErrorStatus(err, http.StatusBadRequest))
 			return
 		}
 
@@ -221,6 +287,11 @@ func (s *Server) handleCloneWorkspace(w http.ResponseWriter, r *http.Request) {
 		}
 
 		job, err := s.workspaces.Clone(req)
+		details := map[string]string{"repo_url": req.RepoURL}
+		if job != nil {
+			details["job_id"] = job.ID
+		}
+		s.audit(r, "workspace.clone", req.Name, details, err)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
@@ -235,6 +306,78 @@ func (s *Server) handleCloneWorkspace(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// giteaErrorStatus maps Gitea failures to 502 and a missing Gitea config to
+// 503, and everything else to fallback.
+func giteaErrorStatus(err error, fallback int) int {
+	var apiErr *gitea.APIError
+	switch {
+	case errors.Is(err, gitea.ErrNotConfigured):
+		return http.StatusServiceUnavailable
+	case errors.As(err, &apiErr), strings.Contains(err.Error(), "gitea request failed"):
+		return http.StatusBadGateway
+	}
+	return fallback
+}
+
+func (s *Server) handleGiteaRepos(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	repos, err := s.workspaces.GiteaRepos()
+	if err != nil {
+		http.Error(w, err.Error(), giteaErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(repos)
+}
+
+// handleWorkspaceGitea publishes an existing workspace to a new Gitea repo.
+func (s *Server) handleWorkspaceGitea(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req protocol.PublishWorkspaceRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Workspace == "" {
+		req.Workspace = r.URL.Query().Get("workspace")
+	}
+	if req.Workspace == "" {
+		http.Error(w, "workspace parameter required", http.StatusBadRequest)
+		return
+	}
+
+	repo, err := s.workspaces.PublishToGitea(req)
+	details := map[string]string{}
+	if repo != nil {
+		details["repo"] = repo.CloneURL
+	}
+	s.audit(r, "workspace.publish", req.Workspace, details, err)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "not found") {
+			status = http.StatusNotFound
+		} else if strings.HasPrefix(err.Error(), "invalid") {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), giteaErrorStatus(err, status))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(repo)
+}
+
 func (s *Server) handleWorkspaceBranches(w http.ResponseWriter, r *http.Request) {
 	workspace := r.URL.Query().Get("workspace")
 	action := r.URL.Query().Get("action")
@@ -242,6 +385,7 @@ func (s *Server) handleWorkspaceBranches(w http.ResponseWriter, r *http.Request)
 	// fetch-all doesn't require a workspace parameter
 	if action == "fetch-all" && r.Method == http.MethodPost {
 		result := s.workspaces.FetchAllRemotes()
+		s.audit(r, "workspace.fetch_all", "", nil, fetchResultErr(result, nil))
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(result)
 		return
@@ -287,6 +431,7 @@ func (s *Server) handleWorkspaceBranches(w http.ResponseWriter, r *http.Request)
 			}
 
 			err := s.workspaces.SwitchBranch(req.Workspace, req.Branch)
+			s.audit(r, "workspace.switch", req.Workspace, map[string]string{"branch": req.Branch}, err)
 			if err != nil {
 				errMsg := err.Error()
 				if strings.Contains(errMsg, "not found") {
@@ -321,6 +466,7 @@ func (s *Server) handleWorkspaceBranches(w http.ResponseWriter, r *http.Request)
 
 		case "fetch":
 			result, err := s.workspaces.FetchRemote(workspace)
+			s.audit(r, "workspace.fetch", workspace, nil, fetchResultErr(result, err))
 			if err != nil {
 				errMsg := err.Error()
 				if strings.Contains(errMsg, "not found") {
@@ -338,6 +484,7 @@ func (s *Server) handleWorkspaceBranches(w http.ResponseWriter, r *http.Request)
 
 		case "pull":
 			result, err := s.workspaces.PullRemote(workspace)
+			s.audit(r, "workspace.pull", workspace, nil, fetchResultErr(result, err))
 			if err != nil {
 				errMsg := err.Error()
 				if strings.Contains(errMsg, "not found") {
@@ -363,3 +510,570 @@ func (s *Server) handleWorkspaceBranches(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 	}
 }
+
+// fetchResultErr folds an unsuccessful FetchResult into an error for auditing.
+func fetchResultErr(result *protocol.FetchResult, err error) error {
+	if err != nil {
+		return err
+	}
+	if result != nil && !result.Success {
+		return errors.New(result.Message)
+	}
+	return nil
+}
+
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	filter := AuditFilter{
+		Action:  q.Get("action"),
+		Actor:   q.Get("actor"),
+		Target:  q.Get("target"),
+		Outcome: q.Get("outcome"),
+	}
+
+	if v := q.Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid since: must be RFC3339", http.StatusBadRequest)
+			return
+		}
+		filter.Since = t
+	}
+
+	if v := q.Get("until"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid until: must be RFC3339", http.StatusBadRequest)
+			return
+		}
+		filter.Until = t
+	}
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+
+	entries, err := s.auditLog.Query(filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+func (s *Server) handleTasks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.tasks.List())
+
+	case http.MethodPost:
+		var req protocol.CreateTaskRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		task, err := s.tasks.Create(req)
+		target := ""
+		if task != nil {
+			target = task.ID
+		}
+		s.audit(r, "task.create", target, map[string]string{"workspace": req.Workspace, "profile": req.Profile}, err)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(task)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleTaskByID(w http.ResponseWriter, r *http.Request) {
+	id := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/tasks/"), "/")[0]
+	if id == "" {
+		http.Error(w, "task id required", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		task, err := s.tasks.Get(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(task)
+
+	case http.MethodPost:
+		var req protocol.UpdateTaskRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		task, err := s.tasks.Update(id, req)
+		s.audit(r, "task.update", id, map[string]string{"status": req.Status}, err)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				http.Error(w, err.Error(), http.StatusNotFound)
+			} else {
+				http.Error(w, err.Error(), http.StatusConflict)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(task)
+
+	case http.MethodDelete:
+		err := s.tasks.Cancel(id)
+		s.audit(r, "task.cancel", id, nil, err)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				http.Error(w, err.Error(), http.StatusNotFound)
+			} else {
+				http.Error(w, err.Error(), http.StatusConflict)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleLoops(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.loops.List())
+}
+
+func (s *Server) handleSleeveLifecycle(w http.ResponseWriter, r *http.Request, name, action string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var sleeve *protocol.SleeveInfo
+	var err error
+	switch action {
+	case "pause":
+		sleeve, err = s.sleeves.Pause(name)
+	case "unpause":
+		sleeve, err = s.sleeves.Unpause(name)
+	case "stop":
+		sleeve, err = s.sleeves.Stop(name)
+	case "start":
+		sleeve, err = s.sleeves.Start(name)
+	case "hibernate":
+		// Committing a large container filesystem can take minutes.
+		http.NewResponseController(w).SetWriteDeadline(time.Now().Add(10 * time.Minute))
+		sleeve, err = s.sleeves.Hibernate(name)
+	case "wake":
+		sleeve, err = s.sleeves.Wake(name)
+	}
+	s.audit(r, "sleeve."+action, name, nil, err)
+	if err != nil {
+		errMsg := err.Error()
+		if strings.Contains(errMsg, "not found") {
+			http.Error(w, errMsg, http.StatusNotFound)
+		} else if strings.Contains(errMsg, ", not ") || strings.Contains(errMsg, "does not exist") {
+			http.Error(w, errMsg, http.StatusConflict)
+		} else {
+			http.Error(w, errMsg, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sleeve)
+}
+
+func (s *Server) handleTemplates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	templates, err := s.sleeves.Templates()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(templates)
+}
+
+// handleConfig returns the effective configuration, after the config file
+// and environment overrides, with credentials redacted.
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	doc, err := s.cfg.Load().Redacted().Document()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
+
+func (s *Server) handleConfigReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	result, err := s.reload()
+	var details map[string]string
+	if result != nil {
+		details = map[string]string{
+			"applied":          strings.Join(result.Applied, ","),
+			"restart_required": strings.Join(result.RestartRequired, ","),
+		}
+	}
+	s.audit(r, "config.reload", s.configPath, details, err)
+	if err != nil {
+		// The current config stays in place; the error describes the new one.
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func (s *Server) handleReconcilePlan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	plan, err := s.reconciler.Plan()
+	if err != nil {
+		writeReconcileError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plan)
+}
+
+func (s *Server) handleReconcile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	plan, err := s.reconciler.Apply()
+	s.audit(r, "reconcile", s.cfg.Load().Fleet.Path, nil, err)
+	if err != nil {
+		writeReconcileError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plan)
+}
+
+func writeReconcileError(w http.ResponseWriter, err error) {
+	errMsg := err.Error()
+	if strings.Contains(errMsg, "not found") {
+		http.Error(w, errMsg, http.StatusNotFound)
+	} else if strings.HasPrefix(errMsg, "fleet file") {
+		http.Error(w, errMsg, http.StatusUnprocessableEntity)
+	} else {
+		http.Error(w, errMsg, http.StatusInternalServerError)
+	}
+}
+
+// handleMirrors reports mirror status; POST starts a run in the background.
+func (s *Server) handleMirrors(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		err := s.mirrors.Trigger()
+		s.audit(r, "mirror.trigger", s.cfg.Load().Mirror.GitHubOrg, nil, err)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.mirrors.Status())
+}
+
+func (s *Server) handleSecrets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	secrets := s.secrets.List()
+	for i := range secrets {
+		secrets[i].Sleeves = s.sleeves.SecretUsers(secrets[i].Name)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(secrets)
+}
+
+func (s *Server) handleSecretByName(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/api/secrets/")
+	if name == "" {
+		http.Error(w, "secret name required", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		info, err := s.secrets.Get(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		info.Sleeves = s.sleeves.SecretUsers(name)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(info)
+
+	case http.MethodPut:
+		var req protocol.PutSecretRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		info, err := s.secrets.Put(name, req)
+		if err != nil {
+			s.audit(r, "secret.put", name, nil, err)
+			if strings.HasPrefix(err.Error(), "invalid") {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			} else {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		// Rotation reaches running sleeves through docker exec, which can
+		// take a while with many sleeves.
+		http.NewResponseController(w).SetWriteDeadline(time.Now().Add(5 * time.Minute))
+		rotation := protocol.SecretRotation{Secret: *info}
+		rotation.Updated, rotation.Stale, rotation.Errors = s.sleeves.RotateSecret(name)
+		rotation.Secret.Sleeves = s.sleeves.SecretUsers(name)
+		s.audit(r, "secret.put", name, map[string]string{
+			"version": strconv.Itoa(info.Version),
+			"updated": strings.Join(rotation.Updated, ","),
+			"stale":   strings.Join(rotation.Stale, ","),
+			"failed":  strconv.Itoa(len(rotation.Errors)),
+		}, nil)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rotation)
+
+	case http.MethodDelete:
+		var err error
+		if users := s.sleeves.SecretUsers(name); len(users) > 0 {
+			err = errors.New("secret in use by sleeves " + strings.Join(users, ", "))
+		} else {
+			err = s.secrets.Delete(name)
+		}
+		s.audit(r, "secret.delete", name, nil, err)
+		if err != nil {
+			errMsg := err.Error()
+			if strings.Contains(errMsg, "not found") {
+				http.Error(w, errMsg, http.StatusNotFound)
+			} else if strings.Contains(errMsg, "in use") {
+				http.Error(w, errMsg, http.StatusConflict)
+			} else {
+				http.Error(w, errMsg, http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handlePool(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.pool.Status())
+}
+
+func (s *Server) handleSleeveLoop(w http.ResponseWriter, r *http.Request, name, action string) {
+	if action == "" && r.Method == http.MethodGet {
+		status, err := s.loops.Get(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var status *protocol.LoopStatus
+	var err error
+	details := map[string]string{}
+
+	switch action {
+	case "", "start":
+		var req protocol.StartLoopRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		details["prompt_file"] = req.PromptFile
+		details["max_iterations"] = strconv.Itoa(req.MaxIterations)
+		status, err = s.loops.Start(name, req)
+		action = "start"
+	case "pause":
+		status, err = s.loops.Pause(name)
+	case "resume":
+		status, err = s.loops.Resume(name)
+	case "kill":
+		status, err = s.loops.Kill(name)
+	default:
+		http.Error(w, "invalid action: must be 'start', 'pause', 'resume', or 'kill'", http.StatusBadRequest)
+		return
+	}
+
+	s.audit(r, "loop."+action, name, details, err)
+	if err != nil {
+		errMsg := err.Error()
+		if strings.Contains(errMsg, "not found") || strings.Contains(errMsg, "no loop") {
+			http.Error(w, errMsg, http.StatusNotFound)
+		} else if strings.Contains(errMsg, "invalid") || strings.Contains(errMsg, "required") || strings.Contains(errMsg, "must be") {
+			http.Error(w, errMsg, http.StatusBadRequest)
+		} else {
+			http.Error(w, errMsg, http.StatusConflict)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if action == "start" {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+func (s *Server) handleSleeveInput(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req protocol.SleeveInputRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err := s.sleeves.SendInput(name, req)
+	details := map[string]string{
+		"chars": strconv.Itoa(len(req.Text)),
+		"keys":  strings.Join(req.Keys, " "),
+	}
+	s.audit(r, "sleeve.input", name, details, err)
+	if err != nil {
+		errMsg := err.Error()
+		if strings.Contains(errMsg, "not found") {
+			http.Error(w, errMsg, http.StatusNotFound)
+		} else if strings.Contains(errMsg, "required") || strings.Contains(errMsg, "invalid") {
+			http.Error(w, errMsg, http.StatusBadRequest)
+		} else {
+			http.Error(w, errMsg, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleSleeveScreen(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	history := 0
+	if v := r.URL.Query().Get("history"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid history", http.StatusBadRequest)
+			return
+		}
+		history = n
+	}
+	escapes := r.URL.Query().Get("escapes") == "true"
+
+	screen, err := s.sleeves.CaptureScreen(name, history, escapes)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if r.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(screen.Content))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(screen)
+}
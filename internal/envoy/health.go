@@ -0,0 +1,210 @@
+package envoy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hotschmoe/protectorate/internal/protocol"
+)
+
+const (
+	healthCheckTimeout = 5 * time.Second
+
+	// credentialsPath is where compose mounts the Claude credentials into envoy.
+	credentialsPath = "/home/claude/.claude/.credentials.json"
+)
+
+type healthCheck struct {
+	name     string
+	critical bool
+	run      func(ctx context.Context) (status, message string)
+}
+
+// handleHealthLive reports whether the envoy process is serving requests.
+// It deliberately checks no dependencies so orchestrators don't restart envoy
+// because Docker or Gitea is down.
+func (s *Server) handleHealthLive(w http.ResponseWriter, r *http.Request) {
+	writeHealthReport(w, &protocol.HealthReport{
+		Status:    "ok",
+		CheckedAt: time.Now(),
+	})
+}
+
+// handleHealthReady checks every dependency envoy needs to spawn and serve sleeves.
+// Returns 503 if any critical component fails.
+func (s *Server) handleHealthReady(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+
+	writeHealthReport(w, s.checkReadiness(ctx))
+}
+
+func writeHealthReport(w http.ResponseWriter, report *protocol.HealthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status == "fail" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+func (s *Server) checkReadiness(ctx context.Context) *protocol.HealthReport {
+	checks := []healthCheck{
+		{name: "docker", critical: true, run: s.checkDocker},
+		{name: "network", critical: true, run: s.checkNetwork},
+		{name: "workspace_root", critical: true, run: s.checkWorkspaceRoot},
+		{name: "host_paths", critical: true, run: s.checkHostPaths},
+		{name: "credentials", run: s.checkCredentials},
+	}
+
+	if s.giteaConfigured() {
+		checks = append(checks, healthCheck{name: "gitea", run: s.checkGitea})
+	}
+
+	for _, sl := range s.sleeves.List() {
+		if sl.Status != "running" || sl.TTYDAddress == "" {
+			continue
+		}
+		addr := sl.TTYDAddress
+		checks = append(checks, healthCheck{
+			name: "sleeve:" + sl.Name,
+			run: func(ctx context.Context) (string, string) {
+				return checkTCP(ctx, addr)
+			},
+		})
+	}
+
+	results := make([]protocol.ComponentHealth, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c healthCheck) {
+			defer wg.Done()
+			start := time.Now()
+			status, msg := c.run(ctx)
+			results[i] = protocol.ComponentHealth{
+				Name:      c.name,
+				Status:    status,
+				Critical:  c.critical,
+				Message:   msg,
+				LatencyMS: time.Since(start).Milliseconds(),
+			}
+		}(i, c)
+	}
+	wg.Wait()
+
+	overall := "ok"
+	for _, res := range results {
+		if res.Status == "ok" {
+			continue
+		}
+		if res.Critical && res.Status == "fail" {
+			overall = "fail"
+			break
+		}
+		overall = "degraded"
+	}
+
+	return &protocol.HealthReport{
+		Status:     overall,
+		Components: results,
+		CheckedAt:  time.Now(),
+	}
+}
+
+func (s *Server) checkDocker(ctx context.Context) (string, string) {
+	if err := s.docker.Ping(ctx); err != nil {
+		return "fail", err.Error()
+	}
+	return "ok", ""
+}
+
+func (s *Server) checkNetwork(ctx context.Context) (string, string) {
+	name := s.cfg.Load().Docker.Network
+	exists, err := s.docker.NetworkExists(ctx, name)
+	if err != nil {
+		return "fail", err.Error()
+	}
+	if !exists {
+		return "fail", fmt.Sprintf("network %q not found", name)
+	}
+	return "ok", ""
+}
+
+func (s *Server) checkWorkspaceRoot(ctx context.Context) (string, string) {
+	root := s.cfg.Load().Docker.WorkspaceRoot
+	f, err := os.CreateTemp(root, ".envoy-health-*")
+	if err != nil {
+		return "fail", fmt.Sprintf("%s not writable: %v", root, err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return "ok", ""
+}
+
+// checkHostPaths fails when envoy runs in a container but cannot map
+// WORKSPACE_ROOT to a host path, since every spawn would then be refused.
+func (s *Server) checkHostPaths(ctx context.Context) (string, string) {
+	cfg := s.cfg.Load()
+	if !s.sleeves.host.inContainer || cfg.Docker.WorkspaceHostRoot != "" {
+		return "ok", ""
+	}
+	return "fail", fmt.Sprintf("%s is not mounted into envoy and WORKSPACE_HOST_ROOT is not set; spawning is disabled", cfg.Docker.WorkspaceRoot)
+}
+
+func (s *Server) checkCredentials(ctx context.Context) (string, string) {
+	if name := s.cfg.Load().Docker.CredentialsSecret; name != "" {
+		if _, err := s.secrets.Get(name); err != nil {
+			return "degraded", "CREDENTIALS_SECRET " + name + " is not in the secrets store; sleeves will require login"
+		}
+		return "ok", ""
+	}
+	if _, err := os.Stat(credentialsPath); err != nil {
+		return "degraded", "credentials file not found; sleeves will require login"
+	}
+	if s.cfg.Load().Docker.CredentialsHostPath == "" {
+		return "degraded", "CREDENTIALS_HOST_PATH not set; sleeves will not receive credentials"
+	}
+	return "ok", ""
+}
+
+func (s *Server) giteaConfigured() bool {
+	g := s.cfg.Load().Gitea
+	return g.URL != "" && (g.Token != "" || g.User != "")
+}
+
+func (s *Server) checkGitea(ctx context.Context) (string, string) {
+	url := strings.TrimSuffix(s.cfg.Load().Gitea.URL, "/") + "/api/healthz"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "degraded", err.Error()
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "degraded", err.Error()
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "degraded", fmt.Sprintf("gitea returned %s", resp.Status)
+	}
+	return "ok", ""
+}
+
+// checkTCP verifies something is listening at addr.
+func checkTCP(ctx context.Context, addr string) (string, string) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return "degraded", err.Error()
+	}
+	conn.Close()
+	return "ok", ""
+}
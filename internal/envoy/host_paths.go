@@ -0,0 +1,167 @@
+package envoy
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hotschmoe/protectorate/internal/config"
+)
+
+// Paths at which compose mounts the Claude settings and plugins into envoy.
+// Sleeves get them at the same paths.
+const (
+	settingsPath = "/etc/claude/settings.json"
+	pluginsPath  = "/home/claude/.claude/plugins"
+)
+
+// hostPaths translates paths envoy sees into paths on the Docker host.
+// Sleeves are created through the host's Docker daemon, so their bind mount
+// sources must be host paths. When envoy runs in a container those are the
+// sources of envoy's own mounts, found by inspecting its own container.
+type hostPaths struct {
+	inContainer bool
+	mounts      map[string]string // mount destination in envoy -> host source
+
+	// The container envoy runs in, if it could be inspected. Isolated sleeve
+	// networks are connected to it, its image runs the egress proxy, and
+	// sleeves reach envoy's own proxy by its name.
+	containerID string
+	name        string
+	image       string
+}
+
+var containerIDPattern = regexp.MustCompile(`/containers/([0-9a-f]{64})/`)
+
+// detectHostPaths inspects envoy's own container. Outside a container it
+// returns an empty mapping, since envoy's paths are already host paths.
+func detectHostPaths(docker *DockerClient) *hostPaths {
+	hp := &hostPaths{mounts: make(map[string]string)}
+	if _, err := os.Stat("/.dockerenv"); err != nil {
+		return hp
+	}
+	hp.inContainer = true
+
+	for _, id := range selfContainerIDs() {
+		info, err := docker.InspectContainer(id)
+		if err != nil {
+			continue
+		}
+		hp.containerID = info.ID
+		hp.name = strings.TrimPrefix(info.Name, "/")
+		if info.Config != nil {
+			hp.image = info.Config.Image
+		}
+		for _, mp := range info.Mounts {
+			if mp.Source != "" {
+				hp.mounts[filepath.Clean(mp.Destination)] = mp.Source
+			}
+		}
+		return hp
+	}
+
+	log.Printf("host paths: could not inspect envoy's own container; set WORKSPACE_HOST_ROOT")
+	return hp
+}
+
+// selfContainerIDs returns candidate IDs for the container envoy runs in:
+// the full ID from the sources of the hostname and resolv.conf files Docker
+// mounts into every container, then the hostname, which Docker sets to the
+// short ID unless it is overridden.
+func selfContainerIDs() []string {
+	var ids []string
+	if f, err := os.Open("/proc/self/mountinfo"); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if match := containerIDPattern.FindStringSubmatch(scanner.Text()); match != nil {
+				ids = append(ids, match[1])
+				break
+			}
+		}
+		f.Close()
+	}
+
+	if hostname, err := os.Hostname(); err == nil {
+		ids = append(ids, hostname)
+	}
+	return ids
+}
+
+// lookup returns the host path for path, using the mount with the longest
+// destination that contains it.
+func (hp *hostPaths) lookup(path string) (string, bool) {
+	path = filepath.Clean(path)
+
+	dests := make([]string, 0, len(hp.mounts))
+	for dest := range hp.mounts {
+		dests = append(dests, dest)
+	}
+	sort.Slice(dests, func(i, j int) bool { return len(dests[i]) > len(dests[j]) })
+
+	for _, dest := range dests {
+		if rel, ok := pathWithin(dest, path); ok {
+			return filepath.Join(hp.mounts[dest], rel), true
+		}
+	}
+	return "", false
+}
+
+// fill sets the host paths left empty in cfg from envoy's own mounts. Values
+// set explicitly are kept. The workspace root may sit inside a larger mount;
+// the Claude files must be mounted themselves, or sleeves would get an empty
+// path from some unrelated parent mount.
+func (hp *hostPaths) fill(cfg *config.EnvoyConfig) {
+	if cfg.Docker.WorkspaceHostRoot == "" {
+		if source, ok := hp.lookup(cfg.Docker.WorkspaceRoot); ok {
+			cfg.Docker.WorkspaceHostRoot = source
+		}
+	}
+
+	files := []struct {
+		dst  *string
+		path string
+	}{
+		{&cfg.Docker.CredentialsHostPath, credentialsPath},
+		{&cfg.Docker.SettingsHostPath, settingsPath},
+		{&cfg.Docker.PluginsHostPath, pluginsPath},
+	}
+	for _, f := range files {
+		if *f.dst == "" {
+			*f.dst = hp.mounts[f.path]
+		}
+	}
+}
+
+// resolve maps a workspace path to its host path. Inside a container an
+// unmapped path is an error: Docker would silently create an empty host
+// directory at the container path and mount that instead.
+func (hp *hostPaths) resolve(cfg *config.EnvoyConfig, path string) (string, error) {
+	root, hostRoot := cfg.Docker.WorkspaceRoot, cfg.Docker.WorkspaceHostRoot
+	if rel, ok := pathWithin(root, path); ok && hostRoot != "" {
+		return filepath.Join(hostRoot, rel), nil
+	}
+	if !hp.inContainer {
+		return path, nil
+	}
+	if hostRoot == "" {
+		return "", fmt.Errorf("cannot map %s to a host path: WORKSPACE_HOST_ROOT is not set and %s is not mounted into envoy", path, root)
+	}
+	return "", fmt.Errorf("cannot map %s to a host path: not under WORKSPACE_ROOT %s", path, root)
+}
+
+// pathWithin returns path relative to dir if path is dir or inside it.
+func pathWithin(dir, path string) (string, bool) {
+	if dir == "" {
+		return "", false
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", false
+	}
+	return rel, true
+}
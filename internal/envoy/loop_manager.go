@@ -0,0 +1,494 @@
+package envoy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hotschmoe/protectorate/internal/protocol"
+	"github.com/hotschmoe/protectorate/internal/shell"
+)
+
+const (
+	defaultLoopCommand          = "claude -p --dangerously-skip-permissions"
+	defaultLoopMaxIterations    = 10
+	defaultLoopMaxDuration      = 1 * time.Hour
+	defaultLoopIterationTimeout = 30 * time.Minute
+
+	// loopFailureLimit pauses a loop after this many consecutive failed
+	// iterations so a human can look before it burns more budget.
+	loopFailureLimit = 3
+
+	// loopOutputLimit caps the CLI output kept per iteration.
+	loopOutputLimit = 4096
+
+	// loopRetention is how long finished loops are kept in memory.
+	loopRetention = 24 * time.Hour
+
+	// sleeveWorkspace is where the workspace is mounted inside a sleeve.
+	sleeveWorkspace = "/home/claude/workspace"
+)
+
+// LoopManager runs supervised agent loops: the same prompt file is fed to a
+// sleeve's CLI over and over, with each iteration's git outcome recorded and
+// guardrails (iterations, wall clock, checkpoints) enforced by envoy.
+type LoopManager struct {
+	mu      sync.Mutex
+	docker  *DockerClient
+	sleeves *SleeveManager
+	loops   map[string]*agentLoop
+}
+
+type agentLoop struct {
+	mu     sync.Mutex
+	status protocol.LoopStatus
+
+	// name, command and promptFile are copied from status at Start and never
+	// change, so they can be read without holding mu.
+	name       string
+	command    string
+	promptFile string
+
+	workspace string
+	timeout   time.Duration
+	ctx       context.Context
+	cancel    context.CancelFunc
+	resume    chan struct{}
+	pause     bool
+
+	// lastCheckpoint is the iteration count at which the most recent
+	// checkpoint was cleared. Only touched by the run goroutine.
+	lastCheckpoint int
+}
+
+func NewLoopManager(docker *DockerClient, sleeves *SleeveManager) *LoopManager {
+	return &LoopManager{
+		docker:  docker,
+		sleeves: sleeves,
+		loops:   make(map[string]*agentLoop),
+	}
+}
+
+func (lm *LoopManager) Start(name string, req protocol.StartLoopRequest) (*protocol.LoopStatus, error) {
+	sleeve, err := lm.sleeves.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if sleeve.Status != "running" {
+		return nil, fmt.Errorf("sleeve %q is not running", name)
+	}
+
+	promptFile, err := resolveWorkspaceFile(sleeve.Workspace, req.PromptFile)
+	if err != nil {
+		return nil, err
+	}
+
+	maxDuration, err := parseDurationDefault(req.MaxDuration, defaultLoopMaxDuration)
+	if err != nil {
+		return nil, fmt.Errorf("invalid max_duration: %w", err)
+	}
+	timeout, err := parseDurationDefault(req.IterationTimeout, defaultLoopIterationTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid iteration_timeout: %w", err)
+	}
+
+	maxIterations := req.MaxIterations
+	if maxIterations <= 0 {
+		maxIterations = defaultLoopMaxIterations
+	}
+	command := req.Command
+	if command == "" {
+		command = defaultLoopCommand
+	}
+
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.cleanupFinished()
+
+	if existing, ok := lm.loops[name]; ok && !existing.finished() {
+		return nil, fmt.Errorf("sleeve %q already has an active loop", name)
+	}
+
+	now := time.Now()
+	ctx, cancel := context.WithDeadline(context.Background(), now.Add(maxDuration))
+	loop := &agentLoop{
+		status: protocol.LoopStatus{
+			Sleeve:          name,
+			PromptFile:      promptFile,
+			Command:         command,
+			State:           "running",
+			MaxIterations:   maxIterations,
+			CheckpointEvery: req.CheckpointEvery,
+			StartedAt:       now,
+			Deadline:        now.Add(maxDuration),
+			Iterations:      []protocol.LoopIteration{},
+		},
+		name:       name,
+		command:    command,
+		promptFile: promptFile,
+		workspace:  sleeve.Workspace,
+		timeout:    timeout,
+		ctx:        ctx,
+		cancel:     cancel,
+		resume:     make(chan struct{}, 1),
+	}
+	lm.loops[name] = loop
+
+	go lm.run(loop)
+
+	status := loop.snapshot()
+	return &status, nil
+}
+
+func (lm *LoopManager) Get(name string) (*protocol.LoopStatus, error) {
+	loop, err := lm.get(name)
+	if err != nil {
+		return nil, err
+	}
+	status := loop.snapshot()
+	return &status, nil
+}
+
+func (lm *LoopManager) List() []protocol.LoopStatus {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.cleanupFinished()
+
+	result := make([]protocol.LoopStatus, 0, len(lm.loops))
+	for _, loop := range lm.loops {
+		result = append(result, loop.snapshot())
+	}
+	return result
+}
+
+// Pause stops the loop after the current iteration finishes.
+func (lm *LoopManager) Pause(name string) (*protocol.LoopStatus, error) {
+	loop, err := lm.get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	loop.mu.Lock()
+	if loop.status.State != "running" {
+		state := loop.status.State
+		loop.mu.Unlock()
+		return nil, fmt.Errorf("loop is %s", state)
+	}
+	loop.pause = true
+	loop.mu.Unlock()
+
+	status := loop.snapshot()
+	return &status, nil
+}
+
+// Resume continues a paused loop or one waiting at a checkpoint.
+func (lm *LoopManager) Resume(name string) (*protocol.LoopStatus, error) {
+	loop, err := lm.get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	loop.mu.Lock()
+	switch {
+	case loop.status.State == "running" && loop.pause:
+		loop.pause = false
+	case loop.status.State == "paused" || loop.status.State == "checkpoint":
+		select {
+		case loop.resume <- struct{}{}:
+		default:
+		}
+	default:
+		state := loop.status.State
+		loop.mu.Unlock()
+		return nil, fmt.Errorf("loop is %s", state)
+	}
+	loop.mu.Unlock()
+
+	status := loop.snapshot()
+	return &status, nil
+}
+
+// Kill is the kill switch: it aborts the running iteration inside the sleeve
+// and ends the loop immediately.
+func (lm *LoopManager) Kill(name string) (*protocol.LoopStatus, error) {
+	loop, err := lm.get(name)
+	if err != nil {
+		return nil, err
+	}
+	if loop.finished() {
+		return nil, fmt.Errorf("loop is already %s", loop.snapshot().State)
+	}
+
+	loop.finish("killed", "killed by user")
+	loop.cancel()
+	lm.interruptCLI(name, loop.command)
+
+	status := loop.snapshot()
+	return &status, nil
+}
+
+func (lm *LoopManager) get(name string) (*agentLoop, error) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.cleanupFinished()
+
+	loop, ok := lm.loops[name]
+	if !ok {
+		return nil, fmt.Errorf("no loop for sleeve %q", name)
+	}
+	return loop, nil
+}
+
+// cleanupFinished forgets loops that finished more than loopRetention ago.
+// The caller must hold lm.mu.
+func (lm *LoopManager) cleanupFinished() {
+	cutoff := time.Now().Add(-loopRetention)
+	for name, loop := range lm.loops {
+		status := loop.snapshot()
+		if isLoopFinished(status.State) && status.EndedAt.Before(cutoff) {
+			delete(lm.loops, name)
+		}
+	}
+}
+
+func (lm *LoopManager) run(loop *agentLoop) {
+	defer loop.cancel()
+
+	name := loop.name
+	failures := 0
+
+	for {
+		if loop.finished() {
+			return
+		}
+
+		loop.mu.Lock()
+		iteration := loop.status.Iteration
+		pause := loop.pause
+		every := loop.status.CheckpointEvery
+		maxIterations := loop.status.MaxIterations
+		loop.mu.Unlock()
+
+		if iteration >= maxIterations {
+			loop.finish("completed", "max iterations reached")
+			return
+		}
+		if loop.ctx.Err() != nil {
+			loop.finish("completed", "time limit reached")
+			return
+		}
+
+		switch {
+		case pause:
+			if !lm.wait(loop, "paused", "paused by user") {
+				return
+			}
+		case failures >= loopFailureLimit:
+			failures = 0
+			if !lm.wait(loop, "paused", fmt.Sprintf("%d consecutive failed iterations", loopFailureLimit)) {
+				return
+			}
+		case every > 0 && iteration > 0 && iteration%every == 0 && loop.lastCheckpoint != iteration:
+			if !lm.wait(loop, "checkpoint", fmt.Sprintf("checkpoint after %d iterations", iteration)) {
+				return
+			}
+			loop.lastCheckpoint = iteration
+		}
+
+		if loop.finished() {
+			return
+		}
+
+		result := lm.runIteration(loop, iteration+1)
+		loop.record(result)
+
+		if loop.ctx.Err() == context.DeadlineExceeded {
+			loop.finish("completed", "time limit reached")
+			return
+		}
+		if loop.finished() {
+			return
+		}
+
+		if result.Error != "" || result.ExitCode != 0 {
+			failures++
+			log.Printf("loop %s: iteration %d failed (exit %d): %s", name, result.N, result.ExitCode, result.Error)
+		} else {
+			failures = 0
+		}
+	}
+}
+
+// wait parks the loop in state until resumed. Returns false if the loop was
+// killed or hit its deadline while waiting.
+func (lm *LoopManager) wait(loop *agentLoop, state, reason string) bool {
+	loop.mu.Lock()
+	loop.status.State = state
+	loop.status.Reason = reason
+	loop.pause = false
+	loop.mu.Unlock()
+
+	select {
+	case <-loop.resume:
+		loop.mu.Lock()
+		if loop.status.State == state {
+			loop.status.State = "running"
+			loop.status.Reason = ""
+		}
+		loop.mu.Unlock()
+		return !loop.finished()
+	case <-loop.ctx.Done():
+		if loop.ctx.Err() == context.DeadlineExceeded {
+			loop.finish("completed", "time limit reached")
+		}
+		return false
+	}
+}
+
+func (lm *LoopManager) runIteration(loop *agentLoop, n int) protocol.LoopIteration {
+	it := protocol.LoopIteration{
+		N:          n,
+		StartedAt:  time.Now(),
+		HeadBefore: gitHead(loop.workspace),
+		Commits:    []string{},
+	}
+
+	sleeve, err := lm.sleeves.Get(loop.name)
+	if err != nil {
+		it.Error = err.Error()
+		it.EndedAt = time.Now()
+		return it
+	}
+
+	ctx, cancel := context.WithTimeout(loop.ctx, loop.timeout)
+	defer cancel()
+
+	script := fmt.Sprintf("%s < %s", loop.command, shell.Quote(loop.promptFile))
+	res, err := lm.docker.Exec(ctx, sleeve.ContainerID, ExecOptions{
+		User:       sleeveUser,
+		WorkingDir: sleeveWorkspace,
+		Cmd:        []string{"bash", "-lc", script},
+	})
+	if err != nil {
+		it.Error = err.Error()
+		it.ExitCode = -1
+		lm.interruptCLI(sleeve.Name, loop.command)
+	} else {
+		it.ExitCode = res.ExitCode
+		it.Output = truncateOutput(res.Stdout+res.Stderr, loopOutputLimit)
+	}
+
+	it.EndedAt = time.Now()
+	it.HeadAfter = gitHead(loop.workspace)
+	if it.HeadBefore != "" && it.HeadAfter != "" && it.HeadBefore != it.HeadAfter {
+		if out, err := runGitCommand(loop.workspace, "log", "--format=%h %s", it.HeadBefore+".."+it.HeadAfter); err == nil && out != "" {
+			it.Commits = strings.Split(out, "\n")
+		}
+		it.DiffStat, _ = runGitCommand(loop.workspace, "diff", "--shortstat", it.HeadBefore, it.HeadAfter)
+	}
+	it.Dirty = getGitUncommittedCount(loop.workspace)
+
+	return it
+}
+
+// interruptCLI kills a loop iteration still running inside the sleeve after
+// its exec stream has been abandoned. pkill matches a regular expression, so
+// the command is escaped to match only itself.
+func (lm *LoopManager) interruptCLI(name, command string) {
+	sleeve, err := lm.sleeves.Get(name)
+	if err != nil {
+		return
+	}
+	lm.docker.ExecCommand(sleeve.ContainerID, "root", []string{"pkill", "-u", sleeveUser, "-f", "--", regexp.QuoteMeta(command)})
+}
+
+func (l *agentLoop) snapshot() protocol.LoopStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	status := l.status
+	status.Iterations = append([]protocol.LoopIteration(nil), l.status.Iterations...)
+	return status
+}
+
+func (l *agentLoop) record(it protocol.LoopIteration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.status.Iterations = append(l.status.Iterations, it)
+	l.status.Iteration = it.N
+}
+
+func (l *agentLoop) finish(state, reason string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if isLoopFinished(l.status.State) {
+		return
+	}
+	l.status.State = state
+	l.status.Reason = reason
+	l.status.EndedAt = time.Now()
+}
+
+func (l *agentLoop) finished() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return isLoopFinished(l.status.State)
+}
+
+func isLoopFinished(state string) bool {
+	return state == "completed" || state == "killed" || state == "failed"
+}
+
+// resolveWorkspaceFile checks that rel exists inside the workspace and returns
+// its path as seen from inside the sleeve.
+func resolveWorkspaceFile(workspace, rel string) (string, error) {
+	if rel == "" {
+		return "", fmt.Errorf("prompt_file required")
+	}
+
+	clean := filepath.Clean(rel)
+	if filepath.IsAbs(clean) || strings.HasPrefix(clean, "..") {
+		return "", fmt.Errorf("prompt_file must be relative to the workspace")
+	}
+
+	if _, err := os.Stat(filepath.Join(workspace, clean)); err != nil {
+		return "", fmt.Errorf("prompt_file %q not found in workspace", rel)
+	}
+
+	return filepath.Join(sleeveWorkspace, clean), nil
+}
+
+func parseDurationDefault(s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("must be positive")
+	}
+	return d, nil
+}
+
+func gitHead(wsPath string) string {
+	head, err := runGitCommand(wsPath, "rev-parse", "HEAD")
+	if err != nil {
+		return ""
+	}
+	return head
+}
+
+func truncateOutput(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	return "..." + s[len(s)-limit:]
+}
@@ -0,0 +1,122 @@
+package envoy
+
+import (
+	"time"
+
+	"github.com/hotschmoe/protectorate/internal/protocol"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	sleeveSpawnDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "envoy_sleeve_spawn_duration_seconds",
+		Help:    "Time taken to spawn a sleeve container.",
+		Buckets: []float64{0.25, 0.5, 1, 2, 5, 10, 30, 60},
+	}, []string{"outcome"})
+
+	sleeveKillDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "envoy_sleeve_kill_duration_seconds",
+		Help:    "Time taken to stop and remove a sleeve container.",
+		Buckets: []float64{0.25, 0.5, 1, 2, 5, 10, 30},
+	}, []string{"outcome"})
+
+	cloneDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "envoy_clone_duration_seconds",
+		Help:    "Duration of workspace clone jobs.",
+		Buckets: []float64{1, 5, 15, 30, 60, 120, 300, 600},
+	}, []string{"outcome"})
+
+	cloneFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "envoy_clone_failures_total",
+		Help: "Number of workspace clone jobs that failed.",
+	})
+
+	terminalConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "envoy_terminal_connections",
+		Help: "Active terminal WebSocket proxy connections.",
+	})
+
+	terminalBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "envoy_terminal_bytes_total",
+		Help: "Bytes relayed by the terminal WebSocket proxy.",
+	}, []string{"direction"})
+
+	dockerErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "envoy_docker_errors_total",
+		Help: "Docker API calls that returned an error.",
+	}, []string{"operation"})
+
+	mirrorPushes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "envoy_mirror_pushes_total",
+		Help: "Repository pushes to the GitHub mirror.",
+	}, []string{"outcome"})
+
+	proxyRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "envoy_proxy_requests_total",
+		Help: "Requests through the sleeve forward proxy, by whether policy allowed them.",
+	}, []string{"verdict"})
+
+	proxyBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "envoy_proxy_bytes_total",
+		Help: "Bytes relayed by the sleeve forward proxy.",
+	}, []string{"direction"})
+
+	gitCommandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "envoy_git_command_duration_seconds",
+		Help:    "Duration of git commands run against workspaces.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"command", "outcome"})
+)
+
+// outcomeLabel maps an error to the "outcome" label value.
+func outcomeLabel(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+// observeSince records the time elapsed since start on a histogram keyed by outcome.
+func observeSince(h *prometheus.HistogramVec, start time.Time, err error) {
+	h.WithLabelValues(outcomeLabel(err)).Observe(time.Since(start).Seconds())
+}
+
+// dockerErr counts a failed Docker API call and passes err through.
+func dockerErr(op string, err error) error {
+	if err != nil {
+		dockerErrors.WithLabelValues(op).Inc()
+	}
+	return err
+}
+
+// sleeveCollector reports sleeve counts by status at scrape time.
+type sleeveCollector struct {
+	list func() []*protocol.SleeveInfo
+	desc *prometheus.Desc
+}
+
+func newSleeveCollector(list func() []*protocol.SleeveInfo) *sleeveCollector {
+	return &sleeveCollector{
+		list: list,
+		desc: prometheus.NewDesc(
+			"envoy_sleeves",
+			"Number of sleeves known to envoy, by status.",
+			[]string{"status"}, nil,
+		),
+	}
+}
+
+func (c *sleeveCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *sleeveCollector) Collect(ch chan<- prometheus.Metric) {
+	counts := make(map[string]int)
+	for _, s := range c.list() {
+		counts[s.Status]++
+	}
+	for status, n := range counts {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(n), status)
+	}
+}
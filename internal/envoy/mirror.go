@@ -0,0 +1,456 @@
+package envoy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hotschmoe/protectorate/internal/config"
+	"github.com/hotschmoe/protectorate/internal/protocol"
+)
+
+const (
+	githubURL    = "https://github.com"
+	githubAPIURL = "https://api.github.com"
+)
+
+// Mirrorer pushes workspaces and Gitea repositories to a GitHub org on a
+// schedule, so nothing is lost with the host. Pushes never force or delete:
+// history rewritten locally fails to mirror and shows up as an error rather
+// than overwriting the copy on GitHub.
+type Mirrorer struct {
+	cfg        config.MirrorConfig
+	interval   time.Duration
+	cacheDir   string // bare copies of Gitea repositories and workspaces
+	statePath  string
+	workspaces *WorkspaceManager
+	auditLog   *AuditLog
+	client     *http.Client
+
+	runMu sync.Mutex // serializes runs
+
+	mu      sync.Mutex // guards the fields below
+	running bool
+	lastRun time.Time
+	nextRun time.Time
+	status  map[string]*protocol.MirrorStatus
+	created map[string]bool // GitHub repos known to exist
+
+	wake chan struct{}
+	stop chan struct{}
+}
+
+// mirrorSource is a repository to mirror and the local git directory it is
+// pushed from: a bare copy in the cache, never the workspace itself.
+type mirrorSource struct {
+	repo      string // status key: workspace name or Gitea owner/name
+	kind      string // workspace or gitea
+	name      string // repository name in the GitHub org
+	gitDir    string
+	workspace string // workspace the copy is fetched from, for kind workspace
+}
+
+// mirrorState is persisted so the schedule and each repository's last
+// result survive an envoy restart.
+type mirrorState struct {
+	LastRun time.Time               `json:"last_run"`
+	Repos   []protocol.MirrorStatus `json:"repos"`
+}
+
+func NewMirrorer(cfg *config.EnvoyConfig, workspaces *WorkspaceManager, auditLog *AuditLog) *Mirrorer {
+	// Validation guarantees a valid frequency whenever mirroring is enabled.
+	interval, _ := cfg.Mirror.Interval()
+
+	m := &Mirrorer{
+		cfg:        cfg.Mirror,
+		interval:   interval,
+		cacheDir:   filepath.Join(cfg.DataDir, "mirrors"),
+		statePath:  filepath.Join(cfg.DataDir, "mirror_state.json"),
+		workspaces: workspaces,
+		auditLog:   auditLog,
+		client:     &http.Client{Timeout: 30 * time.Second},
+		status:     make(map[string]*protocol.MirrorStatus),
+		created:    make(map[string]bool),
+		wake:       make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+	}
+
+	var state mirrorState
+	if data, err := os.ReadFile(m.statePath); err == nil && json.Unmarshal(data, &state) == nil {
+		m.lastRun = state.LastRun
+		for i := range state.Repos {
+			m.status[state.Repos[i].Repo] = &state.Repos[i]
+		}
+	}
+
+	return m
+}
+
+// Run mirrors every interval, counted from the last run so a restart does
+// not reset the schedule. A run that is overdue starts immediately.
+func (m *Mirrorer) Run() {
+	if !m.cfg.Enabled {
+		return
+	}
+
+	for {
+		next := m.lastRunTime().Add(m.interval)
+		m.mu.Lock()
+		m.nextRun = next
+		m.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-m.wake:
+			timer.Stop()
+		case <-m.stop:
+			timer.Stop()
+			return
+		}
+		m.mirrorAll()
+	}
+}
+
+func (m *Mirrorer) Stop() {
+	close(m.stop)
+}
+
+// Trigger starts a run now, unless one is already running or queued.
+func (m *Mirrorer) Trigger() error {
+	if !m.cfg.Enabled {
+		return fmt.Errorf("mirroring is disabled: set MIRROR_ENABLED")
+	}
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Status reports the schedule and the last result for each repository.
+func (m *Mirrorer) Status() *protocol.MirrorReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	report := &protocol.MirrorReport{
+		Enabled:   m.cfg.Enabled,
+		Frequency: m.cfg.Frequency,
+		Running:   m.running,
+		LastRun:   m.lastRun,
+		Repos:     m.statusList(),
+	}
+	if m.cfg.Enabled {
+		report.Target = m.orgURL()
+		report.NextRun = m.nextRun
+	}
+	return report
+}
+
+func (m *Mirrorer) lastRunTime() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lastRun
+}
+
+// statusList returns the per-repository status sorted by repo. Callers hold mu.
+func (m *Mirrorer) statusList() []protocol.MirrorStatus {
+	list := make([]protocol.MirrorStatus, 0, len(m.status))
+	for _, st := range m.status {
+		list = append(list, *st)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Repo < list[j].Repo })
+	return list
+}
+
+func (m *Mirrorer) mirrorAll() {
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+
+	m.mu.Lock()
+	m.running = true
+	m.mu.Unlock()
+
+	sources, err := m.sources()
+	if err != nil {
+		log.Printf("mirror: %v", err)
+	}
+	var failed []string
+	for _, src := range sources {
+		pushErr := m.mirror(src)
+		mirrorPushes.WithLabelValues(outcomeLabel(pushErr)).Inc()
+		m.record(src, pushErr)
+		if pushErr != nil {
+			log.Printf("mirror %s: %v", src.repo, pushErr)
+			failed = append(failed, src.repo)
+		}
+	}
+	if err == nil && len(failed) > 0 {
+		err = fmt.Errorf("failed to mirror %s", strings.Join(failed, ", "))
+	}
+
+	m.mu.Lock()
+	m.running = false
+	m.lastRun = time.Now()
+	m.mu.Unlock()
+
+	if saveErr := m.saveState(); saveErr != nil {
+		log.Printf("mirror: failed to save state: %v", saveErr)
+	}
+
+	m.auditLog.Record(protocol.AuditEntry{
+		Actor:  "envoy",
+		Action: "mirror.run",
+		Target: m.orgURL(),
+		Details: map[string]string{
+			"repos":  fmt.Sprintf("%d", len(sources)),
+			"failed": fmt.Sprintf("%d", len(failed)),
+		},
+		Outcome: outcomeLabel(err),
+		Error:   errString(err),
+	})
+}
+
+// sources resolves MIRROR_REPOS. Entries of the form owner/name are Gitea
+// repositories; other entries are workspaces. With no entries, every
+// workspace that is a git repository is mirrored. Entries that would push to
+// the same GitHub repository are left out and reported in the error.
+func (m *Mirrorer) sources() ([]mirrorSource, error) {
+	wsRoot := m.workspaces.cfg.Load().Docker.WorkspaceRoot
+
+	if len(m.cfg.Repos) == 0 {
+		workspaces, err := m.workspaces.List()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list workspaces: %w", err)
+		}
+		var sources []mirrorSource
+		for _, ws := range workspaces {
+			if ws.Git != nil {
+				sources = append(sources, m.workspaceSource(ws.Name, ws.Path))
+			}
+		}
+		return dropCollisions(sources)
+	}
+
+	sources := make([]mirrorSource, 0, len(m.cfg.Repos))
+	for _, repo := range m.cfg.Repos {
+		if owner, name, ok := strings.Cut(repo, "/"); ok {
+			sources = append(sources, mirrorSource{
+				repo:   repo,
+				kind:   "gitea",
+				name:   name,
+				gitDir: filepath.Join(m.cacheDir, owner, name+".git"),
+			})
+			continue
+		}
+		sources = append(sources, m.workspaceSource(repo, filepath.Join(wsRoot, repo)))
+	}
+	return dropCollisions(sources)
+}
+
+// workspaceSource mirrors the workspace called name at path from a bare copy
+// under cacheDir/.workspaces; Gitea owners cannot start with a dot, so it
+// cannot clash with a Gitea repository's copy.
+func (m *Mirrorer) workspaceSource(name, path string) mirrorSource {
+	return mirrorSource{
+		repo:      name,
+		kind:      "workspace",
+		name:      name,
+		gitDir:    filepath.Join(m.cacheDir, ".workspaces", name+".git"),
+		workspace: path,
+	}
+}
+
+// dropCollisions removes sources that share a GitHub repository name, which
+// GitHub compares case-insensitively, since mirroring both would mix their
+// histories in one repository.
+func dropCollisions(sources []mirrorSource) ([]mirrorSource, error) {
+	byName := make(map[string][]string)
+	for _, src := range sources {
+		key := strings.ToLower(src.name)
+		byName[key] = append(byName[key], src.repo)
+	}
+
+	var kept []mirrorSource
+	var collisions []string
+	reported := make(map[string]bool)
+	for _, src := range sources {
+		key := strings.ToLower(src.name)
+		repos := byName[key]
+		if len(repos) == 1 {
+			kept = append(kept, src)
+			continue
+		}
+		if !reported[key] {
+			reported[key] = true
+			collisions = append(collisions, fmt.Sprintf("%s (%s)", src.name, strings.Join(repos, ", ")))
+		}
+	}
+	if len(collisions) > 0 {
+		return kept, fmt.Errorf("not mirroring repos that map to the same GitHub repo: %s", strings.Join(collisions, "; "))
+	}
+	return kept, nil
+}
+
+// mirror pushes all branches and tags of src to its repository in the org.
+func (m *Mirrorer) mirror(src mirrorSource) error {
+	if src.kind == "gitea" {
+		if err := m.fetchGitea(src); err != nil {
+			return err
+		}
+	} else {
+		if _, err := os.Stat(filepath.Join(src.workspace, ".git")); err != nil {
+			return fmt.Errorf("workspace %s is not a git repository", src.repo)
+		}
+		if err := syncBareCopy(src.gitDir, src.workspace); err != nil {
+			return err
+		}
+	}
+
+	if err := m.ensureRepo(src.name); err != nil {
+		return err
+	}
+
+	_, err := runGitCommandEnv(src.gitDir, m.gitEnv(), "push", m.targetURL(src.name),
+		"refs/heads/*:refs/heads/*", "refs/tags/*:refs/tags/*")
+	return err
+}
+
+// fetchGitea brings the bare clone of a Gitea repository up to date,
+// cloning it on first use.
+func (m *Mirrorer) fetchGitea(src mirrorSource) error {
+	client := m.workspaces.giteaClient()
+	if !client.Configured() {
+		return fmt.Errorf("cannot mirror Gitea repo %s: gitea not configured", src.repo)
+	}
+	env := client.GitEnv()
+
+	if _, err := os.Stat(src.gitDir); err == nil {
+		_, err := runGitCommandEnv(src.gitDir, env, "fetch", "--prune", "origin")
+		return err
+	}
+
+	parent := filepath.Dir(src.gitDir)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return err
+	}
+	url := strings.TrimSuffix(m.workspaces.cfg.Load().Gitea.URL, "/") + "/" + src.repo + ".git"
+	_, err := runGitCommandEnv(parent, env, "clone", "--mirror", url, src.gitDir)
+	return err
+}
+
+// ensureRepo creates the repository in the GitHub org if it does not exist.
+// Other hosts, such as a file:// stand-in, must already have it.
+func (m *Mirrorer) ensureRepo(name string) error {
+	if !m.isGitHub() || m.cfg.Token == "" {
+		return nil
+	}
+
+	m.mu.Lock()
+	known := m.created[name]
+	m.mu.Unlock()
+	if known {
+		return nil
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"name": name, "private": true})
+	req, err := http.NewRequest(http.MethodPost, githubAPIURL+"/orgs/"+m.cfg.GitHubOrg+"/repos", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+m.cfg.Token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("github request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// 422 means the name is taken, which for an org repo means it exists.
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusUnprocessableEntity {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("failed to create github repo %s/%s: %s: %s", m.cfg.GitHubOrg, name, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	m.mu.Lock()
+	m.created[name] = true
+	m.mu.Unlock()
+	return nil
+}
+
+// gitEnv passes the token to git for the mirror host only, the same way
+// gitea.Client.GitEnv does for Gitea.
+func (m *Mirrorer) gitEnv() []string {
+	env := []string{"GIT_TERMINAL_PROMPT=0"}
+	if m.cfg.Token == "" || strings.HasPrefix(m.cfg.GitHubURL, "file:") {
+		return env
+	}
+	auth := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + m.cfg.Token))
+	return append(env,
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http."+strings.TrimSuffix(m.cfg.GitHubURL, "/")+"/.extraHeader",
+		"GIT_CONFIG_VALUE_0=Authorization: Basic "+auth,
+	)
+}
+
+func (m *Mirrorer) isGitHub() bool {
+	return strings.TrimSuffix(m.cfg.GitHubURL, "/") == githubURL
+}
+
+func (m *Mirrorer) orgURL() string {
+	return strings.TrimSuffix(m.cfg.GitHubURL, "/") + "/" + m.cfg.GitHubOrg
+}
+
+func (m *Mirrorer) targetURL(name string) string {
+	return m.orgURL() + "/" + name + ".git"
+}
+
+func (m *Mirrorer) record(src mirrorSource, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st, ok := m.status[src.repo]
+	if !ok {
+		st = &protocol.MirrorStatus{Repo: src.repo}
+		m.status[src.repo] = st
+	}
+	st.Source = src.kind
+	st.Target = m.targetURL(src.name)
+	st.LastAttempt = time.Now()
+	if err != nil {
+		st.LastFailure = st.LastAttempt
+		st.LastError = err.Error()
+		st.ConsecutiveFailures++
+		return
+	}
+	st.LastSuccess = st.LastAttempt
+	st.LastError = ""
+	st.ConsecutiveFailures = 0
+}
+
+func (m *Mirrorer) saveState() error {
+	m.mu.Lock()
+	state := mirrorState{LastRun: m.lastRun, Repos: m.statusList()}
+	m.mu.Unlock()
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(m.statePath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(m.statePath, data, 0644)
+}
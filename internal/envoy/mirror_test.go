@@ -0,0 +1,160 @@
+package envoy
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hotschmoe/protectorate/internal/config"
+	"github.com/hotschmoe/protectorate/internal/protocol"
+)
+
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// newTestMirrorer returns a Mirrorer that pushes to bare repositories under
+// a file:// stand-in for GitHub, and the workspace root it mirrors from.
+func newTestMirrorer(t *testing.T, repos ...string) (*Mirrorer, string, string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	tmp := t.TempDir()
+	hub := filepath.Join(tmp, "github")
+	cfg := &config.EnvoyConfig{
+		DataDir: filepath.Join(tmp, "data"),
+		Docker:  config.DockerConfig{WorkspaceRoot: filepath.Join(tmp, "workspaces")},
+		Audit:   config.AuditConfig{Path: filepath.Join(tmp, "data", "audit.log")},
+		Mirror: config.MirrorConfig{
+			Enabled:   true,
+			Frequency: "daily",
+			GitHubOrg: "org",
+			GitHubURL: "file://" + hub,
+			Repos:     repos,
+		},
+	}
+
+	auditLog, err := NewAuditLog(cfg.Audit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { auditLog.Close() })
+
+	workspaces := NewWorkspaceManager(NewLiveConfig(cfg), func() []*protocol.SleeveInfo { return nil })
+	return NewMirrorer(cfg, workspaces, auditLog), cfg.Docker.WorkspaceRoot, filepath.Join(hub, "org")
+}
+
+func TestMirrorPushesToBareRepo(t *testing.T) {
+	m, wsRoot, org := newTestMirrorer(t, "app")
+
+	ws := filepath.Join(wsRoot, "app")
+	if err := os.MkdirAll(ws, 0755); err != nil {
+		t.Fatal(err)
+	}
+	git(t, ws, "init", "-q", "-b", "main")
+	git(t, ws, "commit", "-q", "--allow-empty", "-m", "initial")
+	git(t, ws, "tag", "v1")
+	head := git(t, ws, "rev-parse", "HEAD")
+
+	// A hook in the workspace must not run, since it would see the token.
+	hook := filepath.Join(ws, ".git", "hooks", "pre-push")
+	if err := os.WriteFile(hook, []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	target := filepath.Join(org, "app.git")
+	git(t, wsRoot, "init", "-q", "--bare", target)
+
+	m.mirrorAll()
+
+	status := m.Status()
+	if len(status.Repos) != 1 || status.Repos[0].LastError != "" {
+		t.Fatalf("unexpected status: %+v", status.Repos)
+	}
+	if got := git(t, target, "rev-parse", "refs/heads/main"); got != head {
+		t.Errorf("main = %s, want %s", got, head)
+	}
+	if got := git(t, target, "rev-parse", "refs/tags/v1^{commit}"); got != head {
+		t.Errorf("v1 = %s, want %s", got, head)
+	}
+}
+
+func TestMirrorSourcesRejectsCollisions(t *testing.T) {
+	m, _, _ := newTestMirrorer(t, "app", "acme/App", "other")
+
+	sources, err := m.sources()
+	if err == nil || !strings.Contains(err.Error(), "acme/App") {
+		t.Errorf("expected collision error naming acme/App, got %v", err)
+	}
+	if len(sources) != 1 || sources[0].repo != "other" {
+		t.Errorf("expected only other to be mirrored, got %+v", sources)
+	}
+}
+
+func TestMirrorIgnoresWorkspaceRemoteConfig(t *testing.T) {
+	m, wsRoot, org := newTestMirrorer(t, "app")
+	hub := filepath.Dir(org)
+	evil := filepath.Join(filepath.Dir(hub), "evil")
+
+	ws := filepath.Join(wsRoot, "app")
+	if err := os.MkdirAll(ws, 0755); err != nil {
+		t.Fatal(err)
+	}
+	git(t, ws, "init", "-q", "-b", "main")
+	git(t, ws, "commit", "-q", "--allow-empty", "-m", "initial")
+
+	// The agent can write the workspace's config; none of it may redirect
+	// a push that carries the token.
+	git(t, ws, "config", "url.file://"+evil+".insteadOf", "file://"+hub)
+	git(t, ws, "config", "url.file://"+evil+".pushInsteadOf", "file://"+hub)
+	git(t, ws, "config", "remote.origin.url", "file://"+hub+"/org/app.git")
+	git(t, ws, "config", "remote.origin.pushurl", "file://"+evil+"/org/app.git")
+
+	target := filepath.Join(org, "app.git")
+	git(t, wsRoot, "init", "-q", "--bare", target)
+	stolen := filepath.Join(evil, "org", "app.git")
+	git(t, wsRoot, "init", "-q", "--bare", stolen)
+
+	m.mirrorAll()
+
+	if refs := git(t, stolen, "for-each-ref"); refs != "" {
+		t.Errorf("push was redirected by the workspace config: %s", refs)
+	}
+	if got, want := git(t, target, "rev-parse", "refs/heads/main"), git(t, ws, "rev-parse", "HEAD"); got != want {
+		t.Errorf("main = %s, want %s", got, want)
+	}
+}
+
+func TestMirrorSourcesRejectsCollisionsByDefault(t *testing.T) {
+	m, wsRoot, _ := newTestMirrorer(t)
+
+	for _, name := range []string{"app", "App", "other"} {
+		ws := filepath.Join(wsRoot, name)
+		if err := os.MkdirAll(ws, 0755); err != nil {
+			t.Fatal(err)
+		}
+		git(t, ws, "init", "-q", "-b", "main")
+	}
+
+	sources, err := m.sources()
+	if err == nil || !strings.Contains(err.Error(), "App") {
+		t.Errorf("expected collision error naming App, got %v", err)
+	}
+	if len(sources) != 1 || sources[0].repo != "other" {
+		t.Errorf("expected only other to be mirrored, got %+v", sources)
+	}
+}
@@ -0,0 +1,391 @@
+package envoy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hotschmoe/protectorate/internal/config"
+	"github.com/hotschmoe/protectorate/internal/protocol"
+)
+
+// Reconciler converges workspaces and sleeves on the fleet file. Each pass
+// diffs the file against WorkspaceManager.List and SleeveManager.List and
+// clones, spawns and kills to close the gap. Clones are asynchronous, so a
+// sleeve whose workspace is still cloning is spawned on a later pass.
+type Reconciler struct {
+	cfg        config.FleetConfig
+	sleeves    *SleeveManager
+	workspaces *WorkspaceManager
+	auditLog   *AuditLog
+
+	mu        sync.Mutex // serializes passes
+	managed   map[string]bool
+	clones    map[string]string // workspace name -> clone job ID
+	statePath string
+
+	stop chan struct{}
+}
+
+// errWorkspacePending means a sleeve's workspace is still being cloned; the
+// spawn is retried on the next pass rather than reported as a failure.
+var errWorkspacePending = errors.New("waiting for workspace clone")
+
+// fleetState is persisted so sleeves the reconciler spawned are still known
+// to be its own after an envoy restart.
+type fleetState struct {
+	Managed []string `json:"managed"`
+}
+
+func NewReconciler(cfg *config.EnvoyConfig, sleeves *SleeveManager, workspaces *WorkspaceManager, auditLog *AuditLog) *Reconciler {
+	rc := &Reconciler{
+		cfg:        cfg.Fleet,
+		sleeves:    sleeves,
+		workspaces: workspaces,
+		auditLog:   auditLog,
+		managed:    make(map[string]bool),
+		clones:     make(map[string]string),
+		statePath:  filepath.Join(cfg.DataDir, "fleet_state.json"),
+		stop:       make(chan struct{}),
+	}
+
+	var state fleetState
+	if data, err := os.ReadFile(rc.statePath); err == nil && json.Unmarshal(data, &state) == nil {
+		for _, name := range state.Managed {
+			rc.managed[name] = true
+		}
+	}
+
+	return rc
+}
+
+func (rc *Reconciler) Run() {
+	if rc.cfg.Interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(rc.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := os.Stat(rc.cfg.Path); err != nil {
+				continue
+			}
+			if _, err := rc.Apply(); err != nil {
+				log.Printf("reconcile: %v", err)
+			}
+		case <-rc.stop:
+			return
+		}
+	}
+}
+
+func (rc *Reconciler) Stop() {
+	close(rc.stop)
+}
+
+// Plan returns the actions Apply would take, without taking them.
+func (rc *Reconciler) Plan() (*protocol.ReconcilePlan, error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	_, plan, err := rc.plan()
+	return plan, err
+}
+
+// Apply converges on the fleet file and returns the actions taken, each with
+// its error if it failed.
+func (rc *Reconciler) Apply() (*protocol.ReconcilePlan, error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	fleet, plan, err := rc.plan()
+	if err != nil {
+		return nil, err
+	}
+
+	desired := make(map[string]config.FleetSleeve)
+	for _, sl := range fleet.Sleeves {
+		desired[sl.Name] = sl
+	}
+	repos := make(map[string]config.FleetWorkspace)
+	for _, ws := range fleet.Workspaces {
+		repos[ws.Name] = ws
+	}
+
+	for i := range plan.Actions {
+		action := &plan.Actions[i]
+
+		var err error
+		switch action.Op {
+		case "clone":
+			err = rc.clone(repos[action.Target])
+		case "create":
+			_, err = rc.workspaces.Create(action.Target)
+		case "switch":
+			err = rc.switchBranch(action.Target, repos[action.Target].Branch)
+		case "spawn":
+			err = rc.spawn(desired[action.Target])
+		case "start":
+			_, err = rc.sleeves.Start(action.Target)
+		case "respawn":
+			if err = rc.sleeves.Kill(action.Target); err == nil {
+				err = rc.spawn(desired[action.Target])
+			}
+		case "kill":
+			if err = rc.sleeves.Kill(action.Target); err == nil {
+				delete(rc.managed, action.Target)
+			}
+		}
+
+		if errors.Is(err, errWorkspacePending) {
+			action.Error = err.Error()
+			continue
+		}
+		if err != nil {
+			action.Error = err.Error()
+			log.Printf("reconcile: %s %s: %v", action.Op, action.Target, err)
+		}
+
+		rc.auditLog.Record(protocol.AuditEntry{
+			Actor:   "envoy",
+			Action:  "reconcile." + action.Op,
+			Target:  action.Target,
+			Details: map[string]string{"reason": action.Reason},
+			Outcome: outcomeLabel(err),
+			Error:   errString(err),
+		})
+	}
+
+	// Forget managed sleeves that were killed by hand and are no longer declared.
+	for name := range rc.managed {
+		_, declared := desired[name]
+		if _, err := rc.sleeves.Get(name); err != nil && !declared {
+			delete(rc.managed, name)
+		}
+	}
+
+	if err := rc.saveState(); err != nil {
+		log.Printf("reconcile: failed to save state: %v", err)
+	}
+
+	plan.Applied = true
+	return plan, nil
+}
+
+// plan loads the fleet file and diffs it against the current state.
+// Caller holds rc.mu.
+func (rc *Reconciler) plan() (*config.Fleet, *protocol.ReconcilePlan, error) {
+	fleet, err := config.LoadFleet(rc.cfg.Path)
+	if os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("fleet file %s not found", rc.cfg.Path)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	plan := &protocol.ReconcilePlan{
+		FleetFile: rc.cfg.Path,
+		Actions:   []protocol.ReconcileAction{},
+		CreatedAt: time.Now(),
+	}
+
+	workspaces, err := rc.workspaces.List()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list workspaces: %w", err)
+	}
+	existing := make(map[string]protocol.WorkspaceInfo)
+	for _, ws := range workspaces {
+		existing[ws.Name] = ws
+	}
+
+	declared := make(map[string]bool)
+	for _, ws := range fleet.Workspaces {
+		declared[ws.Name] = true
+	}
+	for i, sl := range fleet.Sleeves {
+		if _, ok := existing[sl.Workspace]; !ok && !declared[sl.Workspace] {
+			return nil, nil, fmt.Errorf("fleet file %s: sleeves[%d]: workspace %q is not declared and does not exist", rc.cfg.Path, i, sl.Workspace)
+		}
+	}
+
+	pending := make(map[string]bool) // workspaces that will not exist until a clone finishes
+	for _, ws := range fleet.Workspaces {
+		cur, ok := existing[ws.Name]
+		switch {
+		case !ok && rc.cloning(ws.Name):
+			pending[ws.Name] = true
+		case !ok && ws.Repo != "":
+			pending[ws.Name] = true
+			plan.Actions = append(plan.Actions, protocol.ReconcileAction{
+				Op: "clone", Target: ws.Name, Reason: "workspace missing; clone " + ws.Repo,
+			})
+		case !ok:
+			plan.Actions = append(plan.Actions, protocol.ReconcileAction{
+				Op: "create", Target: ws.Name, Reason: "workspace missing",
+			})
+		case ws.Branch != "" && cur.Git != nil && cur.Git.Branch != ws.Branch:
+			plan.Actions = append(plan.Actions, protocol.ReconcileAction{
+				Op: "switch", Target: ws.Name,
+				Reason: fmt.Sprintf("on branch %s, want %s", cur.Git.Branch, ws.Branch),
+			})
+		}
+	}
+
+	current := make(map[string]*protocol.SleeveInfo)
+	for _, sl := range rc.sleeves.List() {
+		current[sl.Name] = sl
+	}
+
+	desired := make(map[string]bool)
+	for _, want := range fleet.Sleeves {
+		desired[want.Name] = true
+		wsPath := rc.workspacePath(want.Workspace)
+
+		have, ok := current[want.Name]
+		if !ok {
+			reason := "sleeve missing"
+			if pending[want.Workspace] {
+				reason = "sleeve missing; waiting for workspace clone"
+			}
+			plan.Actions = append(plan.Actions, protocol.ReconcileAction{Op: "spawn", Target: want.Name, Reason: reason})
+			continue
+		}
+
+		if drift := sleeveDrift(have, want, wsPath); drift != "" {
+			plan.Actions = append(plan.Actions, protocol.ReconcileAction{Op: "respawn", Target: want.Name, Reason: drift})
+			continue
+		}
+
+		// Paused and hibernated sleeves were suspended on purpose; leave them.
+		if have.Status == "stopped" {
+			plan.Actions = append(plan.Actions, protocol.ReconcileAction{Op: "start", Target: want.Name, Reason: "sleeve stopped"})
+		}
+	}
+
+	names := make([]string, 0, len(current))
+	for name := range current {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if desired[name] {
+			continue
+		}
+		if rc.managed[name] {
+			plan.Actions = append(plan.Actions, protocol.ReconcileAction{Op: "kill", Target: name, Reason: "removed from fleet file"})
+		} else if fleet.Prune {
+			plan.Actions = append(plan.Actions, protocol.ReconcileAction{Op: "kill", Target: name, Reason: "not in fleet file (prune)"})
+		}
+	}
+
+	return fleet, plan, nil
+}
+
+// sleeveDrift describes how a running sleeve differs from its declaration,
+// or returns "" if it matches.
+func sleeveDrift(have *protocol.SleeveInfo, want config.FleetSleeve, wsPath string) string {
+	if have.Workspace != wsPath {
+		return fmt.Sprintf("workspace is %s, want %s", have.Workspace, wsPath)
+	}
+	if want.Template != "" && have.Template != want.Template {
+		return fmt.Sprintf("template is %q, want %q", have.Template, want.Template)
+	}
+	if want.Profile != "" && profileOrDefault(have.Profile) != want.Profile {
+		return fmt.Sprintf("profile is %s, want %s", profileOrDefault(have.Profile), want.Profile)
+	}
+	return ""
+}
+
+func profileOrDefault(profile string) string {
+	if profile == "" {
+		return defaultProfile
+	}
+	return profile
+}
+
+func (rc *Reconciler) workspacePath(name string) string {
+	return filepath.Join(rc.sleeves.cfg.Load().Docker.WorkspaceRoot, name)
+}
+
+// cloning reports whether a clone the reconciler started is still running.
+func (rc *Reconciler) cloning(workspace string) bool {
+	jobID, ok := rc.clones[workspace]
+	if !ok {
+		return false
+	}
+	job, err := rc.workspaces.GetJob(jobID)
+	if err != nil || job.Status != "cloning" {
+		delete(rc.clones, workspace)
+		return false
+	}
+	return true
+}
+
+func (rc *Reconciler) clone(ws config.FleetWorkspace) error {
+	job, err := rc.workspaces.Clone(protocol.CloneWorkspaceRequest{RepoURL: ws.Repo, Name: ws.Name})
+	if err != nil {
+		return err
+	}
+	rc.clones[ws.Name] = job.ID
+	return nil
+}
+
+// switchBranch checks out branch, creating a tracking branch from origin if
+// there is no local one.
+func (rc *Reconciler) switchBranch(workspace, branch string) error {
+	wsPath := rc.workspacePath(workspace)
+	if err := rc.workspaces.SwitchBranch(wsPath, branch); err == nil {
+		return nil
+	}
+	return rc.workspaces.SwitchBranch(wsPath, "origin/"+branch)
+}
+
+func (rc *Reconciler) spawn(want config.FleetSleeve) error {
+	wsPath := rc.workspacePath(want.Workspace)
+	if _, err := os.Stat(wsPath); os.IsNotExist(err) {
+		if rc.cloning(want.Workspace) {
+			return errWorkspacePending
+		}
+		return fmt.Errorf("workspace %q does not exist", want.Workspace)
+	}
+
+	_, err := rc.sleeves.Spawn(protocol.SpawnSleeveRequest{
+		Name:      want.Name,
+		Workspace: wsPath,
+		Profile:   want.Profile,
+		Template:  want.Template,
+	})
+	if err != nil {
+		return err
+	}
+
+	rc.managed[want.Name] = true
+	return nil
+}
+
+func (rc *Reconciler) saveState() error {
+	state := fleetState{Managed: make([]string, 0, len(rc.managed))}
+	for name := range rc.managed {
+		state.Managed = append(state.Managed, name)
+	}
+	sort.Strings(state.Managed)
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(rc.statePath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(rc.statePath, data, 0644)
+}
@@ -0,0 +1,314 @@
+package envoy
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hotschmoe/protectorate/internal/config"
+	"github.com/hotschmoe/protectorate/internal/protocol"
+)
+
+// secretNamePattern limits secret names to ones that are also valid file
+// names, since a file-delivered secret is named after it by default.
+var secretNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,127}$`)
+
+// SecretStore holds named secrets encrypted at rest with AES-256-GCM. Each
+// value is sealed with its name as additional data, so a ciphertext cannot be
+// moved to another name. Values are only decrypted when delivered to a sleeve.
+type SecretStore struct {
+	path string
+	aead cipher.AEAD
+
+	mu      sync.RWMutex
+	secrets map[string]*storedSecret
+}
+
+type storedSecret struct {
+	Name       string    `json:"name"`
+	Scope      []string  `json:"scope,omitempty"`
+	Version    int       `json:"version"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Nonce      []byte    `json:"nonce"`
+	Ciphertext []byte    `json:"ciphertext"`
+}
+
+// NewSecretStore opens the store at cfg.Path, creating the key file if no key
+// is configured. Every stored secret is decrypted once so a wrong key fails
+// here rather than at the next spawn.
+func NewSecretStore(cfg config.SecretsConfig) (*SecretStore, error) {
+	key, err := loadSecretsKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &SecretStore{
+		path:    cfg.Path,
+		aead:    aead,
+		secrets: make(map[string]*storedSecret),
+	}
+
+	data, err := os.ReadFile(cfg.Path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var stored []*storedSecret
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", cfg.Path, err)
+	}
+	for _, sec := range stored {
+		if _, err := s.open(sec); err != nil {
+			return nil, fmt.Errorf("secret %q: %w", sec.Name, err)
+		}
+		s.secrets[sec.Name] = sec
+	}
+	return s, nil
+}
+
+// loadSecretsKey returns cfg.Key, or the key in cfg.KeyFile, generating and
+// saving a random one on first start.
+func loadSecretsKey(cfg config.SecretsConfig) ([]byte, error) {
+	encoded := cfg.Key
+	if encoded == "" {
+		data, err := os.ReadFile(cfg.KeyFile)
+		if os.IsNotExist(err) {
+			return generateSecretsKey(cfg.KeyFile)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secrets key: %w", err)
+		}
+		encoded = strings.TrimSpace(string(data))
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("secrets key must be 32 bytes, base64 encoded")
+	}
+	return key, nil
+}
+
+func generateSecretsKey(path string) ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to write secrets key: %w", err)
+	}
+	// O_EXCL so a key written by a concurrent start is never overwritten.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write secrets key: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(base64.StdEncoding.EncodeToString(key) + "\n"); err != nil {
+		return nil, fmt.Errorf("failed to write secrets key: %w", err)
+	}
+	log.Printf("generated secrets master key at %s; back it up, the store cannot be read without it", path)
+	return key, nil
+}
+
+func (s *SecretStore) open(sec *storedSecret) (string, error) {
+	plain, err := s.aead.Open(nil, sec.Nonce, sec.Ciphertext, []byte(sec.Name))
+	if err != nil {
+		return "", fmt.Errorf("cannot decrypt: wrong master key or corrupt store")
+	}
+	return string(plain), nil
+}
+
+// List returns every secret, sorted by name.
+func (s *SecretStore) List() []protocol.SecretInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]protocol.SecretInfo, 0, len(s.secrets))
+	for _, sec := range s.secrets {
+		result = append(result, sec.info())
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+func (s *SecretStore) Get(name string) (*protocol.SecretInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sec, ok := s.secrets[name]
+	if !ok {
+		return nil, fmt.Errorf("secret %q not found", name)
+	}
+	info := sec.info()
+	return &info, nil
+}
+
+// Put creates the secret or rotates it to a new value.
+func (s *SecretStore) Put(name string, req protocol.PutSecretRequest) (*protocol.SecretInfo, error) {
+	if !secretNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid secret name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	if req.Value == "" {
+		return nil, fmt.Errorf("invalid secret: value required")
+	}
+	if req.Scope != nil {
+		for _, pattern := range *req.Scope {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid scope pattern %q", pattern)
+			}
+		}
+	}
+
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	prev := s.secrets[name]
+	sec := &storedSecret{
+		Name:       name,
+		Version:    1,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		Nonce:      nonce,
+		Ciphertext: s.aead.Seal(nil, nonce, []byte(req.Value), []byte(name)),
+	}
+	if prev != nil {
+		sec.Scope = prev.Scope
+		sec.Version = prev.Version + 1
+		sec.CreatedAt = prev.CreatedAt
+	}
+	if req.Scope != nil {
+		sec.Scope = *req.Scope
+	}
+
+	s.secrets[name] = sec
+	if err := s.saveLocked(); err != nil {
+		if prev != nil {
+			s.secrets[name] = prev
+		} else {
+			delete(s.secrets, name)
+		}
+		return nil, fmt.Errorf("failed to save secrets: %w", err)
+	}
+
+	info := sec.info()
+	return &info, nil
+}
+
+func (s *SecretStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sec, ok := s.secrets[name]
+	if !ok {
+		return fmt.Errorf("secret %q not found", name)
+	}
+	delete(s.secrets, name)
+	if err := s.saveLocked(); err != nil {
+		s.secrets[name] = sec
+		return fmt.Errorf("failed to save secrets: %w", err)
+	}
+	return nil
+}
+
+// Value decrypts the secret for sleeve, which must be within its scope.
+func (s *SecretStore) Value(name, sleeve string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sec, ok := s.secrets[name]
+	if !ok {
+		return "", fmt.Errorf("secret %q not found", name)
+	}
+	if !sec.permits(sleeve) {
+		return "", fmt.Errorf("secret %q is not available to sleeve %q", name, sleeve)
+	}
+	return s.open(sec)
+}
+
+// value decrypts the secret regardless of scope, for secrets envoy itself
+// delivers to every sleeve.
+func (s *SecretStore) value(name string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sec, ok := s.secrets[name]
+	if !ok {
+		return "", fmt.Errorf("secret %q not found", name)
+	}
+	return s.open(sec)
+}
+
+// permits reports whether sleeve matches the secret's scope.
+func (sec *storedSecret) permits(sleeve string) bool {
+	if len(sec.Scope) == 0 {
+		return true
+	}
+	for _, pattern := range sec.Scope {
+		if ok, _ := path.Match(pattern, sleeve); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (sec *storedSecret) info() protocol.SecretInfo {
+	return protocol.SecretInfo{
+		Name:      sec.Name,
+		Scope:     sec.Scope,
+		Version:   sec.Version,
+		CreatedAt: sec.CreatedAt,
+		UpdatedAt: sec.UpdatedAt,
+	}
+}
+
+// saveLocked writes the store through a temporary file so a crash never
+// leaves it half written. Caller holds s.mu.
+func (s *SecretStore) saveLocked() error {
+	stored := make([]*storedSecret, 0, len(s.secrets))
+	for _, sec := range s.secrets {
+		stored = append(stored, sec)
+	}
+	sort.Slice(stored, func(i, j int) bool { return stored[i].Name < stored[j].Name })
+
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -3,46 +3,105 @@ package envoy
 import (
 	"context"
 	"fmt"
+	"log"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/hotschmoe/protectorate/internal/config"
+	"github.com/hotschmoe/protectorate/internal/protocol"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 type Server struct {
-	cfg        *config.EnvoyConfig
+	cfg        *LiveConfig
+	configPath string
+	reloadMu   sync.Mutex
 	http       *http.Server
 	docker     *DockerClient
 	sleeves    *SleeveManager
 	workspaces *WorkspaceManager
+	auditLog   *AuditLog
+	secrets    *SecretStore
+	prober     *SleeveProber
+	tasks      *TaskManager
+	loops      *LoopManager
+	pool       *SleevePool
+	reconciler *Reconciler
+	mirrors    *Mirrorer
+	proxy      *SleeveProxy
+	stop       chan struct{}
 }
 
-func NewServer(cfg *config.EnvoyConfig) (*Server, error) {
+// NewServer creates the envoy server from cfg, which was loaded from
+// configPath ("" for environment only) and is re-read from there on reload.
+func NewServer(cfg *config.EnvoyConfig, configPath string) (*Server, error) {
 	docker, err := NewDockerClient()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create docker client: %w", err)
 	}
 
-	sleeves := NewSleeveManager(docker, cfg)
-	workspaces := NewWorkspaceManager(cfg, sleeves.List)
+	auditLog, err := NewAuditLog(cfg.Audit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	secrets, err := NewSecretStore(cfg.Secrets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open secrets store: %w", err)
+	}
+
+	host := detectHostPaths(docker)
+	host.fill(cfg)
+	if host.inContainer {
+		log.Printf("host paths: workspaces %s -> %q", cfg.Docker.WorkspaceRoot, cfg.Docker.WorkspaceHostRoot)
+	}
+
+	live := NewLiveConfig(cfg)
+	sleeves := NewSleeveManager(docker, live, host, secrets)
+	workspaces := NewWorkspaceManager(live, sleeves.List)
+	pool := NewSleevePool(live, docker, sleeves)
+	sleeves.SetPool(pool)
 
 	if err := sleeves.RecoverSleeves(); err != nil {
 		return nil, fmt.Errorf("failed to recover sleeves: %w", err)
 	}
 
+	prometheus.MustRegister(newSleeveCollector(sleeves.List))
+
 	s := &Server{
-		cfg:        cfg,
+		cfg:        live,
+		configPath: configPath,
 		docker:     docker,
 		sleeves:    sleeves,
 		workspaces: workspaces,
+		auditLog:   auditLog,
+		secrets:    secrets,
+		prober:     NewSleeveProber(cfg.Probe, sleeves, auditLog),
+		tasks:      NewTaskManager(live, sleeves),
+		loops:      NewLoopManager(docker, sleeves),
+		pool:       pool,
+		reconciler: NewReconciler(cfg, sleeves, workspaces, auditLog),
+		mirrors:    NewMirrorer(cfg, workspaces, auditLog),
+		proxy:      NewSleeveProxy(live, docker, sleeves, auditLog),
+		stop:       make(chan struct{}),
 	}
+	go s.prober.Run()
+	go s.tasks.Run()
+	go s.pool.Run()
+	go s.reconciler.Run()
+	go s.mirrors.Run()
+	go s.proxy.Run()
+	go sleeves.PollAgentStatus(cfg.PollInterval, s.stop)
 
 	mux := http.NewServeMux()
 	s.registerRoutes(mux)
 
 	s.http = &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.Port),
-		Handler:      mux,
+		Handler:      s.refuseSleeves(mux),
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 30 * time.Second,
 	}
@@ -52,12 +111,30 @@ func NewServer(cfg *config.EnvoyConfig) (*Server, error) {
 
 func (s *Server) registerRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("/health/live", s.handleHealthLive)
+	mux.HandleFunc("/health/ready", s.handleHealthReady)
+	mux.Handle("/metrics", promhttp.Handler())
 	mux.HandleFunc("/api/auth/status", s.handleAuthStatus)
 	mux.HandleFunc("/api/docker/containers", s.handleDockerContainers)
 	mux.HandleFunc("/api/docker/networks", s.handleDockerNetworks)
 	mux.HandleFunc("/api/workspaces", s.handleWorkspaces)
 	mux.HandleFunc("/api/workspaces/clone", s.handleCloneWorkspace)
 	mux.HandleFunc("/api/workspaces/branches", s.handleWorkspaceBranches)
+	mux.HandleFunc("/api/workspaces/gitea", s.handleWorkspaceGitea)
+	mux.HandleFunc("/api/gitea/repos", s.handleGiteaRepos)
+	mux.HandleFunc("/api/audit", s.handleAudit)
+	mux.HandleFunc("/api/tasks", s.handleTasks)
+	mux.HandleFunc("/api/tasks/", s.handleTaskByID)
+	mux.HandleFunc("/api/loops", s.handleLoops)
+	mux.HandleFunc("/api/config", s.handleConfig)
+	mux.HandleFunc("/api/config/reload", s.handleConfigReload)
+	mux.HandleFunc("/api/pool", s.handlePool)
+	mux.HandleFunc("/api/templates", s.handleTemplates)
+	mux.HandleFunc("/api/reconcile", s.handleReconcile)
+	mux.HandleFunc("/api/reconcile/plan", s.handleReconcilePlan)
+	mux.HandleFunc("/api/mirrors", s.handleMirrors)
+	mux.HandleFunc("/api/secrets", s.handleSecrets)
+	mux.HandleFunc("/api/secrets/", s.handleSecretByName)
 	mux.HandleFunc("/api/sleeves", s.handleSleeves)
 	mux.HandleFunc("/api/sleeves/", s.handleSleeveByName)
 	mux.HandleFunc("/sleeves/", s.handleSleeveTerminal)
@@ -65,6 +142,59 @@ func (s *Server) registerRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/", s.handleIndex)
 }
 
+// refuseSleeves rejects requests from sleeve containers, which reach envoy on
+// the shared network and on every isolated sleeve's network. The API has no
+// auth, so a sleeve could otherwise drive other sleeves or read their
+// terminals. Sleeves may only check envoy's health and read or report on
+// tasks assigned to them.
+func (s *Server) refuseSleeves(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, sleeves := s.proxy.containerFor(r.RemoteAddr)
+		if id == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// A warm pool container is refused too, though it has no name yet.
+		actor := "container:" + id
+		for _, sl := range sleeves {
+			if sl.ContainerID == id {
+				actor = "sleeve:" + sl.Name
+				if s.sleeveMayCall(sl.Name, r) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+
+		s.auditLog.Record(protocol.AuditEntry{
+			Time:     time.Now(),
+			Actor:    actor,
+			SourceIP: clientIP(r.RemoteAddr),
+			Action:   "api.refused",
+			Target:   r.URL.Path,
+			Details:  map[string]string{"method": r.Method},
+			Outcome:  "failure",
+			Error:    "request from a sleeve",
+		})
+		http.Error(w, "forbidden: sleeves cannot use the envoy API", http.StatusForbidden)
+	})
+}
+
+func (s *Server) sleeveMayCall(sleeve string, r *http.Request) bool {
+	if r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/health") {
+		return true
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		return false
+	}
+	id, ok := strings.CutPrefix(r.URL.Path, "/api/tasks/")
+	if !ok || id == "" || strings.Contains(id, "/") {
+		return false
+	}
+	task, err := s.tasks.Get(id)
+	return err == nil && task.Sleeve == sleeve
+}
+
 func (s *Server) Start() error {
 	return s.http.ListenAndServe()
 }
@@ -72,5 +202,14 @@ func (s *Server) Start() error {
 func (s *Server) Shutdown() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	return s.http.Shutdown(ctx)
+	close(s.stop)
+	s.prober.Stop()
+	s.tasks.Stop()
+	s.pool.Stop()
+	s.reconciler.Stop()
+	s.mirrors.Stop()
+	s.proxy.Stop()
+	err := s.http.Shutdown(ctx)
+	s.auditLog.Close()
+	return err
 }
@@ -0,0 +1,207 @@
+package envoy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hotschmoe/protectorate/internal/protocol"
+)
+
+const (
+	defaultExecTimeout = 30 * time.Second
+	maxExecTimeout     = 10 * time.Minute
+
+	// execKillGrace is how long `timeout` waits after SIGTERM before SIGKILL.
+	execKillGrace = 5 * time.Second
+)
+
+// shellControl is a JSON control message sent as a text frame on the shell
+// WebSocket. Any other frame is treated as terminal input.
+type shellControl struct {
+	Type string `json:"type"` // resize
+	Cols uint   `json:"cols"`
+	Rows uint   `json:"rows"`
+}
+
+// Exec runs a one-off command as the sleeve user in the workspace directory.
+// The command is wrapped in coreutils `timeout` so it is killed inside the
+// container rather than left running when the deadline passes.
+func (m *SleeveManager) Exec(name string, req protocol.ExecRequest) (*protocol.ExecResponse, error) {
+	if len(req.Cmd) == 0 {
+		return nil, fmt.Errorf("cmd required")
+	}
+
+	timeout, err := parseDurationDefault(req.Timeout, defaultExecTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timeout: %w", err)
+	}
+	if timeout < time.Second || timeout > maxExecTimeout {
+		return nil, fmt.Errorf("invalid timeout: must be between 1s and %s", maxExecTimeout)
+	}
+
+	sleeve, err := m.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if sleeve.Status != "running" {
+		return nil, fmt.Errorf("sleeve %q is not running", name)
+	}
+
+	cmd := append([]string{
+		"timeout",
+		"-k", strconv.Itoa(int(execKillGrace.Seconds())),
+		strconv.Itoa(int(math.Ceil(timeout.Seconds()))),
+	}, req.Cmd...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout+execKillGrace+5*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	res, err := m.docker.Exec(ctx, sleeve.ContainerID, ExecOptions{
+		User:       sleeveUser,
+		WorkingDir: sleeveWorkspace,
+		Env:        req.Env,
+		Cmd:        cmd,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("exec failed: %w", err)
+	}
+
+	// timeout exits 124 after SIGTERM, or 137 if it had to SIGKILL; 137 is
+	// also an OOM kill, so it only counts once the deadline has passed.
+	elapsed := time.Since(start)
+	return &protocol.ExecResponse{
+		Stdout:     res.Stdout,
+		Stderr:     res.Stderr,
+		ExitCode:   res.ExitCode,
+		TimedOut:   res.ExitCode == 124 || (res.ExitCode == 137 && elapsed >= timeout),
+		DurationMS: elapsed.Milliseconds(),
+	}, nil
+}
+
+func (s *Server) handleSleeveExec(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req protocol.ExecRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Long-running commands outlive the server's default write timeout.
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(maxExecTimeout + time.Minute))
+
+	res, err := s.sleeves.Exec(name, req)
+	s.audit(r, "sleeve.exec", name, map[string]string{"cmd": truncateOutput(strings.Join(req.Cmd, " "), 200)}, err)
+	if err != nil {
+		errMsg := err.Error()
+		if strings.Contains(errMsg, "not found") {
+			http.Error(w, errMsg, http.StatusNotFound)
+		} else if strings.Contains(errMsg, "required") || strings.Contains(errMsg, "invalid") {
+			http.Error(w, errMsg, http.StatusBadRequest)
+		} else if strings.Contains(errMsg, "not running") {
+			http.Error(w, errMsg, http.StatusConflict)
+		} else {
+			http.Error(w, errMsg, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// handleSleeveShell opens an interactive login shell in the sleeve over a
+// WebSocket. It runs alongside, not inside, the agent's tmux session.
+func (s *Server) handleSleeveShell(w http.ResponseWriter, r *http.Request, name string) {
+	sleeve, err := s.sleeves.Get(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if sleeve.Status != "running" {
+		http.Error(w, fmt.Sprintf("sleeve %q is not running", name), http.StatusConflict)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	execID, stream, err := s.docker.ExecInteractive(ctx, sleeve.ContainerID, ExecOptions{
+		User:       sleeveUser,
+		WorkingDir: sleeveWorkspace,
+		Env:        []string{"TERM=xterm-256color"},
+		Cmd:        []string{"bash", "-l"},
+	})
+	s.audit(r, "sleeve.shell", name, nil, err)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer stream.Close()
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("websocket upgrade error: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	log.Printf("shell opened: sleeve %s", name)
+
+	errCh := make(chan error, 2)
+
+	go func() {
+		for {
+			msgType, msg, err := conn.ReadMessage()
+			if err != nil {
+				errCh <- err
+				return
+			}
+
+			if msgType == websocket.TextMessage && len(msg) > 0 && msg[0] == '{' {
+				var ctl shellControl
+				if json.Unmarshal(msg, &ctl) == nil && ctl.Type == "resize" {
+					s.docker.ResizeExec(ctx, execID, ctl.Rows, ctl.Cols)
+					continue
+				}
+			}
+
+			if _, err := stream.Conn.Write(msg); err != nil {
+				errCh <- err
+				return
+			}
+		}
+	}()
+
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := stream.Reader.Read(buf)
+			if n > 0 {
+				if werr := conn.WriteMessage(websocket.BinaryMessage, buf[:n]); werr != nil {
+					errCh <- werr
+					return
+				}
+			}
+			if err != nil {
+				errCh <- err
+				return
+			}
+		}
+	}()
+
+	err = <-errCh
+	log.Printf("shell closed: sleeve %s: %v", name, err)
+}
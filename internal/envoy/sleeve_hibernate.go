@@ -0,0 +1,392 @@
+package envoy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hotschmoe/protectorate/internal/protocol"
+)
+
+// hibernateImageRepo is the local image repository hibernated sleeves are
+// committed to, tagged with the sleeve name.
+const hibernateImageRepo = "protectorate-hibernated"
+
+// hibernation is the on-disk record of a hibernated sleeve: everything needed
+// to recreate its container, plus a snapshot of its workspace.
+type hibernation struct {
+	Name         string                     `json:"name"`
+	Workspace    string                     `json:"workspace"`
+	Profile      string                     `json:"profile,omitempty"`
+	Image        string                     `json:"image"`
+	Spec         *sleeveSpec                `json:"spec,omitempty"`
+	Snapshot     *workspaceSnapshot         `json:"snapshot,omitempty"`
+	Git          *protocol.WorkspaceGitInfo `json:"git,omitempty"`
+	SpawnTime    time.Time                  `json:"spawn_time"`
+	HibernatedAt time.Time                  `json:"hibernated_at"`
+}
+
+func (m *SleeveManager) hibernationDir() string {
+	return filepath.Join(m.cfg.Load().DataDir, "hibernated")
+}
+
+func (m *SleeveManager) hibernationPath(name string) string {
+	return filepath.Join(m.hibernationDir(), name+".json")
+}
+
+func (m *SleeveManager) snapshotPath(name string) string {
+	return filepath.Join(m.hibernationDir(), name+".tar.gz")
+}
+
+// Hibernate commits the sleeve's container filesystem to an image, snapshots
+// its workspace, records its spawn spec and removes the container. A running
+// sleeve is paused first so the snapshot and image agree. The sleeve stays
+// listed as "hibernated" and keeps its name until Wake or Kill.
+func (m *SleeveManager) Hibernate(name string) (*protocol.SleeveInfo, error) {
+	m.mu.Lock()
+	sleeve, ok := m.sleeves[name]
+	if !ok {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("sleeve %q not found", name)
+	}
+	prevStatus := sleeve.Status
+	if prevStatus != "running" && prevStatus != "stopped" && prevStatus != "paused" {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("sleeve %q is %s, not running or stopped", name, prevStatus)
+	}
+	sleeve.Status = "hibernating"
+	rec := hibernation{
+		Name:      name,
+		Workspace: sleeve.Workspace,
+		Profile:   sleeve.Profile,
+		Image:     hibernateImageRepo + ":" + name,
+		SpawnTime: sleeve.SpawnTime,
+	}
+	containerID := sleeve.ContainerID
+	m.mu.Unlock()
+
+	// committed is set once rec.Image holds this hibernation's image, and
+	// prevImage is the image the tag held before, if it is to be restored.
+	var committed bool
+	var prevImage string
+
+	fail := func(err error) (*protocol.SleeveInfo, error) {
+		if committed {
+			if err := m.docker.RemoveImage(rec.Image); err != nil {
+				log.Printf("sleeve %s: failed to remove image %s: %v", name, rec.Image, err)
+			}
+			if prevImage != "" {
+				if err := m.docker.TagImage(prevImage, rec.Image); err != nil {
+					log.Printf("sleeve %s: failed to restore image %s: %v", name, rec.Image, err)
+				}
+			}
+		}
+		os.Remove(m.snapshotPath(name))
+		if prevStatus == "running" {
+			m.docker.UnpauseContainer(containerID)
+		}
+		m.mu.Lock()
+		if sleeve, ok := m.sleeves[name]; ok {
+			sleeve.Status = prevStatus
+		}
+		m.mu.Unlock()
+		return nil, err
+	}
+
+	if prevStatus == "running" {
+		if err := m.docker.PauseContainer(containerID); err != nil {
+			m.mu.Lock()
+			sleeve.Status = prevStatus
+			m.mu.Unlock()
+			return nil, fmt.Errorf("failed to pause container: %w", err)
+		}
+	}
+
+	// The committed image carries the container's env, less its secrets;
+	// limits, extra mounts, networks and secrets live in the spec label and
+	// must be reapplied on wake.
+	rec.Spec = &sleeveSpec{Profile: rec.Profile}
+	var containerImage string
+	if c, err := m.docker.GetContainerByName("sleeve-" + name); err == nil && c != nil {
+		rec.Spec = specFromLabel(c.Labels)
+		containerImage = c.ImageID
+	}
+
+	// An image already under the tag is either the one this sleeve was woken
+	// from, which the new image is committed on top of and so is removed
+	// with it, or a stale one that would be left dangling once the tag moves.
+	prevImage, err := m.docker.ImageID(rec.Image)
+	if err != nil {
+		log.Printf("sleeve %s: failed to inspect image %s: %v", name, rec.Image, err)
+	}
+	if prevImage != "" && prevImage != containerImage {
+		if err := m.docker.RemoveImage(rec.Image); err != nil {
+			log.Printf("sleeve %s: failed to remove stale image %s: %v", name, rec.Image, err)
+		} else {
+			prevImage = ""
+		}
+	}
+
+	labels := map[string]string{"protectorate.hibernated": name}
+	if _, err := m.docker.CommitContainer(containerID, rec.Image, labels, rec.Spec.secretEnvScrub()); err != nil {
+		return fail(fmt.Errorf("failed to commit container: %w", err))
+	}
+	committed = true
+
+	snap, err := snapshotWorkspace(rec.Workspace, m.snapshotPath(name))
+	if err != nil {
+		return fail(err)
+	}
+	rec.Snapshot = snap
+	rec.Git = getGitInfo(rec.Workspace)
+	rec.HibernatedAt = time.Now()
+
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return fail(err)
+	}
+	if err := os.MkdirAll(m.hibernationDir(), 0755); err != nil {
+		return fail(fmt.Errorf("failed to write hibernation record: %w", err))
+	}
+	if err := os.WriteFile(m.hibernationPath(name), data, 0644); err != nil {
+		return fail(fmt.Errorf("failed to write hibernation record: %w", err))
+	}
+
+	if err := m.docker.RemoveContainer(containerID); err != nil {
+		os.Remove(m.hibernationPath(name))
+		return fail(fmt.Errorf("failed to remove container: %w", err))
+	}
+	if rec.Spec.networkPolicy() == networkIsolated {
+		m.removeSleeveNetwork("sleeve-" + name)
+	}
+
+	if m.pool != nil {
+		m.pool.Release(containerID)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sleeve, ok = m.sleeves[name]
+	if !ok {
+		return nil, fmt.Errorf("sleeve %q not found", name)
+	}
+	sleeve.Status = "hibernated"
+	sleeve.ContainerID = ""
+	sleeve.Health = ""
+	sleeve.ConsecutiveFailures = 0
+
+	snapshot := *sleeve
+	return &snapshot, nil
+}
+
+// Wake recreates a hibernated sleeve's container from its committed image,
+// with the same name, profile and workspace.
+func (m *SleeveManager) Wake(name string) (*protocol.SleeveInfo, error) {
+	m.mu.Lock()
+	sleeve, ok := m.sleeves[name]
+	if !ok {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("sleeve %q not found", name)
+	}
+	if sleeve.Status != "hibernated" {
+		status := sleeve.Status
+		m.mu.Unlock()
+		return nil, fmt.Errorf("sleeve %q is %s, not hibernated", name, status)
+	}
+	sleeve.Status = "waking"
+	m.mu.Unlock()
+
+	fail := func(err error) (*protocol.SleeveInfo, error) {
+		m.mu.Lock()
+		if sleeve, ok := m.sleeves[name]; ok {
+			sleeve.Status = "hibernated"
+		}
+		m.mu.Unlock()
+		return nil, err
+	}
+
+	rec, err := m.readHibernation(name)
+	if err != nil {
+		return fail(err)
+	}
+
+	if err := m.checkWorkspaceSnapshot(rec); err != nil {
+		return fail(err)
+	}
+
+	if err := m.docker.EnsureNetwork(m.cfg.Load().Docker.Network); err != nil {
+		return fail(fmt.Errorf("failed to ensure network: %w", err))
+	}
+
+	env := []string{"SLEEVE_NAME=" + name}
+	if rec.Profile != "" {
+		env = append(env, "SLEEVE_CLI="+rec.Profile)
+	}
+	spec := rec.Spec
+	if spec == nil {
+		spec = &sleeveSpec{Profile: rec.Profile}
+	}
+
+	// The container runs the hibernation image but keeps the spec it was
+	// spawned from, so a later resleeve or hibernation sees the original image.
+	labels := map[string]string{
+		"protectorate.sleeve":          "true",
+		"protectorate.name":            name,
+		"protectorate.workspace":       rec.Workspace,
+		"protectorate.profile":         rec.Profile,
+		"protectorate.template":        spec.Template,
+		"protectorate.hibernate.image": rec.Image,
+		"protectorate.spec":            spec.label(),
+	}
+	woken := *spec
+	woken.Image = rec.Image
+
+	hostPath, err := m.toHostPath(rec.Workspace)
+	if err != nil {
+		return fail(err)
+	}
+
+	containerID, err := m.createContainer("sleeve-"+name, hostPath, &woken, env, labels)
+	if err != nil {
+		return fail(err)
+	}
+
+	if err := os.Remove(m.hibernationPath(name)); err != nil {
+		log.Printf("sleeve %s: failed to remove hibernation record: %v", name, err)
+	}
+	os.Remove(m.snapshotPath(name))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sleeve, ok = m.sleeves[name]
+	if !ok {
+		return nil, fmt.Errorf("sleeve %q not found", name)
+	}
+	sleeve.ContainerID = containerID[:12]
+	sleeve.Status = "running"
+	sleeve.SpawnTime = time.Now()
+
+	snapshot := *sleeve
+	return &snapshot, nil
+}
+
+// checkWorkspaceSnapshot restores a hibernated sleeve's workspace from its
+// snapshot if the workspace is gone or empty. A workspace that changed while
+// the sleeve was hibernated is kept, since the changes were made on purpose
+// by someone else, and the drift is logged.
+func (m *SleeveManager) checkWorkspaceSnapshot(rec *hibernation) error {
+	entries, err := os.ReadDir(rec.Workspace)
+	missing := os.IsNotExist(err) || (err == nil && len(entries) == 0)
+	if err != nil && !missing {
+		return fmt.Errorf("failed to read workspace: %w", err)
+	}
+
+	if rec.Snapshot == nil {
+		if missing {
+			return fmt.Errorf("workspace %q does not exist", rec.Workspace)
+		}
+		return nil
+	}
+
+	if missing {
+		if err := rec.Snapshot.restore(rec.Workspace); err != nil {
+			return fmt.Errorf("failed to restore workspace from snapshot: %w", err)
+		}
+		log.Printf("sleeve %s: restored workspace %s from its snapshot", rec.Name, rec.Workspace)
+		return nil
+	}
+
+	fingerprint, err := workspaceFingerprint(rec.Workspace)
+	if err != nil {
+		return fmt.Errorf("failed to read workspace: %w", err)
+	}
+	if fingerprint != rec.Snapshot.Fingerprint {
+		msg := "workspace changed while hibernated; keeping it"
+		if rec.Git != nil {
+			if now := getGitInfo(rec.Workspace); now != nil && now.LastCommitHash != rec.Git.LastCommitHash {
+				msg += fmt.Sprintf(" (HEAD moved from %s to %s)", rec.Git.LastCommitHash, now.LastCommitHash)
+			}
+		}
+		log.Printf("sleeve %s: %s", rec.Name, msg)
+	}
+	return nil
+}
+
+func (m *SleeveManager) readHibernation(name string) (*hibernation, error) {
+	data, err := os.ReadFile(m.hibernationPath(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hibernation record: %w", err)
+	}
+
+	var rec hibernation
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("failed to read hibernation record: %w", err)
+	}
+	return &rec, nil
+}
+
+// discardHibernation removes a hibernated sleeve's record and image, or the
+// image a woken sleeve's container was created from.
+func (m *SleeveManager) discardHibernation(name, image string) {
+	if rec, err := m.readHibernation(name); err == nil {
+		image = rec.Image
+		os.Remove(m.hibernationPath(name))
+		os.Remove(m.snapshotPath(name))
+	}
+
+	if image == "" {
+		return
+	}
+	if err := m.docker.RemoveImage(image); err != nil {
+		log.Printf("sleeve %s: failed to remove image %s: %v", name, image, err)
+	}
+}
+
+// recoverHibernatedLocked lists sleeves recorded as hibernated. Caller holds m.mu.
+func (m *SleeveManager) recoverHibernatedLocked() int {
+	entries, err := os.ReadDir(m.hibernationDir())
+	if err != nil {
+		return 0
+	}
+
+	recovered := 0
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".json")
+		if e.IsDir() || name == e.Name() {
+			continue
+		}
+		if _, exists := m.sleeves[name]; exists {
+			continue
+		}
+
+		rec, err := m.readHibernation(name)
+		if err != nil {
+			log.Printf("sleeve %s: %v", name, err)
+			continue
+		}
+
+		m.sleeves[name] = &protocol.SleeveInfo{
+			Name:        name,
+			Workspace:   rec.Workspace,
+			Profile:     rec.Profile,
+			Template:    rec.Spec.template(),
+			TTYDPort:    7681,
+			TTYDAddress: fmt.Sprintf("sleeve-%s:7681", name),
+			SpawnTime:   rec.SpawnTime,
+			Status:      "hibernated",
+		}
+		if rec.Spec != nil {
+			applySpec(m.sleeves[name], rec.Spec)
+		}
+		m.usedNames[name] = true
+		recovered++
+	}
+
+	return recovered
+}
@@ -4,7 +4,8 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"strings"
+	"path/filepath"
+	"regexp"
 	"sync"
 	"time"
 
@@ -12,34 +13,56 @@ import (
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/go-connections/nat"
-	"github.com/hotschmoe/protectorate/internal/config"
 	"github.com/hotschmoe/protectorate/internal/protocol"
 )
 
+// tmuxKeyPattern matches tmux key names such as "C-c", "Escape" or "F1".
+var tmuxKeyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]*$`)
+
 var namePool = []string{
 	"quell", "virginia", "rei", "mickey", "trepp",
 	"tanaka", "athena", "apollo", "hermes", "iris", "prometheus",
 }
 
+const (
+	// sleeveUser owns the tmux session inside sleeve containers.
+	sleeveUser = "claude"
+	// tmuxSession is the session the AI CLI runs in.
+	tmuxSession = "main"
+)
+
 type SleeveManager struct {
-	mu       sync.RWMutex
-	docker   *DockerClient
-	cfg      *config.EnvoyConfig
-	sleeves  map[string]*protocol.SleeveInfo
+	mu        sync.RWMutex
+	docker    *DockerClient
+	cfg       *LiveConfig
+	sleeves   map[string]*protocol.SleeveInfo
 	usedNames map[string]bool
-	nextPort int
+	spawning  map[string]int // workspace -> spawns under way onto it
+	nextPort  int
+	pool      *SleevePool
+	host      *hostPaths
+	secrets   *SecretStore
 }
 
-func NewSleeveManager(docker *DockerClient, cfg *config.EnvoyConfig) *SleeveManager {
+func NewSleeveManager(docker *DockerClient, cfg *LiveConfig, host *hostPaths, secrets *SecretStore) *SleeveManager {
 	return &SleeveManager{
 		docker:    docker,
 		cfg:       cfg,
+		host:      host,
+		secrets:   secrets,
 		sleeves:   make(map[string]*protocol.SleeveInfo),
 		usedNames: make(map[string]bool),
+		spawning:  make(map[string]int),
 		nextPort:  7681,
 	}
 }
 
+// SetPool enables claiming warm sleeves on spawn. It must be called before
+// RecoverSleeves so claimed pool containers are recovered under their names.
+func (m *SleeveManager) SetPool(pool *SleevePool) {
+	m.pool = pool
+}
+
 func (m *SleeveManager) allocateName() string {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -70,27 +93,46 @@ func (m *SleeveManager) allocatePort() int {
 	return port
 }
 
-func (m *SleeveManager) toHostPath(containerPath string) string {
-	wsRoot := m.cfg.Docker.WorkspaceRoot
-	wsHostRoot := m.cfg.Docker.WorkspaceHostRoot
-	if wsRoot != "" && wsHostRoot != "" && strings.HasPrefix(containerPath, wsRoot) {
-		return wsHostRoot + strings.TrimPrefix(containerPath, wsRoot)
-	}
-	return containerPath
+// toHostPath maps a path under WORKSPACE_ROOT to the host path Docker needs
+// as a bind mount source.
+func (m *SleeveManager) toHostPath(containerPath string) (string, error) {
+	return m.host.resolve(m.cfg.Load(), containerPath)
 }
 
 func (m *SleeveManager) Spawn(req protocol.SpawnSleeveRequest) (*protocol.SleeveInfo, error) {
-	workspace := req.Workspace
+	start := time.Now()
+	sleeve, err := m.spawn(req)
+	observeSince(sleeveSpawnDuration, start, err)
+	return sleeve, err
+}
 
-	if workspace == "" {
+func (m *SleeveManager) spawn(req protocol.SpawnSleeveRequest) (*protocol.SleeveInfo, error) {
+	if req.Workspace == "" {
 		return nil, fmt.Errorf("workspace path required")
 	}
 
-	if _, err := os.Stat(workspace); os.IsNotExist(err) {
-		return nil, fmt.Errorf("workspace %q does not exist", workspace)
+	if _, err := os.Stat(req.Workspace); os.IsNotExist(err) {
+		return nil, fmt.Errorf("workspace %q does not exist", req.Workspace)
+	}
+
+	spec, err := m.resolveSpec(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.spawnSpec(req.Name, req.Workspace, spec)
+}
+
+// spawnSpec starts a sleeve working on workspace from a resolved spec. An
+// empty name is allocated.
+func (m *SleeveManager) spawnSpec(name, workspace string, spec *sleeveSpec) (*protocol.SleeveInfo, error) {
+	// Resolve the bind source first so an unmappable workspace fails before
+	// a name or a warm sleeve is taken.
+	hostPath, err := m.toHostPath(workspace)
+	if err != nil {
+		return nil, err
 	}
 
-	name := req.Name
 	if name == "" {
 		name = m.allocateName()
 	} else {
@@ -106,24 +148,111 @@ func (m *SleeveManager) Spawn(req protocol.SpawnSleeveRequest) (*protocol.Sleeve
 	containerName := "sleeve-" + name
 	port := m.allocatePort()
 
-	if err := m.docker.EnsureNetwork(m.cfg.Docker.Network); err != nil {
+	if err := m.docker.EnsureNetwork(m.cfg.Load().Docker.Network); err != nil {
 		m.releaseName(name)
 		return nil, fmt.Errorf("failed to ensure network: %w", err)
 	}
 
-	cfg := &container.Config{
-		Image: m.cfg.Docker.SleeveImage,
-		ExposedPorts: nat.PortSet{
-			"7681/tcp": struct{}{},
-		},
-		Labels: map[string]string{
+	// Until the sleeve is registered, other spawns see it only here.
+	wsKey := filepath.Clean(workspace)
+	m.mu.Lock()
+	m.spawning[wsKey]++
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		if m.spawning[wsKey]--; m.spawning[wsKey] <= 0 {
+			delete(m.spawning, wsKey)
+		}
+		m.mu.Unlock()
+	}()
+
+	var containerID string
+	if m.pool != nil && spec.poolable(m.cfg.Load().Docker.SleeveImage) {
+		id, err := m.pool.Claim(name, workspace, spec.Profile)
+		if err != nil {
+			log.Printf("warm pool claim for %s failed, spawning cold: %v", name, err)
+		}
+		containerID = id
+	}
+
+	if containerID == "" {
+		env := []string{"SLEEVE_NAME=" + name}
+		if spec.Profile != "" {
+			env = append(env, "SLEEVE_CLI="+spec.Profile)
+		}
+		labels := map[string]string{
 			"protectorate.sleeve":    "true",
 			"protectorate.name":      name,
 			"protectorate.workspace": workspace,
-		},
+			"protectorate.profile":   spec.Profile,
+			"protectorate.template":  spec.Template,
+		}
+
+		id, err := m.createContainer(containerName, hostPath, spec, env, labels)
+		if err != nil {
+			m.releaseName(name)
+			return nil, err
+		}
+		containerID = id
 	}
 
-	workspaceHostPath := m.toHostPath(workspace)
+	sleeve := &protocol.SleeveInfo{
+		Name:        name,
+		ContainerID: containerID[:12],
+		Workspace:   workspace,
+		Profile:     spec.Profile,
+		Template:    spec.Template,
+		TTYDPort:    port,
+		TTYDAddress: fmt.Sprintf("%s:7681", containerName),
+		SpawnTime:   time.Now(),
+		Status:      "running",
+	}
+	applySpec(sleeve, spec)
+
+	if status, err := readAgentStatus(workspace); err == nil {
+		sleeve.AgentStatus = status
+	}
+
+	m.mu.Lock()
+	m.sleeves[name] = sleeve
+	m.mu.Unlock()
+
+	if spec.Prompt != "" {
+		go m.sendStartupPrompt(name, spec.Prompt)
+	}
+
+	return sleeve, nil
+}
+
+// createContainer creates and starts a sleeve container from spec with the
+// workspace host path bind-mounted at /home/claude/workspace. env is prepended
+// to the spec's env.
+func (m *SleeveManager) createContainer(containerName, workspaceHostPath string, spec *sleeveSpec, env []string, labels map[string]string) (string, error) {
+	resources, err := spec.resources()
+	if err != nil {
+		return "", err
+	}
+
+	if labels["protectorate.spec"] == "" {
+		labels["protectorate.spec"] = spec.label()
+	}
+	conf := m.cfg.Load()
+
+	sleeveName := labels["protectorate.name"]
+	secretEnv, err := m.secretEnv(sleeveName, spec.Secrets)
+	if err != nil {
+		return "", err
+	}
+
+	cfg := &container.Config{
+		Image: spec.Image,
+		ExposedPorts: nat.PortSet{
+			"7681/tcp": struct{}{},
+			"8080/tcp": struct{}{},
+		},
+		Env:    append(append(env, spec.envList()...), secretEnv...),
+		Labels: labels,
+	}
 
 	mounts := []mount.Mount{
 		{
@@ -134,73 +263,147 @@ func (m *SleeveManager) Spawn(req protocol.SpawnSleeveRequest) (*protocol.Sleeve
 		},
 	}
 
-	if m.cfg.Docker.CredentialsHostPath != "" {
+	// A credentials secret is written into the secrets tmpfs instead.
+	if conf.Docker.CredentialsHostPath != "" && conf.Docker.CredentialsSecret == "" {
 		mounts = append(mounts, mount.Mount{
 			Type:     mount.TypeBind,
-			Source:   m.cfg.Docker.CredentialsHostPath,
-			Target:   "/home/claude/.claude/.credentials.json",
+			Source:   conf.Docker.CredentialsHostPath,
+			Target:   credentialsPath,
 			ReadOnly: true,
 		})
 	}
 
-	if m.cfg.Docker.SettingsHostPath != "" {
+	if conf.Docker.SettingsHostPath != "" {
 		mounts = append(mounts, mount.Mount{
 			Type:     mount.TypeBind,
-			Source:   m.cfg.Docker.SettingsHostPath,
-			Target:   "/etc/claude/settings.json",
+			Source:   conf.Docker.SettingsHostPath,
+			Target:   settingsPath,
 			ReadOnly: true,
 		})
 	}
 
-	if m.cfg.Docker.PluginsHostPath != "" {
+	if conf.Docker.PluginsHostPath != "" {
 		mounts = append(mounts, mount.Mount{
 			Type:     mount.TypeBind,
-			Source:   m.cfg.Docker.PluginsHostPath,
-			Target:   "/home/claude/.claude/plugins",
+			Source:   conf.Docker.PluginsHostPath,
+			Target:   pluginsPath,
 			ReadOnly: true,
 		})
 	}
 
+	for _, extra := range spec.Mounts {
+		mounts = append(mounts, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   extra.Source,
+			Target:   extra.Target,
+			ReadOnly: extra.ReadOnly,
+		})
+	}
+
+	if m.needsSecretsDir(spec.Secrets) {
+		mounts = append(mounts, mount.Mount{
+			Type:         mount.TypeTmpfs,
+			Target:       secretsDir,
+			TmpfsOptions: &mount.TmpfsOptions{Mode: 0755},
+		})
+	}
+
 	hostCfg := &container.HostConfig{
-		Mounts: mounts,
+		Mounts:    mounts,
+		Resources: resources,
 	}
 
-	netCfg := &network.NetworkingConfig{
-		EndpointsConfig: map[string]*network.EndpointSettings{
-			m.cfg.Docker.Network: {},
-		},
+	// Shared sleeves join envoy's network; isolated ones get a network of
+	// their own that envoy joins instead.
+	policy := spec.networkPolicy()
+	primaryNetwork := conf.Docker.Network
+	switch policy {
+	case networkNone:
+		hostCfg.NetworkMode = "none"
+	case networkIsolated:
+		proxyEnv, err := m.createSleeveNetwork(containerName, spec)
+		if err != nil {
+			return "", err
+		}
+		cfg.Env = append(cfg.Env, proxyEnv...)
+		primaryNetwork = sleeveNetworkName(containerName)
+	}
+	if proxyURL := m.proxyURL(); proxyURL != "" && policy != networkNone {
+		cfg.Env = append(cfg.Env, m.proxyEnv(proxyURL)...)
+	}
+
+	var netCfg *network.NetworkingConfig
+	if policy != networkNone {
+		netCfg = &network.NetworkingConfig{
+			EndpointsConfig: map[string]*network.EndpointSettings{
+				primaryNetwork: {},
+			},
+		}
+	}
+
+	fail := func(err error) (string, error) {
+		if policy == networkIsolated {
+			m.removeSleeveNetwork(containerName)
+		}
+		return "", err
 	}
 
-	containerID, err := m.docker.CreateContainer(containerName, m.cfg.Docker.SleeveImage, cfg, hostCfg, netCfg)
+	extraNetwork := spec.Network != "" && spec.Network != primaryNetwork
+	if extraNetwork {
+		if err := m.docker.EnsureNetwork(spec.Network); err != nil {
+			return fail(fmt.Errorf("failed to ensure network: %w", err))
+		}
+	}
+
+	containerID, err := m.docker.CreateContainer(containerName, spec.Image, cfg, hostCfg, netCfg)
 	if err != nil {
-		m.releaseName(name)
-		return nil, fmt.Errorf("failed to create container: %w", err)
+		return fail(fmt.Errorf("failed to create container: %w", err))
+	}
+
+	// A spec network is attached in addition to the primary one, which
+	// envoy is always on so it can reach the sleeve.
+	if extraNetwork {
+		if err := m.docker.ConnectNetwork(spec.Network, containerID); err != nil {
+			m.docker.RemoveContainer(containerID)
+			return fail(fmt.Errorf("failed to connect network: %w", err))
+		}
 	}
 
 	if err := m.docker.StartContainer(containerID); err != nil {
 		m.docker.RemoveContainer(containerID)
-		m.releaseName(name)
-		return nil, fmt.Errorf("failed to start container: %w", err)
+		return fail(fmt.Errorf("failed to start container: %w", err))
 	}
 
-	sleeve := &protocol.SleeveInfo{
-		Name:        name,
-		ContainerID: containerID[:12],
-		Workspace:   workspace,
-		TTYDPort:    port,
-		TTYDAddress: fmt.Sprintf("%s:7681", containerName),
-		SpawnTime:   time.Now(),
-		Status:      "running",
+	if m.needsSecretsDir(spec.Secrets) {
+		if err := m.writeSecretFiles(sleeveName, containerID, spec.Secrets, true); err != nil {
+			m.docker.RemoveContainer(containerID)
+			return fail(err)
+		}
 	}
 
-	m.mu.Lock()
-	m.sleeves[name] = sleeve
-	m.mu.Unlock()
+	return containerID, nil
+}
 
-	return sleeve, nil
+// applySpec records spec's network policy and secrets on sleeve. A sleeve
+// without a network has no terminal address.
+func applySpec(sleeve *protocol.SleeveInfo, spec *sleeveSpec) {
+	sleeve.Secrets = spec.Secrets
+	sleeve.NetworkPolicy = spec.networkPolicy()
+	sleeve.Egress = spec.Egress
+	sleeve.EgressDeny = spec.EgressDeny
+	if sleeve.NetworkPolicy == networkNone {
+		sleeve.TTYDAddress = ""
+	}
 }
 
 func (m *SleeveManager) Kill(name string) error {
+	start := time.Now()
+	err := m.kill(name)
+	observeSince(sleeveKillDuration, start, err)
+	return err
+}
+
+func (m *SleeveManager) kill(name string) error {
 	m.mu.RLock()
 	sleeve, ok := m.sleeves[name]
 	m.mu.RUnlock()
@@ -216,6 +419,7 @@ func (m *SleeveManager) Kill(name string) error {
 		return fmt.Errorf("failed to find container: %w", err)
 	}
 
+	var image string
 	if c != nil {
 		if err := m.docker.StopContainer(c.ID); err != nil {
 			// Continue to remove even if stop fails
@@ -223,12 +427,20 @@ func (m *SleeveManager) Kill(name string) error {
 		if err := m.docker.RemoveContainer(c.ID); err != nil {
 			return fmt.Errorf("failed to remove container: %w", err)
 		}
+		image = c.Labels["protectorate.hibernate.image"]
+	}
+	if sleeve.NetworkPolicy == networkIsolated {
+		m.removeSleeveNetwork(containerName)
 	}
+	m.discardHibernation(name, image)
 
 	m.mu.Lock()
 	delete(m.sleeves, name)
 	m.mu.Unlock()
 
+	if m.pool != nil {
+		m.pool.Release(sleeve.ContainerID)
+	}
 	m.releaseName(sleeve.Name)
 
 	return nil
@@ -240,11 +452,28 @@ func (m *SleeveManager) List() []*protocol.SleeveInfo {
 
 	result := make([]*protocol.SleeveInfo, 0, len(m.sleeves))
 	for _, s := range m.sleeves {
-		result = append(result, s)
+		snapshot := *s
+		result = append(result, &snapshot)
 	}
 	return result
 }
 
+// workspaceUsers returns the name of a sleeve, in any state, working on
+// workspace, or "" if there is none, and how many spawns onto it are under
+// way, including the caller's.
+func (m *SleeveManager) workspaceUsers(workspace string) (string, int) {
+	workspace = filepath.Clean(workspace)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for name, s := range m.sleeves {
+		if filepath.Clean(s.Workspace) == workspace {
+			return name, m.spawning[workspace]
+		}
+	}
+	return "", m.spawning[workspace]
+}
+
 func (m *SleeveManager) Get(name string) (*protocol.SleeveInfo, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -253,9 +482,304 @@ func (m *SleeveManager) Get(name string) (*protocol.SleeveInfo, error) {
 	if !ok {
 		return nil, fmt.Errorf("sleeve %q not found", name)
 	}
+	snapshot := *sleeve
+	return &snapshot, nil
+}
+
+// RecordProbe stores the result of a health probe and returns the updated
+// consecutive failure count.
+func (m *SleeveManager) RecordProbe(name string, probeErr error) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sleeve, ok := m.sleeves[name]
+	if !ok {
+		return 0
+	}
+
+	sleeve.LastProbe = time.Now()
+	if probeErr == nil {
+		sleeve.Health = "healthy"
+		sleeve.ConsecutiveFailures = 0
+		sleeve.LastProbeError = ""
+		return 0
+	}
+
+	sleeve.ConsecutiveFailures++
+	sleeve.LastProbeError = probeErr.Error()
+	return sleeve.ConsecutiveFailures
+}
+
+// MarkUnhealthy flags a sleeve as unhealthy without acting on it.
+func (m *SleeveManager) MarkUnhealthy(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if sleeve, ok := m.sleeves[name]; ok {
+		sleeve.Health = "unhealthy"
+	}
+}
+
+// Restart restarts the sleeve's container in place, keeping its workspace and name.
+func (m *SleeveManager) Restart(name string) error {
+	m.mu.RLock()
+	sleeve, ok := m.sleeves[name]
+	var containerID string
+	if ok {
+		containerID = sleeve.ContainerID
+	}
+	m.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("sleeve %q not found", name)
+	}
+
+	if err := m.docker.RestartContainer(containerID); err != nil {
+		return fmt.Errorf("failed to restart container: %w", err)
+	}
+	if snapshot, err := m.Get(name); err == nil {
+		if err := m.refreshSecretFiles(snapshot); err != nil {
+			log.Printf("sleeve %s: %v", name, err)
+		}
+	}
+
+	m.mu.Lock()
+	if sleeve, ok := m.sleeves[name]; ok {
+		sleeve.Status = "running"
+		sleeve.Health = ""
+		sleeve.ConsecutiveFailures = 0
+	}
+	m.mu.Unlock()
+
+	return nil
+}
+
+// Pause freezes every process in the sleeve (cgroup freezer). Memory and the
+// tmux session are kept, so Unpause resumes exactly where it left off.
+func (m *SleeveManager) Pause(name string) (*protocol.SleeveInfo, error) {
+	return m.setState(name, "running", "paused", m.docker.PauseContainer)
+}
+
+// Unpause resumes a paused sleeve and rewrites its file secrets, which may
+// have been rotated while it could not be written to.
+func (m *SleeveManager) Unpause(name string) (*protocol.SleeveInfo, error) {
+	sleeve, err := m.setState(name, "paused", "running", m.docker.UnpauseContainer)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.refreshSecretFiles(sleeve); err != nil {
+		log.Printf("sleeve %s: %v", name, err)
+	}
+	return sleeve, nil
+}
+
+// Stop stops the sleeve's container without removing it. The container keeps
+// its name and workspace mount, so Start brings the same sleeve back.
+func (m *SleeveManager) Stop(name string) (*protocol.SleeveInfo, error) {
+	return m.setState(name, "running", "stopped", m.docker.StopContainer)
+}
+
+// Start starts a stopped sleeve, including one recovered from Docker, and
+// rewrites its file secrets.
+func (m *SleeveManager) Start(name string) (*protocol.SleeveInfo, error) {
+	sleeve, err := m.setState(name, "stopped", "running", m.docker.StartContainer)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.refreshSecretFiles(sleeve); err != nil {
+		log.Printf("sleeve %s: %v", name, err)
+	}
 	return sleeve, nil
 }
 
+// setState applies op to the sleeve's container if the sleeve is in state
+// from, and records it as being in state to.
+func (m *SleeveManager) setState(name, from, to string, op func(id string) error) (*protocol.SleeveInfo, error) {
+	m.mu.RLock()
+	sleeve, ok := m.sleeves[name]
+	var containerID, status string
+	if ok {
+		containerID = sleeve.ContainerID
+		status = sleeve.Status
+	}
+	m.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("sleeve %q not found", name)
+	}
+	if status != from {
+		return nil, fmt.Errorf("sleeve %q is %s, not %s", name, status, from)
+	}
+
+	if err := op(containerID); err != nil {
+		return nil, fmt.Errorf("failed to move sleeve %q to %s: %w", name, to, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sleeve, ok = m.sleeves[name]
+	if !ok {
+		return nil, fmt.Errorf("sleeve %q not found", name)
+	}
+	sleeve.Status = to
+	sleeve.Health = ""
+	sleeve.ConsecutiveFailures = 0
+
+	snapshot := *sleeve
+	return &snapshot, nil
+}
+
+// SendPrompt types text into the sleeve's tmux session and presses Enter.
+func (m *SleeveManager) SendPrompt(name, text string) error {
+	return m.SendInput(name, protocol.SleeveInputRequest{Text: text, Enter: true})
+}
+
+// SendInput types text and then sends key sequences into the sleeve's tmux session.
+func (m *SleeveManager) SendInput(name string, req protocol.SleeveInputRequest) error {
+	if req.Text == "" && len(req.Keys) == 0 && !req.Enter {
+		return fmt.Errorf("text or keys required")
+	}
+	for _, key := range req.Keys {
+		if !tmuxKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid key %q", key)
+		}
+	}
+
+	sleeve, err := m.Get(name)
+	if err != nil {
+		return err
+	}
+
+	sendKeys := func(args ...string) error {
+		cmd := append([]string{"tmux", "send-keys", "-t", tmuxSession}, args...)
+		if _, err := m.docker.ExecCommand(sleeve.ContainerID, sleeveUser, cmd); err != nil {
+			return fmt.Errorf("failed to send keys: %w", err)
+		}
+		return nil
+	}
+
+	if req.Text != "" {
+		if err := sendKeys("-l", "--", req.Text); err != nil {
+			return err
+		}
+	}
+	if len(req.Keys) > 0 {
+		if err := sendKeys(req.Keys...); err != nil {
+			return err
+		}
+	}
+	if req.Enter {
+		return sendKeys("Enter")
+	}
+	return nil
+}
+
+// CaptureScreen returns the visible contents of the sleeve's tmux pane plus up
+// to history lines of scrollback. escapes keeps colour/attribute sequences.
+func (m *SleeveManager) CaptureScreen(name string, history int, escapes bool) (*protocol.SleeveScreen, error) {
+	sleeve, err := m.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := []string{"tmux", "capture-pane", "-p", "-t", tmuxSession}
+	if history > 0 {
+		cmd = append(cmd, "-S", fmt.Sprintf("-%d", history))
+	}
+	if escapes {
+		cmd = append(cmd, "-e")
+	}
+
+	out, err := m.docker.ExecCommand(sleeve.ContainerID, sleeveUser, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture pane: %w", err)
+	}
+
+	return &protocol.SleeveScreen{
+		Sleeve:     name,
+		Content:    out,
+		CapturedAt: time.Now(),
+	}, nil
+}
+
+// Resleeve destroys the sleeve's container and spawns a fresh one with the
+// same name, workspace and spec (hard resleeve). Everything the new container
+// needs is checked before the old one is removed, so a sleeve is only lost if
+// Docker itself fails to create its replacement.
+func (m *SleeveManager) Resleeve(name string) (*protocol.SleeveInfo, error) {
+	sleeve, err := m.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	spec, err := m.resleeveSpec(sleeve)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resleeve: %w", err)
+	}
+
+	if err := m.Kill(name); err != nil {
+		return nil, fmt.Errorf("failed to kill sleeve: %w", err)
+	}
+
+	respawned, err := m.spawnSpec(sleeve.Name, sleeve.Workspace, spec)
+	if err != nil {
+		return nil, fmt.Errorf("sleeve was removed but could not be respawned; its workspace is intact: %w", err)
+	}
+	return respawned, nil
+}
+
+// resleeveSpec returns the spec sleeve's container was created from, checked
+// the way a spawn would check it.
+func (m *SleeveManager) resleeveSpec(sleeve *protocol.SleeveInfo) (*sleeveSpec, error) {
+	spec := &sleeveSpec{
+		Profile:       sleeve.Profile,
+		NetworkPolicy: sleeve.NetworkPolicy,
+		Egress:        sleeve.Egress,
+		EgressDeny:    sleeve.EgressDeny,
+		Secrets:       sleeve.Secrets,
+	}
+	c, err := m.docker.GetContainerByName("sleeve-" + sleeve.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find container: %w", err)
+	}
+	if c != nil {
+		spec = specFromLabel(c.Labels)
+		// Sleeves woken before the spec kept its original image record the
+		// hibernation image, which is removed with the sleeve.
+		if spec.Image != "" && spec.Image == c.Labels["protectorate.hibernate.image"] {
+			spec.Image = ""
+		}
+	} else if rec, err := m.readHibernation(sleeve.Name); err == nil && rec.Spec != nil {
+		spec = rec.Spec
+	}
+	if spec.Image == "" {
+		spec.Image = m.cfg.Load().Docker.SleeveImage
+	}
+
+	if _, err := os.Stat(sleeve.Workspace); err != nil {
+		return nil, fmt.Errorf("workspace %q does not exist", sleeve.Workspace)
+	}
+	if _, err := m.toHostPath(sleeve.Workspace); err != nil {
+		return nil, err
+	}
+	if _, err := spec.resources(); err != nil {
+		return nil, err
+	}
+	if err := spec.validateNetwork(); err != nil {
+		return nil, err
+	}
+	if err := spec.validateSecrets(); err != nil {
+		return nil, err
+	}
+	for _, ref := range spec.Secrets {
+		if _, err := m.secrets.Value(ref.Name, sleeve.Name); err != nil {
+			return nil, err
+		}
+	}
+	return spec, nil
+}
+
 func (m *SleeveManager) RecoverSleeves() error {
 	containers, err := m.docker.ListSleeveContainers()
 	if err != nil {
@@ -270,6 +794,17 @@ func (m *SleeveManager) RecoverSleeves() error {
 		name := c.Labels["protectorate.name"]
 		workspace := c.Labels["protectorate.workspace"]
 
+		// Pool containers keep their pool labels after being claimed; the
+		// pool remembers which sleeve each one became, and so does the
+		// container itself.
+		if c.Labels["protectorate.pool"] == "true" && m.pool != nil {
+			if claim, ok := m.pool.claimFor(c.ID[:12]); ok {
+				name, workspace = claim.Name, claim.Workspace
+			} else if claim, ok := m.pool.recoverClaim(c); ok {
+				name, workspace = claim.Name, claim.Workspace
+			}
+		}
+
 		if name == "" {
 			continue
 		}
@@ -293,11 +828,18 @@ func (m *SleeveManager) RecoverSleeves() error {
 			Name:        name,
 			ContainerID: c.ID[:12],
 			Workspace:   workspace,
+			Profile:     c.Labels["protectorate.profile"],
+			Template:    c.Labels["protectorate.template"],
 			TTYDPort:    7681,
 			TTYDAddress: fmt.Sprintf("%s:7681", containerName),
 			SpawnTime:   time.Unix(c.Created, 0),
 			Status:      status,
 		}
+		spec := specFromLabel(c.Labels)
+		applySpec(sleeve, spec)
+		if sleeve.NetworkPolicy == networkIsolated {
+			m.reconnectSleeveNetwork(containerName)
+		}
 
 		m.sleeves[name] = sleeve
 		m.usedNames[name] = true
@@ -308,5 +850,9 @@ func (m *SleeveManager) RecoverSleeves() error {
 		log.Printf("recovered %d existing sleeve(s) from Docker", recovered)
 	}
 
+	if hibernated := m.recoverHibernatedLocked(); hibernated > 0 {
+		log.Printf("recovered %d hibernated sleeve(s)", hibernated)
+	}
+
 	return nil
 }
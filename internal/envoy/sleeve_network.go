@@ -0,0 +1,232 @@
+package envoy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+)
+
+// Network policies a sleeve can be spawned with.
+const (
+	networkShared   = "shared"   // envoy's network, reachable by every other shared sleeve
+	networkIsolated = "isolated" // a network of its own, shared only with envoy
+	networkNone     = "none"     // no network at all; no terminal, only exec
+)
+
+const (
+	// egressNetwork is the outbound leg of every egress proxy. Sleeves never
+	// join it, so they cannot reach each other's proxies.
+	egressNetwork   = "protectorate-egress"
+	egressProxyPort = 3128
+)
+
+// networkPolicy returns the effective policy: an egress allowlist implies
+// isolated, since a sleeve on the shared network could bypass the proxy.
+func (s *sleeveSpec) networkPolicy() string {
+	if s.NetworkPolicy == "" {
+		if len(s.Egress) > 0 {
+			return networkIsolated
+		}
+		return networkShared
+	}
+	return s.NetworkPolicy
+}
+
+func (s *sleeveSpec) validateNetwork() error {
+	policy := s.networkPolicy()
+	switch policy {
+	case networkShared, networkIsolated, networkNone:
+	default:
+		return fmt.Errorf("invalid network policy %q: must be shared, isolated or none", s.NetworkPolicy)
+	}
+
+	if len(s.Egress) > 0 {
+		if policy != networkIsolated {
+			return fmt.Errorf("invalid network policy: an egress allowlist requires isolated, not %s", policy)
+		}
+		if s.Network != "" {
+			return fmt.Errorf("invalid network policy: an egress allowlist cannot be combined with extra network %q", s.Network)
+		}
+	}
+	for _, domain := range append(append([]string(nil), s.Egress...), s.EgressDeny...) {
+		if domain == "" || strings.ContainsAny(domain, ", /:") {
+			return fmt.Errorf("invalid egress domain %q", domain)
+		}
+	}
+	if policy == networkNone && s.Network != "" {
+		return fmt.Errorf("invalid network policy: a sleeve with no network cannot join %q", s.Network)
+	}
+	return nil
+}
+
+func sleeveNetworkName(containerName string) string {
+	return containerName + "-net"
+}
+
+func egressProxyName(containerName string) string {
+	return containerName + "-egress"
+}
+
+// createSleeveNetwork creates an isolated sleeve's own network and connects
+// envoy to it so the terminal and probes still reach the sleeve. With an
+// egress allowlist the network is internal and a proxy is the only way out:
+// envoy's own when it runs one, or else a dedicated egress proxy container,
+// which the returned env points the sleeve at.
+func (m *SleeveManager) createSleeveNetwork(containerName string, spec *sleeveSpec) ([]string, error) {
+	if m.host.inContainer && m.host.containerID == "" {
+		return nil, fmt.Errorf("cannot isolate sleeve: envoy could not inspect its own container to join the sleeve's network")
+	}
+
+	// A network left behind by a crash may have different settings.
+	m.removeSleeveNetwork(containerName)
+
+	netName := sleeveNetworkName(containerName)
+	labels := map[string]string{"protectorate.sleeve-network": containerName}
+	if err := m.docker.CreateNetwork(netName, len(spec.Egress) > 0, labels); err != nil {
+		return nil, fmt.Errorf("failed to create network: %w", err)
+	}
+
+	if m.host.containerID != "" {
+		if err := m.docker.ConnectNetwork(netName, m.host.containerID); err != nil {
+			m.removeSleeveNetwork(containerName)
+			return nil, fmt.Errorf("failed to connect envoy to %s: %w", netName, err)
+		}
+	}
+
+	if len(spec.Egress) == 0 || m.proxyURL() != "" {
+		return nil, nil
+	}
+
+	proxyURL, err := m.startEgressProxy(containerName, spec)
+	if err != nil {
+		m.removeSleeveNetwork(containerName)
+		return nil, err
+	}
+	return m.proxyEnv(proxyURL), nil
+}
+
+// proxyURL returns the address sleeves reach envoy's forward proxy at, or ""
+// if envoy runs none or has no name sleeves could resolve.
+func (m *SleeveManager) proxyURL() string {
+	conf := m.cfg.Load()
+	host := conf.Proxy.Host
+	if host == "" {
+		host = m.host.name
+	}
+	if conf.Proxy.Port <= 0 || host == "" {
+		return ""
+	}
+	return fmt.Sprintf("http://%s:%d", host, conf.Proxy.Port)
+}
+
+// proxyEnv points HTTP clients in a sleeve at proxyURL. Requests to envoy
+// itself, such as task reports, bypass it.
+func (m *SleeveManager) proxyEnv(proxyURL string) []string {
+	noProxy := "localhost,127.0.0.1"
+	if m.host.name != "" {
+		noProxy += "," + m.host.name
+	}
+	return []string{
+		"HTTP_PROXY=" + proxyURL,
+		"HTTPS_PROXY=" + proxyURL,
+		"http_proxy=" + proxyURL,
+		"https_proxy=" + proxyURL,
+		"NO_PROXY=" + noProxy,
+		"no_proxy=" + noProxy,
+	}
+}
+
+// startEgressProxy runs `envoy egress-proxy` from envoy's own image (or
+// EGRESS_PROXY_IMAGE) on both the sleeve's internal network and the egress
+// network, and returns its URL as seen from the sleeve. It enforces the same
+// policy envoy's proxy would: the spec's allowlist, and SLEEVE_PROXY_DENY
+// plus the spec's denylist.
+func (m *SleeveManager) startEgressProxy(containerName string, spec *sleeveSpec) (string, error) {
+	conf := m.cfg.Load()
+	image := conf.Docker.EgressProxyImage
+	if image == "" {
+		image = m.host.image
+	}
+	if image == "" {
+		return "", fmt.Errorf("egress allowlist needs EGRESS_PROXY_IMAGE: envoy's own image could not be detected")
+	}
+
+	if err := m.docker.EnsureNetwork(egressNetwork); err != nil {
+		return "", fmt.Errorf("failed to ensure network: %w", err)
+	}
+
+	cmd := []string{
+		"egress-proxy",
+		"-listen", fmt.Sprintf(":%d", egressProxyPort),
+		"-allow", strings.Join(spec.Egress, ","),
+	}
+	if deny := append(append([]string(nil), conf.Proxy.Deny...), spec.EgressDeny...); len(deny) > 0 {
+		cmd = append(cmd, "-deny", strings.Join(deny, ","))
+	}
+
+	name := egressProxyName(containerName)
+	cfg := &container.Config{
+		Image:      image,
+		Entrypoint: []string{"envoy"},
+		Cmd:        cmd,
+		User:       "65534:65534",
+		Labels:     map[string]string{"protectorate.egress": containerName},
+	}
+	netCfg := &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{
+			egressNetwork: {},
+		},
+	}
+
+	id, err := m.docker.CreateContainer(name, image, cfg, &container.HostConfig{}, netCfg)
+	if err != nil {
+		return "", fmt.Errorf("failed to create egress proxy: %w", err)
+	}
+	if err := m.docker.ConnectNetwork(sleeveNetworkName(containerName), id); err != nil {
+		m.docker.RemoveContainer(id)
+		return "", fmt.Errorf("failed to connect egress proxy: %w", err)
+	}
+	if err := m.docker.StartContainer(id); err != nil {
+		m.docker.RemoveContainer(id)
+		return "", fmt.Errorf("failed to start egress proxy: %w", err)
+	}
+
+	return fmt.Sprintf("http://%s:%d", name, egressProxyPort), nil
+}
+
+// removeSleeveNetwork removes an isolated sleeve's egress proxy and network,
+// if it has them. The sleeve's container must already be gone.
+func (m *SleeveManager) removeSleeveNetwork(containerName string) {
+	if c, err := m.docker.GetContainerByName(egressProxyName(containerName)); err == nil && c != nil {
+		if err := m.docker.RemoveContainer(c.ID); err != nil {
+			log.Printf("%s: failed to remove egress proxy: %v", containerName, err)
+		}
+	}
+
+	netName := sleeveNetworkName(containerName)
+	if exists, err := m.docker.NetworkExists(context.Background(), netName); err != nil || !exists {
+		return
+	}
+	if m.host.containerID != "" {
+		m.docker.DisconnectNetwork(netName, m.host.containerID)
+	}
+	if err := m.docker.RemoveNetwork(netName); err != nil {
+		log.Printf("%s: failed to remove network %s: %v", containerName, netName, err)
+	}
+}
+
+// reconnectSleeveNetwork rejoins envoy to an isolated sleeve's network after
+// envoy's container was recreated.
+func (m *SleeveManager) reconnectSleeveNetwork(containerName string) {
+	if m.host.containerID == "" {
+		return
+	}
+	err := m.docker.ConnectNetwork(sleeveNetworkName(containerName), m.host.containerID)
+	if err != nil && !strings.Contains(err.Error(), "already exists") {
+		log.Printf("%s: failed to reconnect envoy to its network: %v", containerName, err)
+	}
+}
@@ -0,0 +1,626 @@
+package envoy
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/hotschmoe/protectorate/internal/protocol"
+)
+
+const (
+	poolRefillInterval = 30 * time.Second
+	poolReadyTimeout   = 2 * time.Minute
+	poolClaimTimeout   = 30 * time.Second
+
+	// poolDirName holds the per-slot workspace directories under WORKSPACE_ROOT.
+	// It is hidden so WorkspaceManager.List skips it.
+	poolDirName = ".pool"
+
+	// sidecarClaimFile is where a claimed sleeve's sidecar records its name
+	// and workspace, one per line.
+	sidecarClaimFile = "/var/lib/sidecar/claim"
+
+	// defaultProfile is the CLI a sleeve runs when the spawn names no profile.
+	defaultProfile = "claude-code"
+)
+
+// poolSlot is a warm sleeve waiting to be claimed.
+type poolSlot struct {
+	containerID   string
+	containerName string
+	profile       string
+	image         string
+	dir           string // empty workspace directory bind-mounted into the container
+}
+
+// poolClaim records which sleeve a claimed pool container became. Container
+// labels are immutable, so this is what lets RecoverSleeves find it again;
+// the sidecar also stamps it into the container as sidecarClaimFile, which
+// recoverClaim falls back to if pool_claims.json is lost.
+type poolClaim struct {
+	Name      string `json:"name"`
+	Workspace string `json:"workspace"`
+}
+
+// SleevePool keeps Size started sleeve containers per profile with an empty
+// workspace, so a spawn only has to hand one over instead of booting a
+// container.
+//
+// Each warm sleeve bind-mounts its own slot directory in WORKSPACE_ROOT/.pool.
+// A bind mount follows the directory, not the path, so claiming moves the
+// workspace's entries into the slot and renames the slot onto the workspace
+// path. The running container then sees the workspace without a remount, and
+// the host sees the same workspace directory it had before.
+type SleevePool struct {
+	cfg     *LiveConfig
+	docker  *DockerClient
+	sleeves *SleeveManager
+	client  *http.Client
+
+	mu         sync.Mutex
+	ready      map[string][]*poolSlot // profile -> warm sleeves
+	claims     map[string]poolClaim   // short container ID -> claim
+	claimsPath string
+
+	wake chan struct{}
+	stop chan struct{}
+}
+
+func NewSleevePool(cfg *LiveConfig, docker *DockerClient, sleeves *SleeveManager) *SleevePool {
+	p := &SleevePool{
+		cfg:        cfg,
+		docker:     docker,
+		sleeves:    sleeves,
+		client:     &http.Client{Timeout: poolClaimTimeout},
+		ready:      make(map[string][]*poolSlot),
+		claims:     make(map[string]poolClaim),
+		claimsPath: filepath.Join(cfg.Load().DataDir, "pool_claims.json"),
+		wake:       make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+	}
+
+	if data, err := os.ReadFile(p.claimsPath); err == nil {
+		if err := json.Unmarshal(data, &p.claims); err != nil {
+			log.Printf("warm pool: ignoring unreadable %s: %v", p.claimsPath, err)
+		}
+	}
+
+	return p
+}
+
+// Run adopts warm sleeves left by a previous envoy, then keeps the pool full.
+func (p *SleevePool) Run() {
+	p.adopt()
+	p.refill()
+
+	ticker := time.NewTicker(poolRefillInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.refill()
+		case <-p.wake:
+			p.refill()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// Stop ends the refill loop. Warm sleeves are left running for the next envoy.
+func (p *SleevePool) Stop() {
+	close(p.stop)
+}
+
+// Status reports how many warm sleeves are ready per profile.
+func (p *SleevePool) Status() *protocol.PoolStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	status := &protocol.PoolStatus{
+		Size:  p.cfg.Load().Pool.Size,
+		Ready: make(map[string]int),
+	}
+	for _, profile := range p.profiles() {
+		status.Ready[profile] = len(p.ready[profile])
+	}
+	return status
+}
+
+// Claim hands a warm sleeve for profile to a new sleeve called name working
+// on workspace. It returns the container ID, or "" if no warm sleeve is
+// ready, in which case the caller should spawn cold.
+//
+// A workspace another sleeve already works on is refused: claiming replaces
+// the workspace directory, which would leave that sleeve's bind mount on the
+// removed directory. The caller spawns cold instead, which shares it safely.
+func (p *SleevePool) Claim(name, workspace, profile string) (string, error) {
+	if profile == "" {
+		profile = defaultProfile
+	}
+
+	image := p.cfg.Load().Docker.SleeveImage
+
+	user, spawning := p.sleeves.workspaceUsers(workspace)
+	if user != "" {
+		return "", fmt.Errorf("workspace %s in use by sleeve %s", workspace, user)
+	}
+	if spawning > 1 {
+		return "", fmt.Errorf("workspace %s in use by another sleeve being spawned", workspace)
+	}
+
+	p.mu.Lock()
+	var slot *poolSlot
+	// A slot from an image replaced by a reload is left for trim to remove.
+	if slots := p.ready[profile]; len(slots) > 0 && slots[0].image == image {
+		slot = slots[0]
+		p.ready[profile] = slots[1:]
+	}
+	p.mu.Unlock()
+
+	if slot == nil {
+		return "", nil
+	}
+	defer p.signal()
+
+	if err := adoptWorkspace(slot.dir, workspace); err != nil {
+		p.discard(slot)
+		return "", fmt.Errorf("failed to attach workspace: %w", err)
+	}
+
+	// From here the slot directory is the workspace, so on failure only the
+	// container is discarded.
+	containerName := "sleeve-" + name
+	if err := p.docker.RenameContainer(slot.containerID, containerName); err != nil {
+		p.docker.RemoveContainer(slot.containerID)
+		return "", fmt.Errorf("failed to rename container: %w", err)
+	}
+
+	if err := p.claimSidecar(containerName, name, workspace); err != nil {
+		p.docker.RemoveContainer(slot.containerID)
+		return "", err
+	}
+
+	p.mu.Lock()
+	p.claims[slot.containerID[:12]] = poolClaim{Name: name, Workspace: workspace}
+	err := p.saveClaimsLocked()
+	p.mu.Unlock()
+	if err != nil {
+		log.Printf("warm pool: failed to save claims: %v", err)
+	}
+
+	log.Printf("warm pool: %s claimed %s for %s", name, slot.containerName, workspace)
+	return slot.containerID, nil
+}
+
+// Release forgets the claim on a killed sleeve's container.
+func (p *SleevePool) Release(containerID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.claims[containerID]; !ok {
+		return
+	}
+	delete(p.claims, containerID)
+	if err := p.saveClaimsLocked(); err != nil {
+		log.Printf("warm pool: failed to save claims: %v", err)
+	}
+}
+
+func (p *SleevePool) claimFor(containerID string) (poolClaim, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	claim, ok := p.claims[containerID]
+	return claim, ok
+}
+
+// recoverClaim reads the claim a renamed pool container's sidecar stamped
+// into it, for a claim that pool_claims.json has lost, and records it again.
+func (p *SleevePool) recoverClaim(c types.Container) (poolClaim, bool) {
+	if len(c.Names) == 0 || c.Names[0] == "/"+c.Labels["protectorate.pool.name"] {
+		return poolClaim{}, false
+	}
+
+	data, err := p.docker.ReadFile(c.ID, sidecarClaimFile)
+	if err != nil {
+		log.Printf("warm pool: claimed container %s has no readable claim: %v", c.Names[0], err)
+		return poolClaim{}, false
+	}
+	name, workspace, _ := strings.Cut(strings.TrimSpace(string(data)), "\n")
+	if name == "" || workspace == "" {
+		log.Printf("warm pool: claimed container %s has an incomplete claim", c.Names[0])
+		return poolClaim{}, false
+	}
+
+	claim := poolClaim{Name: name, Workspace: workspace}
+	p.mu.Lock()
+	p.claims[c.ID[:12]] = claim
+	err = p.saveClaimsLocked()
+	p.mu.Unlock()
+	if err != nil {
+		log.Printf("warm pool: failed to save claims: %v", err)
+	}
+	return claim, true
+}
+
+func (p *SleevePool) signal() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (p *SleevePool) profiles() []string {
+	profiles := p.cfg.Load().Pool.Profiles
+	if len(profiles) == 0 {
+		return []string{defaultProfile}
+	}
+	return profiles
+}
+
+// adopt takes over unclaimed warm sleeves that are still running and removes
+// any that are not, or that no longer fit the configured pool.
+func (p *SleevePool) adopt() {
+	containers, err := p.docker.ListSleeveContainers()
+	if err != nil {
+		log.Printf("warm pool: failed to list containers: %v", err)
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	wanted := make(map[string]bool)
+	for _, profile := range p.profiles() {
+		wanted[profile] = true
+	}
+
+	for _, c := range containers {
+		if c.Labels["protectorate.pool"] != "true" {
+			continue
+		}
+		if _, claimed := p.claims[c.ID[:12]]; claimed {
+			continue
+		}
+
+		slot := &poolSlot{
+			containerID:   c.ID,
+			containerName: c.Labels["protectorate.pool.name"],
+			profile:       c.Labels["protectorate.profile"],
+			image:         c.Image,
+			dir:           c.Labels["protectorate.pool.dir"],
+		}
+
+		// A renamed pool container was claimed even if the claim was never
+		// saved; it belongs to a sleeve now, not the pool.
+		if len(c.Names) > 0 && c.Names[0] != "/"+slot.containerName {
+			continue
+		}
+
+		cfg := p.cfg.Load()
+		if c.State == "running" && wanted[slot.profile] && slot.image == cfg.Docker.SleeveImage && len(p.ready[slot.profile]) < cfg.Pool.Size {
+			p.ready[slot.profile] = append(p.ready[slot.profile], slot)
+			continue
+		}
+
+		go p.discard(slot)
+	}
+}
+
+// refill starts warm sleeves until every profile has Size of them. Size and
+// profiles can change on a config reload, so it first trims the surplus.
+func (p *SleevePool) refill() {
+	p.trim()
+	if p.cfg.Load().Pool.Size <= 0 {
+		return
+	}
+
+	if err := p.docker.EnsureNetwork(p.cfg.Load().Docker.Network); err != nil {
+		log.Printf("warm pool: failed to ensure network: %v", err)
+		return
+	}
+
+	for _, profile := range p.profiles() {
+		for {
+			p.mu.Lock()
+			missing := p.cfg.Load().Pool.Size - len(p.ready[profile])
+			p.mu.Unlock()
+			if missing <= 0 {
+				break
+			}
+
+			slot, err := p.start(profile)
+			if err != nil {
+				log.Printf("warm pool: failed to start %s sleeve: %v", profile, err)
+				break
+			}
+
+			p.mu.Lock()
+			p.ready[profile] = append(p.ready[profile], slot)
+			p.mu.Unlock()
+
+			select {
+			case <-p.stop:
+				return
+			default:
+			}
+		}
+	}
+}
+
+// start creates a warm sleeve and waits for its sidecar to come up.
+func (p *SleevePool) start(profile string) (*poolSlot, error) {
+	suffix, err := randomSuffix()
+	if err != nil {
+		return nil, err
+	}
+
+	containerName := fmt.Sprintf("sleeve-pool-%s-%s", profile, suffix)
+	dir := filepath.Join(p.cfg.Load().Docker.WorkspaceRoot, poolDirName, containerName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create slot directory: %w", err)
+	}
+
+	env := []string{
+		"SLEEVE_NAME=" + containerName,
+		"SLEEVE_CLI=" + profile,
+		"SLEEVE_POOLED=true",
+	}
+	labels := map[string]string{
+		"protectorate.sleeve":    "true",
+		"protectorate.pool":      "true",
+		"protectorate.pool.name": containerName,
+		"protectorate.pool.dir":  dir,
+		"protectorate.profile":   profile,
+	}
+
+	hostDir, err := p.sleeves.toHostPath(dir)
+	if err != nil {
+		os.Remove(dir)
+		return nil, err
+	}
+
+	image := p.cfg.Load().Docker.SleeveImage
+	containerID, err := p.sleeves.createContainer(containerName, hostDir, &sleeveSpec{Image: image, Profile: profile}, env, labels)
+	if err != nil {
+		os.Remove(dir)
+		return nil, err
+	}
+
+	slot := &poolSlot{
+		containerID:   containerID,
+		containerName: containerName,
+		profile:       profile,
+		image:         image,
+		dir:           dir,
+	}
+
+	if err := p.waitReady(containerName); err != nil {
+		p.discard(slot)
+		return nil, err
+	}
+
+	return slot, nil
+}
+
+func (p *SleevePool) waitReady(containerName string) error {
+	url := fmt.Sprintf("http://%s:%d/health", containerName, sidecarPort)
+	deadline := time.Now().Add(poolReadyTimeout)
+
+	for time.Now().Before(deadline) {
+		resp, err := p.client.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+
+		select {
+		case <-p.stop:
+			return fmt.Errorf("pool stopped")
+		case <-time.After(time.Second):
+		}
+	}
+
+	return fmt.Errorf("sidecar in %s not ready after %s", containerName, poolReadyTimeout)
+}
+
+// claimSidecar tells the sidecar its new name and to start the CLI.
+func (p *SleevePool) claimSidecar(containerName, name, workspace string) error {
+	body, _ := json.Marshal(protocol.ClaimRequest{Name: name, Workspace: workspace})
+	url := fmt.Sprintf("http://%s:%d/claim", containerName, sidecarPort)
+
+	resp, err := p.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to claim sidecar: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("sidecar claim returned %s", resp.Status)
+	}
+	return nil
+}
+
+// rotateCredentials rewrites CREDENTIALS_SECRET in every warm sleeve, which
+// got it when the pool started them. A warm sleeve that cannot be updated is
+// discarded and replaced.
+func (p *SleevePool) rotateCredentials() {
+	p.mu.Lock()
+	var slots []*poolSlot
+	for _, ready := range p.ready {
+		slots = append(slots, ready...)
+	}
+	p.mu.Unlock()
+
+	var failed []*poolSlot
+	for _, slot := range slots {
+		if err := p.sleeves.writeSecretFiles(slot.containerName, slot.containerID, nil, true); err != nil {
+			log.Printf("warm pool: failed to rotate credentials in %s: %v", slot.containerName, err)
+			failed = append(failed, slot)
+		}
+	}
+	if len(failed) == 0 {
+		return
+	}
+
+	p.mu.Lock()
+	for profile, ready := range p.ready {
+		var keep []*poolSlot
+		for _, slot := range ready {
+			if !containsSlot(failed, slot) {
+				keep = append(keep, slot)
+			}
+		}
+		p.ready[profile] = keep
+	}
+	p.mu.Unlock()
+
+	for _, slot := range failed {
+		p.discard(slot)
+	}
+	p.signal()
+}
+
+func containsSlot(slots []*poolSlot, slot *poolSlot) bool {
+	for _, s := range slots {
+		if s == slot {
+			return true
+		}
+	}
+	return false
+}
+
+// trim discards warm sleeves beyond the configured size, of profiles that are
+// no longer configured, or started from an image other than SLEEVE_IMAGE.
+func (p *SleevePool) trim() {
+	cfg := p.cfg.Load()
+	wanted := make(map[string]bool)
+	for _, profile := range p.profiles() {
+		wanted[profile] = true
+	}
+
+	var surplus []*poolSlot
+	p.mu.Lock()
+	for profile, slots := range p.ready {
+		var keep []*poolSlot
+		for _, slot := range slots {
+			if wanted[profile] && slot.image == cfg.Docker.SleeveImage && len(keep) < cfg.Pool.Size {
+				keep = append(keep, slot)
+			} else {
+				surplus = append(surplus, slot)
+			}
+		}
+		p.ready[profile] = keep
+	}
+	p.mu.Unlock()
+
+	for _, slot := range surplus {
+		p.discard(slot)
+	}
+}
+
+// discard removes a warm sleeve and its slot directory.
+func (p *SleevePool) discard(slot *poolSlot) {
+	if err := p.docker.RemoveContainer(slot.containerID); err != nil {
+		log.Printf("warm pool: failed to remove %s: %v", slot.containerName, err)
+	}
+	if slot.dir != "" {
+		os.RemoveAll(slot.dir)
+	}
+}
+
+func (p *SleevePool) saveClaimsLocked() error {
+	data, err := json.MarshalIndent(p.claims, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p.claimsPath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(p.claimsPath, data, 0644)
+}
+
+// adoptWorkspace makes the empty slot directory become workspace: the
+// workspace's entries are moved into slot, the emptied workspace directory is
+// removed and slot is renamed into its place. Every step is a rename on the
+// same filesystem, so this is fast regardless of workspace size. On failure
+// the workspace is put back as it was.
+func adoptWorkspace(slot, workspace string) error {
+	if leftover, err := os.ReadDir(slot); err != nil {
+		return err
+	} else if len(leftover) > 0 {
+		return fmt.Errorf("slot %s is not empty", slot)
+	}
+
+	info, err := os.Stat(workspace)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(slot, info.Mode().Perm()); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(workspace)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+
+	moved, err := moveEntries(workspace, slot, names)
+	if err != nil {
+		moveEntries(slot, workspace, moved)
+		return err
+	}
+
+	if err := os.Remove(workspace); err != nil {
+		moveEntries(slot, workspace, moved)
+		return err
+	}
+
+	if err := os.Rename(slot, workspace); err != nil {
+		os.Mkdir(workspace, info.Mode().Perm())
+		moveEntries(slot, workspace, moved)
+		return err
+	}
+
+	return nil
+}
+
+// moveEntries renames each named entry from one directory to another and
+// returns the names that were moved before any error.
+func moveEntries(from, to string, names []string) ([]string, error) {
+	moved := make([]string, 0, len(names))
+	for _, name := range names {
+		if err := os.Rename(filepath.Join(from, name), filepath.Join(to, name)); err != nil {
+			return moved, err
+		}
+		moved = append(moved, name)
+	}
+	return moved, nil
+}
+
+func randomSuffix() (string, error) {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
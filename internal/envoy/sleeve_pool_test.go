@@ -0,0 +1,58 @@
+package envoy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hotschmoe/protectorate/internal/config"
+	"github.com/hotschmoe/protectorate/internal/protocol"
+)
+
+func TestPoolClaimRefusesWorkspaceInUse(t *testing.T) {
+	root := t.TempDir()
+	cfg := NewLiveConfig(&config.EnvoyConfig{
+		DataDir: filepath.Join(root, "data"),
+		Docker:  config.DockerConfig{WorkspaceRoot: root, SleeveImage: "sleeve:test"},
+	})
+
+	ws := filepath.Join(root, "api")
+	if err := os.MkdirAll(ws, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(ws, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	slotDir := filepath.Join(root, poolDirName, "sleeve-pool-claude-code-abc123")
+	if err := os.MkdirAll(slotDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	sleeves := NewSleeveManager(nil, cfg, nil, nil)
+	sleeves.sleeves["quell"] = &protocol.SleeveInfo{Name: "quell", Workspace: ws, Status: "stopped"}
+
+	pool := NewSleevePool(cfg, nil, sleeves)
+	slot := &poolSlot{
+		containerID:   "0123456789abcdef",
+		containerName: "sleeve-pool-claude-code-abc123",
+		profile:       defaultProfile,
+		image:         "sleeve:test",
+		dir:           slotDir,
+	}
+	pool.ready[defaultProfile] = []*poolSlot{slot}
+
+	id, err := pool.Claim("rei", ws+"/", "")
+	if err == nil || id != "" {
+		t.Fatalf("Claim = %q, %v; want a refusal", id, err)
+	}
+
+	if ready := pool.ready[defaultProfile]; len(ready) != 1 || ready[0] != slot {
+		t.Errorf("warm sleeve was taken from the pool: %+v", ready)
+	}
+	if _, err := os.Stat(filepath.Join(ws, "main.go")); err != nil {
+		t.Errorf("workspace was disturbed: %v", err)
+	}
+	if entries, err := os.ReadDir(slotDir); err != nil || len(entries) != 0 {
+		t.Errorf("slot directory changed: %v, %v", entries, err)
+	}
+}
@@ -0,0 +1,230 @@
+package envoy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hotschmoe/protectorate/internal/config"
+	"github.com/hotschmoe/protectorate/internal/protocol"
+)
+
+// sidecarPort is where the in-sleeve sidecar serves /health, when present.
+const sidecarPort = 8080
+
+const (
+	// probeMaxRecoveries is how many times the restart or resleeve policy is
+	// tried on a sleeve before it is left marked unhealthy.
+	probeMaxRecoveries = 5
+
+	// probeBackoffBase is the wait after the first recovery before another
+	// may be tried; it doubles after each one, up to probeBackoffMax.
+	probeBackoffBase = 1 * time.Minute
+	probeBackoffMax  = 30 * time.Minute
+
+	// probeRecoveryReset is how long after its last recovery a sleeve must
+	// probe healthy for its count of recoveries to start over.
+	probeRecoveryReset = 1 * time.Hour
+)
+
+// SleeveProber periodically checks each running sleeve's ttyd endpoint (and
+// sidecar /health when one is listening) and applies the configured policy
+// once a sleeve fails FailureThreshold consecutive probes. Restarts and
+// resleeves back off exponentially, and after probeMaxRecoveries the sleeve
+// is marked unhealthy and left alone.
+type SleeveProber struct {
+	cfg      config.ProbeConfig
+	sleeves  *SleeveManager
+	auditLog *AuditLog
+	client   *http.Client
+	stop     chan struct{}
+
+	// recoveries is only touched by the probing goroutine.
+	recoveries map[string]*probeRecovery
+
+	// check and restart are replaced in tests.
+	check   func(*protocol.SleeveInfo) error
+	restart func(name string) error
+}
+
+// probeRecovery tracks the restarts or resleeves tried on one sleeve.
+type probeRecovery struct {
+	attempts int
+	last     time.Time
+	next     time.Time // no further attempt before this
+}
+
+func NewSleeveProber(cfg config.ProbeConfig, sleeves *SleeveManager, auditLog *AuditLog) *SleeveProber {
+	p := &SleeveProber{
+		cfg:        cfg,
+		sleeves:    sleeves,
+		auditLog:   auditLog,
+		client:     &http.Client{Timeout: cfg.Timeout},
+		stop:       make(chan struct{}),
+		recoveries: make(map[string]*probeRecovery),
+	}
+	p.check = p.probe
+	p.restart = p.applyRecovery
+	return p
+}
+
+func (p *SleeveProber) Run() {
+	if p.cfg.Interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.probeAll()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+func (p *SleeveProber) Stop() {
+	close(p.stop)
+}
+
+func (p *SleeveProber) probeAll() {
+	sleeves := p.sleeves.List()
+	known := make(map[string]bool, len(sleeves))
+	for _, sl := range sleeves {
+		known[sl.Name] = true
+
+		// A sleeve with no network cannot be probed.
+		if sl.Status != "running" || sl.TTYDAddress == "" {
+			continue
+		}
+
+		failures := p.sleeves.RecordProbe(sl.Name, p.check(sl))
+		if rec := p.recoveries[sl.Name]; failures == 0 && rec != nil && time.Since(rec.last) >= probeRecoveryReset {
+			delete(p.recoveries, sl.Name)
+		}
+		if failures >= p.cfg.FailureThreshold && sl.Health != "unhealthy" {
+			p.applyPolicy(sl)
+		}
+	}
+
+	for name := range p.recoveries {
+		if !known[name] {
+			delete(p.recoveries, name)
+		}
+	}
+}
+
+// probe returns nil if the sleeve is healthy.
+func (p *SleeveProber) probe(sl *protocol.SleeveInfo) error {
+	resp, err := p.client.Get("http://" + sl.TTYDAddress + "/")
+	if err != nil {
+		return fmt.Errorf("ttyd: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("ttyd returned %s", resp.Status)
+	}
+
+	host := strings.Split(sl.TTYDAddress, ":")[0]
+	sidecarAddr := fmt.Sprintf("%s:%d", host, sidecarPort)
+
+	// A refused connection means the sleeve has no sidecar; only a sidecar
+	// that answers unhealthy counts as a failure.
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.Timeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", sidecarAddr)
+	if err != nil {
+		return nil
+	}
+	conn.Close()
+
+	resp, err = p.client.Get("http://" + sidecarAddr + "/health")
+	if err != nil {
+		return fmt.Errorf("sidecar: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("sidecar returned %s", resp.Status)
+	}
+
+	return nil
+}
+
+func (p *SleeveProber) applyPolicy(sl *protocol.SleeveInfo) {
+	details := map[string]string{"policy": p.cfg.Policy}
+	var err error
+
+	switch p.cfg.Policy {
+	case "restart", "resleeve":
+		rec := p.recoveries[sl.Name]
+		if rec == nil {
+			rec = &probeRecovery{}
+			p.recoveries[sl.Name] = rec
+		}
+		if time.Now().Before(rec.next) {
+			return
+		}
+		if rec.attempts >= probeMaxRecoveries {
+			log.Printf("sleeve %s still failing after %d recoveries, marking unhealthy", sl.Name, rec.attempts)
+			p.sleeves.MarkUnhealthy(sl.Name)
+			err = fmt.Errorf("gave up after %d recoveries", rec.attempts)
+			break
+		}
+
+		rec.attempts++
+		rec.last = time.Now()
+		rec.next = rec.last.Add(probeBackoff(rec.attempts))
+		details["attempt"] = fmt.Sprintf("%d", rec.attempts)
+
+		log.Printf("sleeve %s failed %d probes, %s (attempt %d of %d)", sl.Name, p.cfg.FailureThreshold, p.cfg.Policy, rec.attempts, probeMaxRecoveries)
+		if err = p.restart(sl.Name); err != nil {
+			log.Printf("sleeve %s: unhealthy policy %q failed: %v", sl.Name, p.cfg.Policy, err)
+			p.sleeves.MarkUnhealthy(sl.Name)
+		}
+	default:
+		log.Printf("sleeve %s failed %d probes, marking unhealthy", sl.Name, p.cfg.FailureThreshold)
+		p.sleeves.MarkUnhealthy(sl.Name)
+	}
+
+	p.auditLog.Record(protocol.AuditEntry{
+		Actor:   "envoy",
+		Action:  "sleeve.unhealthy",
+		Target:  sl.Name,
+		Details: details,
+		Outcome: outcomeLabel(err),
+		Error:   errString(err),
+	})
+}
+
+// applyRecovery restarts or resleeves a sleeve, per the policy.
+func (p *SleeveProber) applyRecovery(name string) error {
+	if p.cfg.Policy == "resleeve" {
+		_, err := p.sleeves.Resleeve(name)
+		return err
+	}
+	return p.sleeves.Restart(name)
+}
+
+// probeBackoff is the wait after the given number of recoveries.
+func probeBackoff(attempts int) time.Duration {
+	backoff := probeBackoffBase
+	for i := 1; i < attempts && backoff < probeBackoffMax; i++ {
+		backoff *= 2
+	}
+	return min(backoff, probeBackoffMax)
+}
+
+func errString(err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
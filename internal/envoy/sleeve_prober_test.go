@@ -0,0 +1,67 @@
+package envoy
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hotschmoe/protectorate/internal/config"
+	"github.com/hotschmoe/protectorate/internal/protocol"
+)
+
+func TestProberGivesUpOnSleeveThatKeepsFailing(t *testing.T) {
+	auditLog, err := NewAuditLog(config.AuditConfig{Path: filepath.Join(t.TempDir(), "audit.log")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sleeves := NewSleeveManager(nil, NewLiveConfig(&config.EnvoyConfig{}), nil, nil)
+	sleeves.sleeves["quell"] = &protocol.SleeveInfo{Name: "quell", Status: "running", TTYDAddress: "172.18.0.5:7681"}
+
+	p := NewSleeveProber(config.ProbeConfig{FailureThreshold: 2, Policy: "restart"}, sleeves, auditLog)
+	p.check = func(*protocol.SleeveInfo) error { return errors.New("connection refused") }
+	restarts := 0
+	p.restart = func(name string) error {
+		// Like SleeveManager.Restart, which clears the probe state.
+		restarts++
+		sleeves.mu.Lock()
+		sleeves.sleeves[name].Health = ""
+		sleeves.sleeves[name].ConsecutiveFailures = 0
+		sleeves.mu.Unlock()
+		return nil
+	}
+
+	p.probeAll()
+	p.probeAll()
+	if restarts != 1 {
+		t.Fatalf("restarted %d times after reaching the threshold, want 1", restarts)
+	}
+
+	// Within the backoff, failing again does not restart.
+	for i := 0; i < 10; i++ {
+		p.probeAll()
+	}
+	if restarts != 1 {
+		t.Fatalf("restarted %d times within the backoff, want 1", restarts)
+	}
+
+	for i := 0; i < 100; i++ {
+		p.recoveries["quell"].next = time.Time{}
+		p.probeAll()
+	}
+	if restarts != probeMaxRecoveries {
+		t.Errorf("restarted %d times, want %d", restarts, probeMaxRecoveries)
+	}
+	if health := sleeves.sleeves["quell"].Health; health != "unhealthy" {
+		t.Errorf("health = %q, want unhealthy", health)
+	}
+}
+
+func TestProbeBackoff(t *testing.T) {
+	want := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 16 * time.Minute, 30 * time.Minute, 30 * time.Minute}
+	for i, w := range want {
+		if got := probeBackoff(i + 1); got != w {
+			t.Errorf("probeBackoff(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package envoy
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/hotschmoe/protectorate/internal/egress"
+	"github.com/hotschmoe/protectorate/internal/protocol"
+)
+
+const (
+	// proxyRefreshInterval limits how often an unknown client address makes
+	// the proxy re-list sleeve containers.
+	proxyRefreshInterval = 5 * time.Second
+
+	// proxyNewSleeveInterval limits re-listing while a running sleeve has not
+	// been seen yet, which lasts as long as the sleeve's container is gone.
+	proxyNewSleeveInterval = 1 * time.Second
+)
+
+// SleeveProxy is envoy's forward proxy for sleeves. It recognises each sleeve
+// by its container's IP address, applies that sleeve's egress policy on top
+// of the global one, and records every request in the audit log.
+type SleeveProxy struct {
+	cfg      *LiveConfig
+	docker   *DockerClient
+	sleeves  *SleeveManager
+	auditLog *AuditLog
+	server   *http.Server
+
+	// list returns sleeve containers; tests replace it.
+	list func() ([]types.Container, error)
+
+	mu          sync.Mutex
+	containers  map[string]string // IP -> short container ID
+	seen        map[string]bool   // short container IDs as of the last refresh
+	lastRefresh time.Time
+}
+
+func NewSleeveProxy(cfg *LiveConfig, docker *DockerClient, sleeves *SleeveManager, auditLog *AuditLog) *SleeveProxy {
+	p := &SleeveProxy{
+		cfg:        cfg,
+		docker:     docker,
+		sleeves:    sleeves,
+		auditLog:   auditLog,
+		list:       docker.ListSleeveContainers,
+		containers: make(map[string]string),
+		seen:       make(map[string]bool),
+	}
+	p.server = &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Load().Proxy.Port),
+		Handler:           egress.New(p.policy, p.blocked, p.record),
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+	return p
+}
+
+func (p *SleeveProxy) Run() {
+	if p.cfg.Load().Proxy.Port <= 0 {
+		return
+	}
+
+	log.Printf("sleeve proxy listening on %s", p.server.Addr)
+	if err := p.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Printf("sleeve proxy: %v", err)
+	}
+}
+
+func (p *SleeveProxy) Stop() {
+	p.server.Close()
+}
+
+// policy returns the policy for the sleeve at remoteAddr: its own allowlist
+// if it has one, else the global one, and the global denylist plus its own.
+// Clients that are not sleeves get the global policy.
+func (p *SleeveProxy) policy(remoteAddr string) egress.Policy {
+	conf := p.cfg.Load().Proxy
+	policy := egress.Policy{
+		Allow: conf.Allow,
+		Deny:  conf.Deny,
+	}
+
+	sl := p.sleeveFor(remoteAddr)
+	if sl == nil {
+		return policy
+	}
+	if len(sl.Egress) > 0 {
+		policy.Allow = sl.Egress
+	}
+	if len(sl.EgressDeny) > 0 {
+		policy.Deny = append(append([]string(nil), conf.Deny...), sl.EgressDeny...)
+	}
+	return policy
+}
+
+// blocked refuses, on top of the addresses the egress proxy always refuses,
+// every sleeve container, and envoy's API port and the sleeves' ttyd ports on
+// any address, since the host may publish them on a public one.
+func (p *SleeveProxy) blocked(addr netip.AddrPort) bool {
+	port := int(addr.Port())
+	if port == p.cfg.Load().Port {
+		return true
+	}
+	for _, sl := range p.sleeves.List() {
+		if sl.TTYDPort == port {
+			return true
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.containers[addr.Addr().String()]
+	return ok
+}
+
+// record writes a finished request to the audit log.
+func (p *SleeveProxy) record(req egress.Request) {
+	ip := clientIP(req.Client)
+	actor := ip
+	if sl := p.sleeveFor(req.Client); sl != nil {
+		actor = "sleeve:" + sl.Name
+	}
+
+	verdict := "allowed"
+	if !req.Allowed {
+		verdict = "denied"
+	}
+	proxyRequests.WithLabelValues(verdict).Inc()
+	proxyBytes.WithLabelValues("out").Add(float64(req.BytesOut))
+	proxyBytes.WithLabelValues("in").Add(float64(req.BytesIn))
+
+	p.auditLog.Record(protocol.AuditEntry{
+		Actor:    actor,
+		SourceIP: ip,
+		Action:   "proxy.request",
+		Target:   req.Host,
+		Details: map[string]string{
+			"method":      req.Method,
+			"verdict":     verdict,
+			"bytes_out":   strconv.FormatInt(req.BytesOut, 10),
+			"bytes_in":    strconv.FormatInt(req.BytesIn, 10),
+			"duration_ms": strconv.FormatInt(req.Duration.Milliseconds(), 10),
+		},
+		Outcome: outcomeLabel(req.Err),
+		Error:   errString(req.Err),
+	})
+}
+
+// sleeveFor returns the sleeve whose container has remoteAddr's IP, or nil.
+func (p *SleeveProxy) sleeveFor(remoteAddr string) *protocol.SleeveInfo {
+	id, sleeves := p.containerFor(remoteAddr)
+	if id == "" {
+		return nil
+	}
+	for _, sl := range sleeves {
+		if sl.ContainerID == id {
+			return sl
+		}
+	}
+	return nil
+}
+
+// containerFor returns the short ID of the sleeve container, claimed or
+// warm, that has remoteAddr's IP, along with the sleeves it was matched
+// against. Container addresses are re-listed at most every
+// proxyNewSleeveInterval while a running sleeve has not been seen yet, so a
+// new sleeve is soon recognised, and otherwise at most every
+// proxyRefreshInterval for unknown addresses. The API calls this on every
+// request, so it must not make a Docker call for each one.
+func (p *SleeveProxy) containerFor(remoteAddr string) (string, []*protocol.SleeveInfo) {
+	ip := clientIP(remoteAddr)
+	sleeves := p.sleeves.List()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	id, ok := p.containers[ip]
+
+	stale := !ok && time.Since(p.lastRefresh) >= proxyRefreshInterval
+	if time.Since(p.lastRefresh) >= proxyNewSleeveInterval {
+		for _, sl := range sleeves {
+			if sl.Status == "running" && sl.ContainerID != "" && !p.seen[sl.ContainerID] {
+				stale = true
+			}
+		}
+	}
+	if stale {
+		p.refresh()
+		id = p.containers[ip]
+	}
+	return id, sleeves
+}
+
+// refresh rebuilds the IP to container map. p.mu must be held.
+func (p *SleeveProxy) refresh() {
+	p.lastRefresh = time.Now()
+
+	containers, err := p.list()
+	if err != nil {
+		log.Printf("sleeve proxy: failed to list sleeves: %v", err)
+		return
+	}
+	p.containers = make(map[string]string)
+	p.seen = make(map[string]bool)
+	for _, c := range containers {
+		id := c.ID[:12]
+		p.seen[id] = true
+		if c.NetworkSettings == nil {
+			continue
+		}
+		for _, ep := range c.NetworkSettings.Networks {
+			if ep != nil && ep.IPAddress != "" {
+				p.containers[ep.IPAddress] = id
+			}
+		}
+	}
+}
+
+func clientIP(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
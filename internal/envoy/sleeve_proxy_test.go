@@ -0,0 +1,63 @@
+package envoy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/hotschmoe/protectorate/internal/config"
+	"github.com/hotschmoe/protectorate/internal/protocol"
+)
+
+func TestProxyContainerListRateLimited(t *testing.T) {
+	cfg := NewLiveConfig(&config.EnvoyConfig{})
+	sleeves := NewSleeveManager(nil, cfg, nil, nil)
+	sleeves.sleeves["quell"] = &protocol.SleeveInfo{Name: "quell", ContainerID: "aaaaaaaaaaaa", Status: "running"}
+	// Running but its container is gone, so it is never seen.
+	sleeves.sleeves["rei"] = &protocol.SleeveInfo{Name: "rei", ContainerID: "bbbbbbbbbbbb", Status: "running"}
+	sleeves.sleeves["iris"] = &protocol.SleeveInfo{Name: "iris", ContainerID: "cccccccccccc", Status: "hibernated"}
+
+	p := NewSleeveProxy(cfg, nil, sleeves, nil)
+	calls := 0
+	p.list = func() ([]types.Container, error) {
+		calls++
+		return []types.Container{{
+			ID: "aaaaaaaaaaaa0000",
+			NetworkSettings: &types.SummaryNetworkSettings{
+				Networks: map[string]*network.EndpointSettings{"protectorate": {IPAddress: "172.18.0.2"}},
+			},
+		}}, nil
+	}
+
+	for i := 0; i < 100; i++ {
+		if id, _ := p.containerFor("172.18.0.2:40000"); id != "aaaaaaaaaaaa" {
+			t.Fatalf("containerFor = %q, want aaaaaaaaaaaa", id)
+		}
+		if id, _ := p.containerFor("192.168.1.20:40000"); id != "" {
+			t.Fatalf("containerFor = %q for a client that is not a sleeve", id)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("listed containers %d times, want 1", calls)
+	}
+
+	// Once the interval has passed, the unseen running sleeve allows one more.
+	p.lastRefresh = time.Now().Add(-2 * proxyNewSleeveInterval)
+	for i := 0; i < 100; i++ {
+		p.containerFor("192.168.1.20:40000")
+	}
+	if calls != 2 {
+		t.Errorf("listed containers %d times, want 2", calls)
+	}
+
+	// Without unseen running sleeves, known addresses never list again.
+	delete(sleeves.sleeves, "rei")
+	p.lastRefresh = time.Now().Add(-2 * proxyRefreshInterval)
+	for i := 0; i < 100; i++ {
+		p.containerFor("172.18.0.2:40000")
+	}
+	if calls != 2 {
+		t.Errorf("listed containers %d times, want 2", calls)
+	}
+}
@@ -0,0 +1,256 @@
+package envoy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hotschmoe/protectorate/internal/protocol"
+)
+
+const (
+	// secretsDir is the tmpfs file secrets are written to inside a sleeve.
+	// Being tmpfs, it is never committed on hibernate and is emptied when
+	// the container stops, so secrets are rewritten whenever it starts.
+	secretsDir = "/run/secrets"
+	// credentialsSecretFile holds CREDENTIALS_SECRET; credentialsPath is a
+	// link to it.
+	credentialsSecretFile = ".claude-credentials.json"
+)
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// secretFile returns the file a ref is delivered to, if any.
+func secretFile(ref protocol.SecretRef) string {
+	if ref.Env == "" && ref.File == "" {
+		return ref.Name
+	}
+	return ref.File
+}
+
+// mergeSecrets adds refs to base; a ref delivered to the same env var or file
+// as one in base replaces it.
+func mergeSecrets(base, refs []protocol.SecretRef) []protocol.SecretRef {
+	var merged []protocol.SecretRef
+	for _, b := range base {
+		replaced := false
+		for _, r := range refs {
+			if (b.Env != "" && b.Env == r.Env) || (secretFile(b) != "" && secretFile(b) == secretFile(r)) {
+				replaced = true
+			}
+		}
+		if !replaced {
+			merged = append(merged, b)
+		}
+	}
+	return append(merged, refs...)
+}
+
+// validateSecrets checks the spec's secret refs and gives refs with no
+// delivery a file named after the secret.
+func (s *sleeveSpec) validateSecrets() error {
+	refs := make([]protocol.SecretRef, len(s.Secrets))
+	for i, ref := range s.Secrets {
+		if !secretNamePattern.MatchString(ref.Name) {
+			return fmt.Errorf("invalid secret name %q", ref.Name)
+		}
+		if ref.Env != "" && !envNamePattern.MatchString(ref.Env) {
+			return fmt.Errorf("invalid env var %q for secret %q", ref.Env, ref.Name)
+		}
+		ref.File = secretFile(ref)
+		if ref.File != "" && (!secretNamePattern.MatchString(ref.File) || ref.File == credentialsSecretFile) {
+			return fmt.Errorf("invalid file %q for secret %q: must be a plain file name", ref.File, ref.Name)
+		}
+		refs[i] = ref
+	}
+	s.Secrets = refs
+	return nil
+}
+
+// secretEnv returns KEY=value for each of sleeve's env-delivered secrets.
+func (m *SleeveManager) secretEnv(sleeve string, refs []protocol.SecretRef) ([]string, error) {
+	var env []string
+	for _, ref := range refs {
+		if ref.Env == "" {
+			continue
+		}
+		value, err := m.secrets.Value(ref.Name, sleeve)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, ref.Env+"="+value)
+	}
+	return env, nil
+}
+
+// needsSecretsDir reports whether a container gets the secrets tmpfs.
+func (m *SleeveManager) needsSecretsDir(refs []protocol.SecretRef) bool {
+	if m.cfg.Load().Docker.CredentialsSecret != "" {
+		return true
+	}
+	for _, ref := range refs {
+		if ref.File != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeSecretFiles writes sleeve's file-delivered secrets, and with
+// credentials the CREDENTIALS_SECRET, into its running container.
+func (m *SleeveManager) writeSecretFiles(sleeve, containerID string, refs []protocol.SecretRef, credentials bool) error {
+	for _, ref := range refs {
+		if ref.File == "" {
+			continue
+		}
+		value, err := m.secrets.Value(ref.Name, sleeve)
+		if err != nil {
+			return err
+		}
+		if err := m.writeSecretFile(containerID, ref.File, value); err != nil {
+			return fmt.Errorf("failed to write secret %q: %w", ref.Name, err)
+		}
+	}
+
+	name := m.cfg.Load().Docker.CredentialsSecret
+	if !credentials || name == "" {
+		return nil
+	}
+	// A missing credentials secret leaves the sleeve to log in, as the
+	// readiness check reports, rather than failing the spawn.
+	if _, err := m.secrets.Get(name); err != nil {
+		log.Printf("sleeve %s: not writing credentials: CREDENTIALS_SECRET %s is not in the secrets store", sleeve, name)
+		return nil
+	}
+	// Credentials go to every sleeve, so the secret's scope does not apply.
+	value, err := m.secrets.value(name)
+	if err != nil {
+		return fmt.Errorf("credentials: %w", err)
+	}
+	if err := m.writeSecretFile(containerID, credentialsSecretFile, value); err != nil {
+		return fmt.Errorf("failed to write credentials: %w", err)
+	}
+	link := []string{"sh", "-c", `mkdir -p "$(dirname "$2")" && ln -sfn "$1" "$2"`,
+		"sh", filepath.Join(secretsDir, credentialsSecretFile), credentialsPath}
+	if _, err := m.docker.ExecCommand(containerID, sleeveUser, link); err != nil {
+		return fmt.Errorf("failed to link credentials: %w", err)
+	}
+	return nil
+}
+
+// writeSecretFile replaces file in the secrets tmpfs with value, readable
+// only by the sleeve user. The value is passed in the exec's env rather than
+// its command line, and renamed into place so readers never see a partial
+// value during rotation.
+func (m *SleeveManager) writeSecretFile(containerID, file, value string) error {
+	res, err := m.docker.Exec(context.Background(), containerID, ExecOptions{
+		User: "root",
+		Env:  []string{"SECRET_VALUE=" + value},
+		Cmd: []string{"sh", "-c",
+			`umask 077 && printf '%s' "$SECRET_VALUE" > "$1.tmp" && chown "$2" "$1.tmp" && mv -f "$1.tmp" "$1"`,
+			"sh", filepath.Join(secretsDir, file), sleeveUser},
+	})
+	if err != nil {
+		return err
+	}
+	if res.ExitCode != 0 {
+		return fmt.Errorf("command exited with code %d: %s", res.ExitCode, strings.TrimSpace(res.Stderr))
+	}
+	return nil
+}
+
+// refreshSecretFiles rewrites a started sleeve's file secrets, which were
+// lost with its tmpfs when the container stopped.
+func (m *SleeveManager) refreshSecretFiles(sleeve *protocol.SleeveInfo) error {
+	if !m.needsSecretsDir(sleeve.Secrets) {
+		return nil
+	}
+	return m.writeSecretFiles(sleeve.Name, sleeve.ContainerID, sleeve.Secrets, true)
+}
+
+// RotateSecret delivers a secret's new value to the running sleeves that
+// have it as a file, and for CREDENTIALS_SECRET to the warm pool too. Env
+// vars cannot change in a running container and a paused one cannot be
+// written to, so those sleeves are reported as stale.
+func (m *SleeveManager) RotateSecret(secret string) (updated, stale []string, errs map[string]string) {
+	credentials := secret == m.cfg.Load().Docker.CredentialsSecret
+	errs = make(map[string]string)
+
+	for _, sl := range m.List() {
+		var files []protocol.SecretRef
+		inEnv := false
+		for _, ref := range sl.Secrets {
+			if ref.Name != secret {
+				continue
+			}
+			if ref.File != "" {
+				files = append(files, ref)
+			}
+			if ref.Env != "" {
+				inEnv = true
+			}
+		}
+		inFile := len(files) > 0 || credentials
+
+		// Hibernated sleeves get the current value when woken, and stopped
+		// ones get their files when started.
+		switch {
+		case inEnv && sl.Status != "hibernated":
+			stale = append(stale, sl.Name)
+		case inFile && sl.Status == "paused":
+			stale = append(stale, sl.Name)
+		}
+		if !inFile || sl.Status != "running" {
+			continue
+		}
+
+		if err := m.writeSecretFiles(sl.Name, sl.ContainerID, files, credentials); err != nil {
+			errs[sl.Name] = err.Error()
+			continue
+		}
+		updated = append(updated, sl.Name)
+	}
+
+	if credentials && m.pool != nil {
+		m.pool.rotateCredentials()
+	}
+
+	sort.Strings(updated)
+	sort.Strings(stale)
+	return updated, stale, errs
+}
+
+// SecretUsers returns the sleeves a secret is delivered to.
+func (m *SleeveManager) SecretUsers(secret string) []string {
+	var users []string
+	credentials := secret == m.cfg.Load().Docker.CredentialsSecret
+	for _, sl := range m.List() {
+		uses := credentials
+		for _, ref := range sl.Secrets {
+			if ref.Name == secret {
+				uses = true
+			}
+		}
+		if uses {
+			users = append(users, sl.Name)
+		}
+	}
+	sort.Strings(users)
+	return users
+}
+
+// secretEnvScrub blanks the spec's env-delivered secrets, for committing a
+// container to an image that must not carry their values.
+func (s *sleeveSpec) secretEnvScrub() []string {
+	var env []string
+	for _, ref := range s.Secrets {
+		if ref.Env != "" {
+			env = append(env, ref.Env+"=")
+		}
+	}
+	return env
+}
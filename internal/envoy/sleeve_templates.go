@@ -0,0 +1,237 @@
+package envoy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	units "github.com/docker/go-units"
+	"github.com/hotschmoe/protectorate/internal/config"
+	"github.com/hotschmoe/protectorate/internal/protocol"
+)
+
+// sleeveSpec is a resolved spawn spec: the template, if any, with the
+// request's overrides applied. It is stored on the container as the
+// protectorate.spec label (without the prompt) so a hibernated or resleeved
+// sleeve can be recreated with the same image, env, limits and mounts.
+type sleeveSpec struct {
+	Template  string                   `json:"template,omitempty"`
+	Image     string                   `json:"image"`
+	Profile   string                   `json:"profile,omitempty"`
+	Env       map[string]string        `json:"env,omitempty"`
+	Resources protocol.SleeveResources `json:"resources"`
+	Mounts    []config.TemplateMount   `json:"mounts,omitempty"`
+	Network   string                   `json:"network,omitempty"`
+	Prompt    string                   `json:"-"`
+
+	NetworkPolicy string   `json:"network_policy,omitempty"`
+	Egress        []string `json:"egress,omitempty"`
+	EgressDeny    []string `json:"egress_deny,omitempty"`
+
+	Secrets []protocol.SecretRef `json:"secrets,omitempty"`
+}
+
+// profiles are the CLIs a sleeve's sidecar can run as SLEEVE_CLI.
+var profiles = map[string]bool{
+	"claude-code": true,
+	"gemini-cli":  true,
+	"opencode":    true,
+}
+
+// validateProfile accepts the empty profile, which means defaultProfile.
+func validateProfile(profile string) error {
+	if profile != "" && !profiles[profile] {
+		return fmt.Errorf("invalid profile %q: must be claude-code, gemini-cli or opencode", profile)
+	}
+	return nil
+}
+
+// Templates returns the sleeve templates, re-read from disk so edits apply
+// to the next spawn without restarting envoy.
+func (m *SleeveManager) Templates() ([]*config.SleeveTemplate, error) {
+	templates, err := config.LoadSleeveTemplates(m.cfg.Load().TemplatesDir)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*config.SleeveTemplate, 0, len(templates))
+	for _, name := range config.TemplateNames(templates) {
+		result = append(result, templates[name])
+	}
+	return result, nil
+}
+
+// resolveSpec applies req on top of its template.
+func (m *SleeveManager) resolveSpec(req protocol.SpawnSleeveRequest) (*sleeveSpec, error) {
+	spec := &sleeveSpec{
+		Image: m.cfg.Load().Docker.SleeveImage,
+		Env:   make(map[string]string),
+	}
+
+	if req.Template != "" {
+		templates, err := config.LoadSleeveTemplates(m.cfg.Load().TemplatesDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load templates: %w", err)
+		}
+		tmpl, ok := templates[req.Template]
+		if !ok {
+			return nil, fmt.Errorf("template %q not found", req.Template)
+		}
+
+		spec.Template = tmpl.Name
+		if tmpl.Image != "" {
+			spec.Image = tmpl.Image
+		}
+		spec.Profile = tmpl.Profile
+		spec.Resources = protocol.SleeveResources{
+			Memory:    tmpl.Resources.Memory,
+			CPUs:      tmpl.Resources.CPUs,
+			PidsLimit: tmpl.Resources.PidsLimit,
+		}
+		for k, v := range tmpl.Env {
+			spec.Env[k] = v
+		}
+		spec.Mounts = tmpl.Mounts
+		spec.Network = tmpl.Network
+		spec.Prompt = tmpl.Prompt
+		spec.NetworkPolicy = tmpl.NetworkPolicy
+		spec.Egress = tmpl.Egress
+		spec.EgressDeny = tmpl.EgressDeny
+		for _, sec := range tmpl.Secrets {
+			spec.Secrets = append(spec.Secrets, protocol.SecretRef{Name: sec.Name, Env: sec.Env, File: sec.File})
+		}
+	}
+
+	if req.Image != "" {
+		spec.Image = req.Image
+	}
+	if req.Profile != "" {
+		spec.Profile = req.Profile
+	}
+	if req.Resources != nil {
+		if req.Resources.Memory != "" {
+			spec.Resources.Memory = req.Resources.Memory
+		}
+		if req.Resources.CPUs != 0 {
+			spec.Resources.CPUs = req.Resources.CPUs
+		}
+		if req.Resources.PidsLimit != 0 {
+			spec.Resources.PidsLimit = req.Resources.PidsLimit
+		}
+	}
+	for k, v := range req.Env {
+		spec.Env[k] = v
+	}
+	if req.Network != "" {
+		spec.Network = req.Network
+	}
+	if req.Prompt != "" {
+		spec.Prompt = req.Prompt
+	}
+	if req.NetworkPolicy != "" {
+		spec.NetworkPolicy = req.NetworkPolicy
+	}
+	if req.Egress != nil {
+		spec.Egress = req.Egress
+	}
+	if req.EgressDeny != nil {
+		spec.EgressDeny = req.EgressDeny
+	}
+	spec.Secrets = mergeSecrets(spec.Secrets, req.Secrets)
+
+	if err := validateProfile(spec.Profile); err != nil {
+		return nil, err
+	}
+	if _, err := spec.resources(); err != nil {
+		return nil, err
+	}
+	if err := spec.validateNetwork(); err != nil {
+		return nil, err
+	}
+	if err := spec.validateSecrets(); err != nil {
+		return nil, err
+	}
+
+	return spec, nil
+}
+
+// poolable reports whether a warm pool sleeve, which runs the default image
+// on the shared network with no limits, extra env or mounts, can stand in
+// for this spec.
+func (s *sleeveSpec) poolable(defaultImage string) bool {
+	return s.Image == defaultImage &&
+		s.Resources == (protocol.SleeveResources{}) &&
+		len(s.Env) == 0 &&
+		len(s.Mounts) == 0 &&
+		s.Network == "" &&
+		s.networkPolicy() == networkShared &&
+		len(s.EgressDeny) == 0 &&
+		len(s.Secrets) == 0
+}
+
+func (s *sleeveSpec) resources() (container.Resources, error) {
+	var res container.Resources
+
+	if s.Resources.Memory != "" {
+		mem, err := units.RAMInBytes(s.Resources.Memory)
+		if err != nil {
+			return res, fmt.Errorf("invalid memory limit %q: %w", s.Resources.Memory, err)
+		}
+		res.Memory = mem
+	}
+	if s.Resources.CPUs < 0 || s.Resources.PidsLimit < 0 {
+		return res, fmt.Errorf("invalid resources: limits must not be negative")
+	}
+	if s.Resources.CPUs > 0 {
+		res.NanoCPUs = int64(s.Resources.CPUs * 1e9)
+	}
+	if s.Resources.PidsLimit > 0 {
+		pids := s.Resources.PidsLimit
+		res.PidsLimit = &pids
+	}
+
+	return res, nil
+}
+
+// envList returns the spec's env as sorted KEY=value pairs.
+func (s *sleeveSpec) envList() []string {
+	env := make([]string, 0, len(s.Env))
+	for k, v := range s.Env {
+		env = append(env, k+"="+v)
+	}
+	sort.Strings(env)
+	return env
+}
+
+func (s *sleeveSpec) label() string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+// specFromLabel recovers the spec stored on a container, if any.
+func specFromLabel(labels map[string]string) *sleeveSpec {
+	spec := &sleeveSpec{Profile: labels["protectorate.profile"]}
+	if raw := labels["protectorate.spec"]; raw != "" {
+		json.Unmarshal([]byte(raw), spec)
+	}
+	return spec
+}
+
+func (s *sleeveSpec) template() string {
+	if s == nil {
+		return ""
+	}
+	return s.Template
+}
+
+// sendStartupPrompt types the spec's prompt into a new sleeve once its CLI
+// has had time to start.
+func (m *SleeveManager) sendStartupPrompt(name, prompt string) {
+	time.Sleep(taskDeliveryDelay)
+	if err := m.SendPrompt(name, prompt); err != nil {
+		log.Printf("sleeve %s: failed to send startup prompt: %v", name, err)
+	}
+}
@@ -0,0 +1,384 @@
+package envoy
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hotschmoe/protectorate/internal/needlecast"
+	"github.com/hotschmoe/protectorate/internal/protocol"
+)
+
+const (
+	taskSchedulerInterval = 5 * time.Second
+
+	// taskDeliveryDelay gives a sleeve's CLI time to boot before a prompt is
+	// typed into it.
+	taskDeliveryDelay = 15 * time.Second
+
+	// taskRetention is how long finished tasks are kept in memory.
+	taskRetention = 24 * time.Hour
+
+	// taskQueueTimeout is how long a task waits for its workspace's sleeve
+	// to come back from being stopped, paused or hibernated, or for room to
+	// spawn one under ENVOY_MAX_SLEEVES.
+	taskQueueTimeout = 30 * time.Minute
+)
+
+// TaskManager queues work items and dispatches them to sleeves. A queued task
+// is assigned to an idle sleeve on its workspace (spawning one if none
+// exists), delivered via tmux or the needlecast inbox, and completed either by
+// an explicit update or when the sleeve's .cstack/ reports "done".
+type TaskManager struct {
+	mu      sync.Mutex
+	cfg     *LiveConfig
+	sleeves *SleeveManager
+	tasks   map[string]*protocol.Task
+	order   []string
+	wake    chan struct{}
+	stop    chan struct{}
+}
+
+func NewTaskManager(cfg *LiveConfig, sleeves *SleeveManager) *TaskManager {
+	return &TaskManager{
+		cfg:     cfg,
+		sleeves: sleeves,
+		tasks:   make(map[string]*protocol.Task),
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+	}
+}
+
+func (tm *TaskManager) Create(req protocol.CreateTaskRequest) (*protocol.Task, error) {
+	if req.Prompt == "" {
+		return nil, fmt.Errorf("prompt required")
+	}
+	if req.Workspace == "" {
+		return nil, fmt.Errorf("workspace required")
+	}
+	if _, err := os.Stat(req.Workspace); os.IsNotExist(err) {
+		return nil, fmt.Errorf("workspace %q does not exist", req.Workspace)
+	}
+	if err := validateProfile(req.Profile); err != nil {
+		return nil, err
+	}
+
+	delivery := req.Delivery
+	if delivery == "" {
+		delivery = "tmux"
+	}
+	if delivery != "tmux" && delivery != "inbox" {
+		return nil, fmt.Errorf("invalid delivery: must be 'tmux' or 'inbox'")
+	}
+
+	task := &protocol.Task{
+		ID:        generateJobID(),
+		Prompt:    req.Prompt,
+		Workspace: req.Workspace,
+		Profile:   req.Profile,
+		Delivery:  delivery,
+		Status:    "queued",
+		CreatedAt: time.Now(),
+	}
+
+	tm.mu.Lock()
+	tm.tasks[task.ID] = task
+	tm.order = append(tm.order, task.ID)
+	snapshot := *task
+	tm.mu.Unlock()
+
+	tm.notify()
+	return &snapshot, nil
+}
+
+func (tm *TaskManager) List() []*protocol.Task {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	result := make([]*protocol.Task, 0, len(tm.order))
+	for _, id := range tm.order {
+		snapshot := *tm.tasks[id]
+		result = append(result, &snapshot)
+	}
+	return result
+}
+
+func (tm *TaskManager) Get(id string) (*protocol.Task, error) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	task, ok := tm.tasks[id]
+	if !ok {
+		return nil, fmt.Errorf("task %q not found", id)
+	}
+	snapshot := *task
+	return &snapshot, nil
+}
+
+// Update records a task's outcome as reported by the agent or a user.
+func (tm *TaskManager) Update(id string, req protocol.UpdateTaskRequest) (*protocol.Task, error) {
+	if req.Status != "done" && req.Status != "failed" {
+		return nil, fmt.Errorf("invalid status: must be 'done' or 'failed'")
+	}
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	task, ok := tm.tasks[id]
+	if !ok {
+		return nil, fmt.Errorf("task %q not found", id)
+	}
+	if isTaskFinished(task) {
+		return nil, fmt.Errorf("task %q already %s", id, task.Status)
+	}
+
+	task.Status = req.Status
+	task.Result = req.Result
+	task.Error = req.Error
+	task.CompletedAt = time.Now()
+
+	snapshot := *task
+	tm.notify()
+	return &snapshot, nil
+}
+
+// Cancel fails a task that has not finished yet.
+func (tm *TaskManager) Cancel(id string) error {
+	_, err := tm.Update(id, protocol.UpdateTaskRequest{Status: "failed", Error: "cancelled"})
+	return err
+}
+
+func (tm *TaskManager) Run() {
+	ticker := time.NewTicker(taskSchedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-tm.wake:
+		case <-tm.stop:
+			return
+		}
+		tm.schedule()
+		tm.cleanupFinished()
+	}
+}
+
+func (tm *TaskManager) Stop() {
+	close(tm.stop)
+}
+
+func (tm *TaskManager) notify() {
+	select {
+	case tm.wake <- struct{}{}:
+	default:
+	}
+}
+
+// schedule advances every unfinished task by at most one state.
+func (tm *TaskManager) schedule() {
+	pending := make([]protocol.Task, 0)
+	busy := make(map[string]bool)
+
+	tm.mu.Lock()
+	for _, id := range tm.order {
+		task := tm.tasks[id]
+		if isTaskFinished(task) {
+			continue
+		}
+		pending = append(pending, *task)
+		if task.Sleeve != "" {
+			busy[task.Sleeve] = true
+		}
+	}
+	tm.mu.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+
+	sleeves := make(map[string]*protocol.SleeveInfo)
+	for _, sl := range tm.sleeves.List() {
+		sleeves[sl.Name] = sl
+	}
+
+	for _, task := range pending {
+		switch task.Status {
+		case "queued":
+			tm.assign(task, sleeves, busy)
+		case "assigned":
+			tm.deliver(task, sleeves[task.Sleeve])
+		case "running":
+			tm.checkRunning(task, sleeves[task.Sleeve])
+		}
+	}
+}
+
+func (tm *TaskManager) assign(task protocol.Task, sleeves map[string]*protocol.SleeveInfo, busy map[string]bool) {
+	// A workspace is only ever driven by one sleeve. A task waits for a busy
+	// one to free up, and for a while for one that is not running; one
+	// running another profile can never take it.
+	var mismatched, waiting *protocol.SleeveInfo
+	for _, sl := range sleeves {
+		if sl.Workspace != task.Workspace {
+			continue
+		}
+		if task.Profile != "" && profileOrDefault(sl.Profile) != profileOrDefault(task.Profile) {
+			mismatched = sl
+			continue
+		}
+		if sl.Status != "running" || busy[sl.Name] {
+			if waiting == nil || waiting.Status != "running" {
+				waiting = sl
+			}
+			continue
+		}
+
+		busy[sl.Name] = true
+		tm.transition(task.ID, "queued", func(t *protocol.Task) {
+			t.Status = "assigned"
+			t.Sleeve = sl.Name
+			t.AssignedAt = time.Now()
+		})
+		return
+	}
+
+	switch {
+	case waiting != nil && waiting.Status == "running":
+		return
+	case waiting != nil:
+		if time.Since(task.CreatedAt) > taskQueueTimeout {
+			tm.fail(task.ID, "queued", fmt.Sprintf("timed out waiting for sleeve %s, which is %s", waiting.Name, waiting.Status))
+		}
+		return
+	case mismatched != nil:
+		tm.fail(task.ID, "queued", fmt.Sprintf("workspace is driven by sleeve %s, which runs %s, not %s",
+			mismatched.Name, profileOrDefault(mismatched.Profile), task.Profile))
+		return
+	}
+
+	if limit := tm.cfg.Load().MaxSleeves; len(sleeves) >= limit {
+		if time.Since(task.CreatedAt) > taskQueueTimeout {
+			tm.fail(task.ID, "queued", fmt.Sprintf("timed out waiting for a sleeve: all %d allowed sleeves are in use", limit))
+		}
+		return
+	}
+
+	sleeve, err := tm.sleeves.Spawn(protocol.SpawnSleeveRequest{
+		Workspace: task.Workspace,
+		Profile:   task.Profile,
+	})
+	if err != nil {
+		log.Printf("task %s: failed to spawn sleeve: %v", task.ID, err)
+		tm.fail(task.ID, "queued", fmt.Sprintf("failed to spawn sleeve: %v", err))
+		return
+	}
+
+	sleeves[sleeve.Name] = sleeve
+	busy[sleeve.Name] = true
+	tm.transition(task.ID, "queued", func(t *protocol.Task) {
+		t.Status = "assigned"
+		t.Sleeve = sleeve.Name
+		t.AssignedAt = time.Now()
+	})
+}
+
+func (tm *TaskManager) deliver(task protocol.Task, sleeve *protocol.SleeveInfo) {
+	if sleeve == nil {
+		tm.fail(task.ID, "assigned", "sleeve terminated before delivery")
+		return
+	}
+	if sleeve.Status != "running" || time.Since(sleeve.SpawnTime) < taskDeliveryDelay {
+		return
+	}
+
+	var err error
+	switch task.Delivery {
+	case "inbox":
+		err = needlecast.WriteInbox(task.Workspace, protocol.Message{
+			ID:      "task-" + task.ID,
+			From:    "envoy",
+			To:      sleeve.Name,
+			Thread:  task.ID,
+			Type:    "task",
+			Content: task.Prompt,
+		})
+	default:
+		err = tm.sleeves.SendPrompt(sleeve.Name, task.Prompt)
+	}
+
+	if err != nil {
+		log.Printf("task %s: delivery to %s failed: %v", task.ID, sleeve.Name, err)
+		tm.fail(task.ID, "assigned", fmt.Sprintf("delivery failed: %v", err))
+		return
+	}
+
+	tm.transition(task.ID, "assigned", func(t *protocol.Task) {
+		t.Status = "running"
+		t.StartedAt = time.Now()
+	})
+}
+
+func (tm *TaskManager) checkRunning(task protocol.Task, sleeve *protocol.SleeveInfo) {
+	if sleeve == nil {
+		tm.fail(task.ID, "running", "sleeve terminated")
+		return
+	}
+
+	// The sleeve's cached status is only refreshed every POLL_INTERVAL, which
+	// is far too slow to notice a task finishing, so read the workspace.
+	status, err := readAgentStatus(sleeve.Workspace)
+	if err != nil || status == nil || status.State != "done" || !status.LastActivity.After(task.StartedAt) {
+		return
+	}
+
+	tm.transition(task.ID, "running", func(t *protocol.Task) {
+		t.Status = "done"
+		t.Result = status.CurrentTask
+		t.CompletedAt = time.Now()
+	})
+}
+
+// transition applies fn to the task only if it is still in state from, so
+// that scheduler work done outside the lock can't clobber an API update.
+func (tm *TaskManager) transition(id, from string, fn func(t *protocol.Task)) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	task, ok := tm.tasks[id]
+	if !ok || task.Status != from {
+		return
+	}
+	fn(task)
+}
+
+func (tm *TaskManager) fail(id, from, msg string) {
+	tm.transition(id, from, func(t *protocol.Task) {
+		t.Status = "failed"
+		t.Error = msg
+		t.CompletedAt = time.Now()
+	})
+}
+
+func (tm *TaskManager) cleanupFinished() {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	cutoff := time.Now().Add(-taskRetention)
+	kept := tm.order[:0]
+	for _, id := range tm.order {
+		task := tm.tasks[id]
+		if isTaskFinished(task) && task.CompletedAt.Before(cutoff) {
+			delete(tm.tasks, id)
+			continue
+		}
+		kept = append(kept, id)
+	}
+	tm.order = kept
+}
+
+func isTaskFinished(t *protocol.Task) bool {
+	return t.Status == "done" || t.Status == "failed"
+}
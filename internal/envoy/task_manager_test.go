@@ -0,0 +1,34 @@
+package envoy
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hotschmoe/protectorate/internal/config"
+	"github.com/hotschmoe/protectorate/internal/protocol"
+)
+
+func TestTaskQueuedAtSleeveLimitTimesOut(t *testing.T) {
+	cfg := NewLiveConfig(&config.EnvoyConfig{MaxSleeves: 1})
+	sleeves := NewSleeveManager(nil, cfg, nil, nil)
+	sleeves.sleeves["quell"] = &protocol.SleeveInfo{Name: "quell", Workspace: "/workspaces/other", Status: "running"}
+	tm := NewTaskManager(cfg, sleeves)
+
+	add := func(id string, created time.Time) {
+		tm.tasks[id] = &protocol.Task{ID: id, Workspace: "/workspaces/api", Status: "queued", CreatedAt: created}
+		tm.order = append(tm.order, id)
+	}
+	add("fresh", time.Now())
+	add("stale", time.Now().Add(-taskQueueTimeout-time.Minute))
+
+	tm.schedule()
+
+	if task, _ := tm.Get("fresh"); task.Status != "queued" {
+		t.Errorf("fresh task is %s, want queued", task.Status)
+	}
+	task, _ := tm.Get("stale")
+	if task.Status != "failed" || !strings.Contains(task.Error, "all 1 allowed sleeves are in use") {
+		t.Errorf("stale task is %s (%q), want failed for the sleeve limit", task.Status, task.Error)
+	}
+}
@@ -0,0 +1,207 @@
+package envoy
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hotschmoe/protectorate/internal/gitea"
+	"github.com/hotschmoe/protectorate/internal/protocol"
+)
+
+// Identity for the initial commit envoy makes when publishing a workspace
+// that is not yet a git repository.
+const (
+	envoyGitName  = "Protectorate Envoy"
+	envoyGitEmail = "envoy@protectorate.local"
+)
+
+// giteaClient returns a client for the current Gitea settings, which can
+// change on a config reload.
+func (wm *WorkspaceManager) giteaClient() *gitea.Client {
+	return gitea.NewClient(wm.cfg.Load().Gitea)
+}
+
+// GiteaRepos lists the repositories the configured Gitea user can clone.
+func (wm *WorkspaceManager) GiteaRepos() ([]gitea.Repo, error) {
+	return wm.giteaClient().ListRepos()
+}
+
+// PublishToGitea gives a workspace a home on Gitea. It creates a repository
+// named after the workspace (or reuses an existing one of that name), makes
+// it the workspace's origin and pushes all branches and tags. A workspace
+// that is not yet a git repository is initialized with a single commit of
+// its current contents. An existing origin elsewhere is kept as upstream.
+//
+// The push carries the Gitea credentials, so it is made from a bare copy of
+// the workspace, not from the workspace whose config the agent controls.
+func (wm *WorkspaceManager) PublishToGitea(req protocol.PublishWorkspaceRequest) (*gitea.Repo, error) {
+	client := wm.giteaClient()
+	if !client.Configured() {
+		return nil, gitea.ErrNotConfigured
+	}
+
+	wsPath := req.Workspace
+	if _, ok := pathWithin(wm.cfg.Load().Docker.WorkspaceRoot, wsPath); !ok {
+		return nil, fmt.Errorf("invalid workspace path %q", wsPath)
+	}
+	if _, err := os.Stat(wsPath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("workspace not found")
+	}
+
+	if _, err := os.Stat(filepath.Join(wsPath, ".git")); os.IsNotExist(err) {
+		if err := initWorkspaceRepo(wsPath); err != nil {
+			return nil, err
+		}
+	}
+
+	name := filepath.Base(wsPath)
+	repo, err := client.CreateRepo(gitea.CreateRepoOptions{
+		Name:        name,
+		Description: req.Description,
+		Private:     req.Private,
+	})
+	if gitea.IsConflict(err) {
+		var owner string
+		if owner, err = client.CurrentUser(); err == nil {
+			repo, err = client.GetRepo(owner, name)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gitea repo: %w", err)
+	}
+
+	if err := setOrigin(wsPath, repo.CloneURL); err != nil {
+		return nil, err
+	}
+
+	dataDir := wm.cfg.Load().DataDir
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return nil, err
+	}
+	bare, err := os.MkdirTemp(dataDir, "publish-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(bare)
+
+	if err := syncBareCopy(bare, wsPath); err != nil {
+		return nil, err
+	}
+	if _, err := runGitCommandEnv(bare, client.GitEnv(), "push", repo.CloneURL,
+		"refs/heads/*:refs/heads/*", "refs/tags/*:refs/tags/*"); err != nil {
+		return nil, err
+	}
+	if err := trackOrigin(wsPath); err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// trackOrigin records in the workspace what pushing its branches to origin
+// with -u would have: a remote-tracking ref for each branch, and origin as
+// its upstream.
+func trackOrigin(wsPath string) error {
+	out, err := runGitCommand(wsPath, "for-each-ref", "--format=%(refname:short) %(objectname)", "refs/heads")
+	if err != nil {
+		return fmt.Errorf("git error: failed to list branches")
+	}
+	for _, line := range strings.Split(out, "\n") {
+		branch, sha, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		if _, err := runGitCommand(wsPath, "update-ref", "refs/remotes/origin/"+branch, sha); err != nil {
+			return fmt.Errorf("git error: failed to track origin/%s", branch)
+		}
+		if _, err := runGitCommand(wsPath, "branch", "--set-upstream-to=origin/"+branch, branch); err != nil {
+			return fmt.Errorf("git error: failed to track origin/%s", branch)
+		}
+	}
+	return nil
+}
+
+// CreateOnGitea creates an empty workspace and publishes it to Gitea. The
+// workspace is removed again if publishing fails.
+func (wm *WorkspaceManager) CreateOnGitea(name string, req protocol.PublishWorkspaceRequest) (*protocol.WorkspaceInfo, *gitea.Repo, error) {
+	if !wm.giteaClient().Configured() {
+		return nil, nil, gitea.ErrNotConfigured
+	}
+
+	ws, err := wm.Create(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req.Workspace = ws.Path
+	repo, err := wm.PublishToGitea(req)
+	if err != nil {
+		os.RemoveAll(ws.Path)
+		return nil, nil, err
+	}
+	return ws, repo, nil
+}
+
+// initWorkspaceRepo turns a plain directory into a repository with one
+// commit, so there is something to push.
+func initWorkspaceRepo(wsPath string) error {
+	if _, err := runGitCommand(wsPath, "init", "-b", "main"); err != nil {
+		return fmt.Errorf("git error: failed to init repository")
+	}
+	if _, err := runGitCommand(wsPath, "add", "-A"); err != nil {
+		return fmt.Errorf("git error: failed to stage files")
+	}
+	_, err := runGitCommand(wsPath, "-c", "user.name="+envoyGitName, "-c", "user.email="+envoyGitEmail,
+		"commit", "--allow-empty", "-m", "Initial commit")
+	if err != nil {
+		return fmt.Errorf("git error: failed to create initial commit")
+	}
+	return nil
+}
+
+// setOrigin points origin at url, renaming an origin that points elsewhere
+// to upstream so the original remote is not lost.
+func setOrigin(wsPath, url string) error {
+	current, err := runGitCommand(wsPath, "remote", "get-url", "origin")
+	switch {
+	case err != nil:
+		_, err = runGitCommand(wsPath, "remote", "add", "origin", url)
+	case current == url:
+		return nil
+	default:
+		if _, err := runGitCommand(wsPath, "remote", "get-url", "upstream"); err == nil {
+			return fmt.Errorf("workspace already has origin %s and upstream remotes", current)
+		}
+		if _, err = runGitCommand(wsPath, "remote", "rename", "origin", "upstream"); err == nil {
+			_, err = runGitCommand(wsPath, "remote", "add", "origin", url)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("git error: failed to set origin to %s", url)
+	}
+	return nil
+}
+
+// runGitCommandEnv is runGitCommand with extra environment, such as Gitea
+// credentials, and git's stderr in the error.
+func runGitCommandEnv(wsPath string, env []string, args ...string) (string, error) {
+	cmd := exec.Command("git", gitArgs(wsPath, args...)...)
+	cmd.Env = append(os.Environ(), env...)
+
+	start := time.Now()
+	out, err := cmd.Output()
+	if len(args) > 0 {
+		gitCommandDuration.WithLabelValues(args[0], outcomeLabel(err)).Observe(time.Since(start).Seconds())
+	}
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("git %s failed: %s", args[0], strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("git %s failed: %w", args[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
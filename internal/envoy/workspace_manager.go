@@ -12,18 +12,17 @@ import (
 	"sync"
 	"time"
 
-	"github.com/hotschmoe/protectorate/internal/config"
 	"github.com/hotschmoe/protectorate/internal/protocol"
 )
 
 type WorkspaceManager struct {
 	mu           sync.RWMutex
-	cfg          *config.EnvoyConfig
+	cfg          *LiveConfig
 	jobs         map[string]*protocol.CloneJob
 	sleeveGetter func() []*protocol.SleeveInfo
 }
 
-func NewWorkspaceManager(cfg *config.EnvoyConfig, sleeveGetter func() []*protocol.SleeveInfo) *WorkspaceManager {
+func NewWorkspaceManager(cfg *LiveConfig, sleeveGetter func() []*protocol.SleeveInfo) *WorkspaceManager {
 	wm := &WorkspaceManager{
 		cfg:          cfg,
 		jobs:         make(map[string]*protocol.CloneJob),
@@ -34,7 +33,7 @@ func NewWorkspaceManager(cfg *config.EnvoyConfig, sleeveGetter func() []*protoco
 }
 
 func (wm *WorkspaceManager) List() ([]protocol.WorkspaceInfo, error) {
-	wsRoot := wm.cfg.Docker.WorkspaceRoot
+	wsRoot := wm.cfg.Load().Docker.WorkspaceRoot
 
 	if err := os.MkdirAll(wsRoot, 0755); err != nil {
 		return nil, err
@@ -53,7 +52,8 @@ func (wm *WorkspaceManager) List() ([]protocol.WorkspaceInfo, error) {
 
 	workspaces := make([]protocol.WorkspaceInfo, 0)
 	for _, entry := range entries {
-		if !entry.IsDir() {
+		// Hidden directories belong to envoy (e.g. the warm pool's slots).
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
 			continue
 		}
 
@@ -86,7 +86,7 @@ func (wm *WorkspaceManager) Create(name string) (*protocol.WorkspaceInfo, error)
 		return nil, fmt.Errorf("invalid workspace name")
 	}
 
-	wsPath := filepath.Join(wm.cfg.Docker.WorkspaceRoot, name)
+	wsPath := filepath.Join(wm.cfg.Load().Docker.WorkspaceRoot, name)
 
 	if _, err := os.Stat(wsPath); err == nil {
 		return nil, fmt.Errorf("workspace %q already exists", name)
@@ -108,7 +108,9 @@ func (wm *WorkspaceManager) Clone(req protocol.CloneWorkspaceRequest) (*protocol
 		return nil, fmt.Errorf("repo_url required")
 	}
 
-	if !strings.HasPrefix(req.RepoURL, "https://") {
+	// The Gitea server is trusted even over plain HTTP, as it usually sits
+	// on the same Docker network.
+	if !strings.HasPrefix(req.RepoURL, "https://") && !wm.giteaClient().Owns(req.RepoURL) {
 		return nil, fmt.Errorf("only HTTPS URLs are supported")
 	}
 
@@ -120,7 +122,7 @@ func (wm *WorkspaceManager) Clone(req protocol.CloneWorkspaceRequest) (*protocol
 		}
 	}
 
-	wsPath := filepath.Join(wm.cfg.Docker.WorkspaceRoot, wsName)
+	wsPath := filepath.Join(wm.cfg.Load().Docker.WorkspaceRoot, wsName)
 
 	if _, err := os.Stat(wsPath); err == nil {
 		return nil, fmt.Errorf("workspace %q already exists", wsName)
@@ -156,13 +158,19 @@ func (wm *WorkspaceManager) GetJob(id string) (*protocol.CloneJob, error) {
 }
 
 func (wm *WorkspaceManager) runClone(job *protocol.CloneJob) {
-	err := cloneRepo(job.RepoURL, job.Workspace)
+	var env []string
+	if client := wm.giteaClient(); client.Configured() {
+		env = client.GitEnv()
+	}
+	err := cloneRepo(job.RepoURL, job.Workspace, env)
 
 	wm.mu.Lock()
 	defer wm.mu.Unlock()
 
 	job.EndTime = time.Now()
+	cloneDuration.WithLabelValues(outcomeLabel(err)).Observe(job.EndTime.Sub(job.StartTime).Seconds())
 	if err != nil {
+		cloneFailures.Inc()
 		job.Status = "failed"
 		job.Error = err.Error()
 		os.RemoveAll(job.Workspace)
@@ -199,8 +207,11 @@ func repoNameFromURL(url string) string {
 	return ""
 }
 
-func cloneRepo(url, destPath string) error {
+// cloneRepo clones url into destPath. env adds Gitea credentials, which git
+// only sends to the Gitea server.
+func cloneRepo(url, destPath string, env []string) error {
 	cmd := exec.Command("git", "clone", url, destPath)
+	cmd.Env = append(os.Environ(), env...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
@@ -303,11 +314,53 @@ func getGitLastCommit(wsPath string) (hash, msg, timeAgo string) {
 	return parts[0], parts[1], parts[2]
 }
 
+// gitArgs prefixes args to run git in wsPath. Workspaces are writable by
+// agents, so hooks and fsmonitor, which would run agent-controlled programs
+// inside envoy with whatever credentials the command was given, are disabled.
+func gitArgs(wsPath string, args ...string) []string {
+	return append([]string{
+		// Use safe.directory to handle mounted volumes with different ownership
+		"-c", "safe.directory=" + wsPath,
+		"-c", "core.hooksPath=/dev/null",
+		"-c", "core.fsmonitor=false",
+		"-C", wsPath,
+	}, args...)
+}
+
+// syncBareCopy makes bare, a bare repository envoy owns, hold the branches
+// and tags of the repository at wsPath, creating it if needed. Anything that
+// sends credentials pushes from such a copy instead of from the workspace:
+// the agent can write the workspace's config, where insteadOf, pushurl or
+// http.proxy would send the push and its credentials elsewhere. The fetch
+// from the workspace carries no credentials, so it has nothing to leak.
+func syncBareCopy(bare, wsPath string) error {
+	if _, err := os.Stat(filepath.Join(bare, "HEAD")); err != nil {
+		if err := os.MkdirAll(bare, 0700); err != nil {
+			return err
+		}
+		if _, err := runGitCommandEnv(bare, nil, "init", "--bare", "-q"); err != nil {
+			return err
+		}
+	}
+
+	env := []string{
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=safe.directory",
+		"GIT_CONFIG_VALUE_0=" + wsPath,
+	}
+	_, err := runGitCommandEnv(bare, env, "fetch", "--prune", "--no-tags", wsPath,
+		"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*")
+	return err
+}
+
 func runGitCommand(wsPath string, args ...string) (string, error) {
-	// Use -c safe.directory to handle mounted volumes with different ownership
-	fullArgs := append([]string{"-c", "safe.directory=" + wsPath, "-C", wsPath}, args...)
-	cmd := exec.Command("git", fullArgs...)
+	cmd := exec.Command("git", gitArgs(wsPath, args...)...)
+	start := time.Now()
 	out, err := cmd.Output()
+	if len(args) > 0 {
+		gitCommandDuration.WithLabelValues(args[0], outcomeLabel(err)).Observe(time.Since(start).Seconds())
+	}
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,221 @@
+package envoy
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// workspaceSnapshot is a hibernated sleeve's workspace, archived so it can be
+// restored if the workspace is gone on wake. Its fingerprint covers every
+// entry's path, type, mode and size, and the modification time of files, so
+// a wake can tell whether the workspace changed without reading it all.
+type workspaceSnapshot struct {
+	Archive     string `json:"archive"`
+	Fingerprint string `json:"fingerprint"`
+	Files       int    `json:"files"`
+	Bytes       int64  `json:"bytes"`
+}
+
+// snapshotWorkspace archives workspace to archive as a gzipped tar. Entries
+// other than directories, regular files and symlinks are skipped.
+func snapshotWorkspace(workspace, archive string) (*workspaceSnapshot, error) {
+	if err := os.MkdirAll(filepath.Dir(archive), 0700); err != nil {
+		return nil, err
+	}
+	tmp := archive + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp)
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	snap := &workspaceSnapshot{Archive: archive}
+	hash := sha256.New()
+
+	err = walkWorkspace(workspace, hash, func(rel, path string, info fs.FileInfo, link string) error {
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = rel
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		hdr.Uname, hdr.Gname = "", ""
+		hdr.Format = tar.FormatPAX // keeps sub-second times, which the fingerprint covers
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		n, err := io.Copy(tw, src)
+		snap.Files++
+		snap.Bytes += n
+		return err
+	})
+	if err == nil {
+		err = tw.Close()
+	}
+	if err == nil {
+		err = gz.Close()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot workspace: %w", err)
+	}
+	if err := os.Rename(tmp, archive); err != nil {
+		return nil, fmt.Errorf("failed to snapshot workspace: %w", err)
+	}
+
+	snap.Fingerprint = hex.EncodeToString(hash.Sum(nil))
+	return snap, nil
+}
+
+// workspaceFingerprint returns the current fingerprint of workspace.
+func workspaceFingerprint(workspace string) (string, error) {
+	hash := sha256.New()
+	err := walkWorkspace(workspace, hash, func(string, string, fs.FileInfo, string) error { return nil })
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// walkWorkspace calls fn for every directory, regular file and symlink under
+// workspace in lexical order, and writes each to the fingerprint hash.
+func walkWorkspace(workspace string, hash io.Writer, fn func(rel, path string, info fs.FileInfo, link string) error) error {
+	return filepath.WalkDir(workspace, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == workspace {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel := filepath.ToSlash(strings.TrimPrefix(path, workspace+string(filepath.Separator)))
+
+		var link string
+		var mtime int64
+		switch {
+		case info.Mode().IsRegular():
+			mtime = info.ModTime().UnixNano()
+		case info.Mode()&fs.ModeSymlink != 0:
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		case !info.IsDir():
+			return nil
+		}
+
+		size := info.Size()
+		if info.IsDir() {
+			size = 0
+		}
+		fmt.Fprintf(hash, "%s\x00%s\x00%d\x00%d\x00%s\n", rel, info.Mode(), size, mtime, link)
+		return fn(rel, path, info, link)
+	})
+}
+
+// restore extracts the snapshot into workspace, which should be missing or
+// empty, with the files' original modes and modification times.
+func (s *workspaceSnapshot) restore(workspace string) error {
+	f, err := os.Open(s.Archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+
+	if err := os.MkdirAll(workspace, 0755); err != nil {
+		return err
+	}
+
+	type dirAttrs struct {
+		path  string
+		mode  fs.FileMode
+		mtime time.Time
+	}
+	var dirs []dirAttrs
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		rel := filepath.FromSlash(strings.TrimSuffix(hdr.Name, "/"))
+		if !filepath.IsLocal(rel) {
+			return fmt.Errorf("snapshot entry %q escapes the workspace", hdr.Name)
+		}
+		path := filepath.Join(workspace, rel)
+		mode := fs.FileMode(hdr.Mode).Perm()
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, mode|0700); err != nil {
+				return err
+			}
+			dirs = append(dirs, dirAttrs{path, mode, hdr.ModTime})
+		case tar.TypeReg:
+			out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(out, tr)
+			if closeErr := out.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+			if err := os.Chmod(path, mode); err != nil {
+				return err
+			}
+			if err := os.Chtimes(path, hdr.ModTime, hdr.ModTime); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.Symlink(hdr.Linkname, path); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Directory modes and times are applied last, since creating their
+	// entries changed them.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		os.Chmod(dirs[i].path, dirs[i].mode)
+		os.Chtimes(dirs[i].path, dirs[i].mtime, dirs[i].mtime)
+	}
+	return nil
+}
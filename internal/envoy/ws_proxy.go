@@ -58,6 +58,8 @@ func (s *Server) proxyWebSocket(w http.ResponseWriter, r *http.Request, targetAd
 	defer targetConn.Close()
 
 	log.Printf("proxy connected: client <-> %s", targetAddr)
+	terminalConnections.Inc()
+	defer terminalConnections.Dec()
 
 	ctx, cancel := context.WithCancel(r.Context())
 	defer cancel()
@@ -87,6 +89,7 @@ func (s *Server) proxyWebSocket(w http.ResponseWriter, r *http.Request, targetAd
 				errCh <- err
 				return
 			}
+			terminalBytes.WithLabelValues("client_to_sleeve").Add(float64(len(msg)))
 			if err := targetConn.WriteMessage(msgType, msg); err != nil {
 				errCh <- err
 				return
@@ -101,6 +104,7 @@ func (s *Server) proxyWebSocket(w http.ResponseWriter, r *http.Request, targetAd
 				errCh <- err
 				return
 			}
+			terminalBytes.WithLabelValues("sleeve_to_client").Add(float64(len(msg)))
 			if err := clientConn.WriteMessage(msgType, msg); err != nil {
 				errCh <- err
 				return
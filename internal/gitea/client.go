@@ -0,0 +1,216 @@
+// Package gitea is a minimal client for the self-hosted Gitea server that
+// gives workspaces a git remote. It covers the REST calls envoy needs and the
+// credentials git needs to clone from and push to the server.
+package gitea
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hotschmoe/protectorate/internal/config"
+)
+
+// ErrNotConfigured means GITEA_URL or the credentials are missing.
+var ErrNotConfigured = errors.New("gitea not configured: set GITEA_URL and GITEA_TOKEN or GITEA_USER/GITEA_PASSWORD")
+
+// listPageSize is the page size for paginated list calls.
+const listPageSize = 50
+
+// Client talks to the Gitea API as the configured user.
+type Client struct {
+	baseURL  string
+	user     string
+	password string
+	token    string
+	http     *http.Client
+}
+
+// Repo is the subset of a Gitea repository envoy uses. CloneURL is rewritten
+// to the configured server URL, since Gitea reports its own ROOT_URL, which
+// need not be reachable from envoy or sleeves.
+type Repo struct {
+	Name          string    `json:"name"`
+	FullName      string    `json:"full_name"`
+	Description   string    `json:"description"`
+	Private       bool      `json:"private"`
+	Empty         bool      `json:"empty"`
+	DefaultBranch string    `json:"default_branch"`
+	CloneURL      string    `json:"clone_url"`
+	HTMLURL       string    `json:"html_url"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// CreateRepoOptions describe a new repository.
+type CreateRepoOptions struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Private     bool   `json:"private"`
+}
+
+// APIError is a non-2xx response from Gitea.
+type APIError struct {
+	Status  int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("gitea returned %d: %s", e.Status, e.Message)
+}
+
+// IsConflict reports whether err is Gitea refusing to create something that
+// already exists.
+func IsConflict(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Status == http.StatusConflict
+}
+
+func NewClient(cfg config.GiteaConfig) *Client {
+	return &Client{
+		baseURL:  strings.TrimSuffix(cfg.URL, "/"),
+		user:     cfg.User,
+		password: cfg.Password,
+		token:    cfg.Token,
+		http:     &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Configured reports whether the client has a server and credentials.
+func (c *Client) Configured() bool {
+	return c.baseURL != "" && (c.token != "" || (c.user != "" && c.password != ""))
+}
+
+// Owns reports whether repoURL points at this Gitea server.
+func (c *Client) Owns(repoURL string) bool {
+	return c.baseURL != "" && strings.HasPrefix(repoURL, c.baseURL+"/")
+}
+
+// CurrentUser returns the login of the authenticated user.
+func (c *Client) CurrentUser() (string, error) {
+	var user struct {
+		Login string `json:"login"`
+	}
+	if err := c.do(http.MethodGet, "/api/v1/user", nil, &user); err != nil {
+		return "", err
+	}
+	return user.Login, nil
+}
+
+// ListRepos returns every repository the user can access.
+func (c *Client) ListRepos() ([]Repo, error) {
+	repos := []Repo{}
+	for page := 1; ; page++ {
+		var batch []Repo
+		path := fmt.Sprintf("/api/v1/user/repos?page=%d&limit=%d", page, listPageSize)
+		if err := c.do(http.MethodGet, path, nil, &batch); err != nil {
+			return nil, err
+		}
+		for i := range batch {
+			c.fixCloneURL(&batch[i])
+		}
+		repos = append(repos, batch...)
+		if len(batch) < listPageSize {
+			return repos, nil
+		}
+	}
+}
+
+// GetRepo returns owner/name.
+func (c *Client) GetRepo(owner, name string) (*Repo, error) {
+	var repo Repo
+	path := "/api/v1/repos/" + url.PathEscape(owner) + "/" + url.PathEscape(name)
+	if err := c.do(http.MethodGet, path, nil, &repo); err != nil {
+		return nil, err
+	}
+	c.fixCloneURL(&repo)
+	return &repo, nil
+}
+
+// CreateRepo creates an empty repository owned by the user.
+func (c *Client) CreateRepo(opts CreateRepoOptions) (*Repo, error) {
+	var repo Repo
+	if err := c.do(http.MethodPost, "/api/v1/user/repos", opts, &repo); err != nil {
+		return nil, err
+	}
+	c.fixCloneURL(&repo)
+	return &repo, nil
+}
+
+// GitEnv returns environment variables that make git send the credentials
+// to this server, and only to it. Passing them through the environment keeps
+// them out of the process list and out of the workspace's .git/config, which
+// agents can read.
+func (c *Client) GitEnv() []string {
+	return []string{
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http." + c.baseURL + "/.extraHeader",
+		"GIT_CONFIG_VALUE_0=Authorization: " + c.authorization(),
+		"GIT_TERMINAL_PROMPT=0",
+	}
+}
+
+func (c *Client) authorization() string {
+	if c.token != "" {
+		return "token " + c.token
+	}
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(c.user+":"+c.password))
+}
+
+func (c *Client) fixCloneURL(repo *Repo) {
+	repo.CloneURL = c.baseURL + "/" + repo.FullName + ".git"
+}
+
+// do sends body as JSON and decodes the response into out, if non-nil.
+func (c *Client) do(method, path string, body, out interface{}) error {
+	if !c.Configured() {
+		return ErrNotConfigured
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", c.authorization())
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("gitea request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var apiMsg struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(msg, &apiMsg) == nil && apiMsg.Message != "" {
+			msg = []byte(apiMsg.Message)
+		}
+		return &APIError{Status: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
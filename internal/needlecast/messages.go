@@ -0,0 +1,159 @@
+package needlecast
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hotschmoe/protectorate/internal/protocol"
+)
+
+// NeedlecastDir is the communication directory inside a workspace.
+const NeedlecastDir = ".needlecast"
+
+const (
+	inboxFile  = "inbox.md"
+	outboxFile = "outbox.md"
+)
+
+// ReadInbox returns messages addressed to the sleeve owning the workspace.
+func ReadInbox(workspacePath string) ([]protocol.Message, error) {
+	return readMessages(filepath.Join(workspacePath, NeedlecastDir, inboxFile))
+}
+
+// ReadOutbox returns messages the sleeve has written for envoy to route.
+func ReadOutbox(workspacePath string) ([]protocol.Message, error) {
+	return readMessages(filepath.Join(workspacePath, NeedlecastDir, outboxFile))
+}
+
+// WriteInbox appends a message to the workspace's inbox.
+func WriteInbox(workspacePath string, msg protocol.Message) error {
+	dir := filepath.Join(workspacePath, NeedlecastDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, inboxFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(formatMessage(msg))
+	return err
+}
+
+// ClearOutbox truncates the workspace's outbox after envoy has routed it.
+func ClearOutbox(workspacePath string) error {
+	path := filepath.Join(workspacePath, NeedlecastDir, outboxFile)
+	if err := os.Truncate(path, 0); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func readMessages(path string) ([]protocol.Message, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []protocol.Message{}, nil
+		}
+		return nil, err
+	}
+	return parseMessages(string(data)), nil
+}
+
+// parseMessages splits a needlecast file into messages. Each message is a
+// "---" delimited frontmatter block followed by markdown content that runs
+// until the next frontmatter block.
+func parseMessages(data string) []protocol.Message {
+	messages := []protocol.Message{}
+
+	var cur *protocol.Message
+	var content []string
+	inFrontmatter := false
+
+	flush := func() {
+		if cur != nil {
+			cur.Content = strings.TrimSpace(strings.Join(content, "\n"))
+			messages = append(messages, *cur)
+		}
+		cur = nil
+		content = nil
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if strings.TrimSpace(line) == "---" {
+			if inFrontmatter {
+				inFrontmatter = false
+				continue
+			}
+			flush()
+			cur = &protocol.Message{}
+			inFrontmatter = true
+			continue
+		}
+
+		if inFrontmatter {
+			key, value, ok := strings.Cut(line, ":")
+			if !ok {
+				continue
+			}
+			setField(cur, strings.TrimSpace(key), strings.TrimSpace(value))
+			continue
+		}
+
+		if cur != nil {
+			content = append(content, line)
+		}
+	}
+	flush()
+
+	return messages
+}
+
+func setField(msg *protocol.Message, key, value string) {
+	switch key {
+	case "id":
+		msg.ID = value
+	case "from":
+		msg.From = value
+	case "to":
+		msg.To = value
+	case "thread":
+		msg.Thread = value
+	case "type":
+		msg.Type = value
+	case "time":
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			msg.Timestamp = t
+		}
+	}
+}
+
+func formatMessage(msg protocol.Message) string {
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+
+	var b strings.Builder
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "id: %s\n", msg.ID)
+	fmt.Fprintf(&b, "from: %s\n", msg.From)
+	fmt.Fprintf(&b, "to: %s\n", msg.To)
+	if msg.Thread != "" {
+		fmt.Fprintf(&b, "thread: %s\n", msg.Thread)
+	}
+	fmt.Fprintf(&b, "type: %s\n", msg.Type)
+	fmt.Fprintf(&b, "time: %s\n", msg.Timestamp.UTC().Format(time.RFC3339))
+	b.WriteString("---\n")
+	b.WriteString(strings.TrimSpace(msg.Content))
+	b.WriteString("\n\n")
+	return b.String()
+}
@@ -7,16 +7,80 @@ type SleeveInfo struct {
 	Name        string    `json:"name"`
 	ContainerID string    `json:"container_id"`
 	Workspace   string    `json:"workspace"`
+	Profile     string    `json:"profile,omitempty"`
+	Template    string    `json:"template,omitempty"`
 	TTYDPort    int       `json:"ttyd_port"`
-	TTYDAddress string    `json:"ttyd_address"`
+	TTYDAddress string    `json:"ttyd_address"` // empty when the sleeve has no network
 	SpawnTime   time.Time `json:"spawn_time"`
 	Status      string    `json:"status"`
+
+	NetworkPolicy string   `json:"network_policy,omitempty"` // shared, isolated or none
+	Egress        []string `json:"egress,omitempty"`         // domains reachable through the egress proxy
+	EgressDeny    []string `json:"egress_deny,omitempty"`    // domains envoy's proxy refuses for this sleeve
+
+	Secrets []SecretRef `json:"secrets,omitempty"` // stored secrets delivered to the sleeve, never their values
+
+	Health              string    `json:"health,omitempty"` // healthy, unhealthy (empty until first probe)
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastProbe           time.Time `json:"last_probe,omitempty"`
+	LastProbeError      string    `json:"last_probe_error,omitempty"`
+
+	AgentStatus *AgentStatus `json:"agent_status,omitempty"`
+}
+
+// AgentStatus is the agent-reported state parsed from the workspace's .cstack/
+type AgentStatus struct {
+	State        string    `json:"state"` // idle, working, blocked, done
+	CurrentTask  string    `json:"current_task,omitempty"`
+	Progress     Progress  `json:"progress"`
+	PlanProgress *Progress `json:"plan_progress,omitempty"`
+	Blockers     []string  `json:"blockers"`
+	NextSteps    []string  `json:"next_steps,omitempty"`
+	LastActivity time.Time `json:"last_activity,omitempty"`
+	UpdatedAt    time.Time `json:"updated_at"`
 }
 
-// SpawnSleeveRequest is the request body for spawning a new sleeve
+// SpawnSleeveRequest is the request body for spawning a new sleeve.
+// Template fields apply first; any other field set here overrides them.
 type SpawnSleeveRequest struct {
-	Workspace string `json:"workspace"`
-	Name      string `json:"name,omitempty"`
+	Workspace string            `json:"workspace"`
+	Name      string            `json:"name,omitempty"`
+	Profile   string            `json:"profile,omitempty"` // AI CLI to run (SLEEVE_CLI), e.g. claude-code
+	Template  string            `json:"template,omitempty"`
+	Image     string            `json:"image,omitempty"`
+	Env       map[string]string `json:"env,omitempty"` // merged over the template's env
+	Resources *SleeveResources  `json:"resources,omitempty"`
+	Network   string            `json:"network,omitempty"` // extra network besides envoy's
+	Prompt    string            `json:"prompt,omitempty"`  // sent to the CLI once it has started
+
+	// NetworkPolicy is shared (envoy's network, the default), isolated (a
+	// network of its own) or none. Egress, if set, limits an isolated sleeve
+	// to these domains and their subdomains, through a proxy. EgressDeny
+	// adds domains envoy's proxy refuses for this sleeve.
+	NetworkPolicy string   `json:"network_policy,omitempty"`
+	Egress        []string `json:"egress,omitempty"`
+	EgressDeny    []string `json:"egress_deny,omitempty"`
+
+	// Secrets are added to the template's; one delivered to the same env
+	// var or file replaces the template's.
+	Secrets []SecretRef `json:"secrets,omitempty"`
+}
+
+// SecretRef delivers a stored secret into a sleeve as an env var, a file in
+// the sleeve's /run/secrets tmpfs, or both. With neither set it is a file
+// named after the secret.
+type SecretRef struct {
+	Name string `json:"name"`
+	Env  string `json:"env,omitempty"`
+	File string `json:"file,omitempty"` // file name under /run/secrets
+}
+
+// SleeveResources are container resource limits. Zero values leave the
+// template's (or no) limit in place
+type SleeveResources struct {
+	Memory    string  `json:"memory,omitempty"` // e.g. 512m, 4g
+	CPUs      float64 `json:"cpus,omitempty"`
+	PidsLimit int64   `json:"pids_limit,omitempty"`
 }
 
 // CloneWorkspaceRequest is the request body for cloning a git repo into a workspace
@@ -25,6 +89,14 @@ type CloneWorkspaceRequest struct {
 	Name    string `json:"name,omitempty"`
 }
 
+// PublishWorkspaceRequest is the request body for pushing a workspace to a
+// new Gitea repository named after it
+type PublishWorkspaceRequest struct {
+	Workspace   string `json:"workspace"`
+	Description string `json:"description,omitempty"`
+	Private     bool   `json:"private"`
+}
+
 // CloneJob represents an async clone operation
 type CloneJob struct {
 	ID        string    `json:"id"`
@@ -77,3 +149,276 @@ type FetchResult struct {
 	Success bool   `json:"success"`
 	Message string `json:"message,omitempty"`
 }
+
+// AuditEntry records a single mutating API operation
+type AuditEntry struct {
+	Time     time.Time         `json:"time"`
+	Actor    string            `json:"actor"`
+	SourceIP string            `json:"source_ip"`
+	Action   string            `json:"action"`
+	Target   string            `json:"target,omitempty"`
+	Details  map[string]string `json:"details,omitempty"`
+	Outcome  string            `json:"outcome"` // success, failure
+	Error    string            `json:"error,omitempty"`
+}
+
+// ComponentHealth is the result of checking a single dependency
+type ComponentHealth struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"` // ok, degraded, fail
+	Critical  bool   `json:"critical"`
+	Message   string `json:"message,omitempty"`
+	LatencyMS int64  `json:"latency_ms"`
+}
+
+// HealthReport aggregates component checks for liveness/readiness probes
+type HealthReport struct {
+	Status     string            `json:"status"` // ok, degraded, fail
+	Components []ComponentHealth `json:"components,omitempty"`
+	CheckedAt  time.Time         `json:"checked_at"`
+}
+
+// Message is a needlecast message exchanged between sleeves and envoy
+type Message struct {
+	ID        string    `json:"id"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Thread    string    `json:"thread,omitempty"`
+	Type      string    `json:"type"`
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Progress counts checklist items in a sleeve's current task
+type Progress struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+}
+
+// SidecarHealth is the response body for the sidecar's GET /health
+type SidecarHealth struct {
+	Status string `json:"status"`
+	Uptime int64  `json:"uptime"` // seconds
+	Error  string `json:"error,omitempty"`
+}
+
+// SidecarStatus is the response body for the sidecar's GET /status
+type SidecarStatus struct {
+	SleeveID     string    `json:"sleeve_id"`
+	Status       string    `json:"status"` // idle, working, blocked, done
+	CurrentTask  string    `json:"current_task,omitempty"`
+	Progress     Progress  `json:"progress"`
+	Blockers     []string  `json:"blockers"`
+	CLI          string    `json:"cli"`
+	CLIPid       int       `json:"cli_pid,omitempty"`
+	CLIRunning   bool      `json:"cli_running"`
+	LastActivity time.Time `json:"last_activity,omitempty"`
+}
+
+// OutboxResponse is the response body for the sidecar's GET /outbox
+type OutboxResponse struct {
+	Messages []Message `json:"messages"`
+}
+
+// ResleeveRequest is the request body for the sidecar's POST /resleeve
+type ResleeveRequest struct {
+	CLI string `json:"cli,omitempty"` // defaults to the current CLI
+}
+
+// ResleeveResponse is the response body for the sidecar's POST /resleeve
+type ResleeveResponse struct {
+	Status string `json:"status"`
+	CLI    string `json:"cli"`
+}
+
+// ClaimRequest is the request body for the sidecar's POST /claim, sent when
+// envoy hands a pooled sleeve to a workspace
+type ClaimRequest struct {
+	Name      string `json:"name"`
+	Workspace string `json:"workspace,omitempty"` // as seen by envoy
+}
+
+// PoolStatus reports the warm sleeve pool
+type PoolStatus struct {
+	Size  int            `json:"size"`
+	Ready map[string]int `json:"ready"` // profile -> warm sleeves
+}
+
+// ReconcileAction is one change needed to converge on the fleet file
+type ReconcileAction struct {
+	Op     string `json:"op"`     // clone, create, switch, spawn, start, respawn, kill
+	Target string `json:"target"` // workspace or sleeve name
+	Reason string `json:"reason"`
+	Error  string `json:"error,omitempty"` // set when applying the action failed
+}
+
+// ReconcilePlan lists the actions to converge on the fleet file, or the
+// actions taken when Applied is true
+type ReconcilePlan struct {
+	FleetFile string            `json:"fleet_file"`
+	Actions   []ReconcileAction `json:"actions"`
+	Applied   bool              `json:"applied"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// ConfigReload reports the settings a config reload changed. Settings in
+// RestartRequired keep their old values until envoy restarts.
+type ConfigReload struct {
+	ConfigFile      string    `json:"config_file,omitempty"`
+	Applied         []string  `json:"applied"`
+	RestartRequired []string  `json:"restart_required"`
+	ReloadedAt      time.Time `json:"reloaded_at"`
+}
+
+// Task is a unit of work dispatched to a sleeve
+type Task struct {
+	ID          string    `json:"id"`
+	Prompt      string    `json:"prompt"`
+	Workspace   string    `json:"workspace"`
+	Profile     string    `json:"profile,omitempty"`
+	Delivery    string    `json:"delivery"` // tmux, inbox
+	Status      string    `json:"status"`   // queued, assigned, running, done, failed
+	Sleeve      string    `json:"sleeve,omitempty"`
+	Result      string    `json:"result,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	AssignedAt  time.Time `json:"assigned_at,omitempty"`
+	StartedAt   time.Time `json:"started_at,omitempty"`
+	CompletedAt time.Time `json:"completed_at,omitempty"`
+}
+
+// CreateTaskRequest is the request body for queueing a task
+type CreateTaskRequest struct {
+	Prompt    string `json:"prompt"`
+	Workspace string `json:"workspace"`
+	Profile   string `json:"profile,omitempty"`
+	Delivery  string `json:"delivery,omitempty"` // tmux (default), inbox
+}
+
+// UpdateTaskRequest reports a task's outcome (done or failed)
+type UpdateTaskRequest struct {
+	Status string `json:"status"`
+	Result string `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// StartLoopRequest starts an agent loop ("ralphing") on a sleeve
+type StartLoopRequest struct {
+	PromptFile       string `json:"prompt_file"`                 // relative to the workspace
+	Command          string `json:"command,omitempty"`           // CLI invocation fed the prompt on stdin
+	MaxIterations    int    `json:"max_iterations,omitempty"`    // default 10
+	MaxDuration      string `json:"max_duration,omitempty"`      // wall-clock limit, default 1h
+	IterationTimeout string `json:"iteration_timeout,omitempty"` // per-iteration limit, default 30m
+	CheckpointEvery  int    `json:"checkpoint_every,omitempty"`  // pause for human review every N iterations, 0 = never
+}
+
+// LoopIteration records the outcome of a single loop iteration
+type LoopIteration struct {
+	N          int       `json:"n"`
+	StartedAt  time.Time `json:"started_at"`
+	EndedAt    time.Time `json:"ended_at"`
+	ExitCode   int       `json:"exit_code"`
+	Error      string    `json:"error,omitempty"`
+	HeadBefore string    `json:"head_before,omitempty"`
+	HeadAfter  string    `json:"head_after,omitempty"`
+	Commits    []string  `json:"commits"`
+	DiffStat   string    `json:"diff_stat,omitempty"`
+	Dirty      int       `json:"dirty"` // uncommitted files after the iteration
+	Output     string    `json:"output,omitempty"`
+}
+
+// LoopStatus is the state of an agent loop
+type LoopStatus struct {
+	Sleeve          string          `json:"sleeve"`
+	PromptFile      string          `json:"prompt_file"`
+	Command         string          `json:"command"`
+	State           string          `json:"state"` // running, paused, checkpoint, completed, killed, failed
+	Reason          string          `json:"reason,omitempty"`
+	Iteration       int             `json:"iteration"`
+	MaxIterations   int             `json:"max_iterations"`
+	CheckpointEvery int             `json:"checkpoint_every,omitempty"`
+	StartedAt       time.Time       `json:"started_at"`
+	Deadline        time.Time       `json:"deadline"`
+	EndedAt         time.Time       `json:"ended_at,omitempty"`
+	Iterations      []LoopIteration `json:"iterations"`
+}
+
+// SleeveInputRequest is the request body for sending input to a sleeve's tmux session
+type SleeveInputRequest struct {
+	Text  string   `json:"text,omitempty"`  // typed literally
+	Keys  []string `json:"keys,omitempty"`  // tmux key names sent after text, e.g. "C-c", "Escape", "Up"
+	Enter bool     `json:"enter,omitempty"` // press Enter after text and keys
+}
+
+// SleeveScreen is the captured contents of a sleeve's tmux pane
+type SleeveScreen struct {
+	Sleeve     string    `json:"sleeve"`
+	Content    string    `json:"content"`
+	CapturedAt time.Time `json:"captured_at"`
+}
+
+// ExecRequest is the request body for running a one-off command in a sleeve
+type ExecRequest struct {
+	Cmd     []string `json:"cmd"`
+	Timeout string   `json:"timeout,omitempty"` // default 30s, from 1s to 10m
+	Env     []string `json:"env,omitempty"`     // KEY=value
+}
+
+// ExecResponse is the captured result of a one-off command
+type ExecResponse struct {
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	ExitCode   int    `json:"exit_code"`
+	TimedOut   bool   `json:"timed_out"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// MirrorStatus is the mirror state of one repository
+type MirrorStatus struct {
+	Repo                string    `json:"repo"`   // workspace name or Gitea owner/name
+	Source              string    `json:"source"` // workspace or gitea
+	Target              string    `json:"target"` // URL pushed to
+	LastAttempt         time.Time `json:"last_attempt"`
+	LastSuccess         time.Time `json:"last_success,omitempty"`
+	LastFailure         time.Time `json:"last_failure,omitempty"`
+	LastError           string    `json:"last_error,omitempty"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+}
+
+// MirrorReport is the GitHub mirror schedule and the state of each repository
+type MirrorReport struct {
+	Enabled   bool           `json:"enabled"`
+	Target    string         `json:"target,omitempty"` // org URL, e.g. https://github.com/acme
+	Frequency string         `json:"frequency"`
+	Running   bool           `json:"running"`
+	LastRun   time.Time      `json:"last_run,omitempty"`
+	NextRun   time.Time      `json:"next_run,omitempty"`
+	Repos     []MirrorStatus `json:"repos"`
+}
+
+// SecretInfo describes a stored secret. Its value is never returned.
+type SecretInfo struct {
+	Name      string    `json:"name"`
+	Scope     []string  `json:"scope,omitempty"` // sleeve name patterns allowed to use it; empty = all
+	Version   int       `json:"version"`         // incremented on every rotation
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Sleeves   []string  `json:"sleeves,omitempty"` // sleeves it is delivered to
+}
+
+// PutSecretRequest creates or rotates a secret. A nil Scope keeps the
+// current scope; an empty one opens the secret to every sleeve.
+type PutSecretRequest struct {
+	Value string    `json:"value"`
+	Scope *[]string `json:"scope,omitempty"`
+}
+
+// SecretRotation is the result of storing a secret: the running sleeves it
+// was rewritten in, and those holding it in env or paused, which keep the
+// old value until resleeved or unpaused.
+type SecretRotation struct {
+	Secret  SecretInfo        `json:"secret"`
+	Updated []string          `json:"updated,omitempty"`
+	Stale   []string          `json:"stale,omitempty"`
+	Errors  map[string]string `json:"errors,omitempty"` // sleeve -> error
+}
@@ -0,0 +1,9 @@
+// Package shell holds helpers for building commands run through a shell.
+package shell
+
+import "strings"
+
+// Quote wraps s in single quotes so a POSIX shell reads it as one literal word.
+func Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,142 @@
+package sidecar
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/hotschmoe/protectorate/internal/cstack"
+	"github.com/hotschmoe/protectorate/internal/needlecast"
+	"github.com/hotschmoe/protectorate/internal/protocol"
+)
+
+// handleHealth reports healthy only while the tmux session exists and ttyd
+// is listening, since without either the sleeve cannot be used.
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	health := protocol.SidecarHealth{
+		Status: "healthy",
+		Uptime: int64(time.Since(s.started).Seconds()),
+	}
+	code := http.StatusOK
+	if err := s.supervisor.Healthy(); err != nil {
+		health.Status = "unhealthy"
+		health.Error = err.Error()
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(health)
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	pid := s.supervisor.CLIPid()
+	status := protocol.SidecarStatus{
+		SleeveID:   s.supervisor.SleeveName(),
+		Status:     string(cstack.StatusIdle),
+		Blockers:   []string{},
+		CLI:        s.supervisor.CLI(),
+		CLIPid:     pid,
+		CLIRunning: pid != 0,
+	}
+
+	state, err := cstack.ParseCurrent(s.cfg.WorkspacePath)
+	if err != nil && !os.IsNotExist(err) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if state != nil {
+		status.Status = string(state.Status)
+		status.CurrentTask = state.Task
+		status.Progress = protocol.Progress{
+			Total:     state.Progress.Total,
+			Completed: state.Progress.Completed,
+		}
+		status.Blockers = state.Blockers
+		status.LastActivity = state.LastModified
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+func (s *Server) handleOutbox(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		messages, err := needlecast.ReadOutbox(s.cfg.WorkspacePath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(protocol.OutboxResponse{Messages: messages})
+
+	case http.MethodDelete:
+		if err := needlecast.ClearOutbox(s.cfg.WorkspacePath); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleResleeve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req protocol.ResleeveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	cli, err := s.supervisor.Resleeve(req.CLI)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(protocol.ResleeveResponse{
+		Status: "resleeving",
+		CLI:    cli,
+	})
+}
+
+// handleClaim is called by envoy when it hands a pooled sleeve to a workspace.
+func (s *Server) handleClaim(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req protocol.ClaimRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" {
+		http.Error(w, "name required", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.supervisor.Claim(req.Name, req.Workspace); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
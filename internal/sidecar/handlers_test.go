@@ -0,0 +1,81 @@
+package sidecar
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hotschmoe/protectorate/internal/config"
+	"github.com/hotschmoe/protectorate/internal/protocol"
+)
+
+// newTestServer returns a server whose tmux reports the session as present
+// or not, and a listener standing in for ttyd.
+func newTestServer(t *testing.T, session bool) (*Server, net.Listener) {
+	ttyd, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ttyd.Close() })
+
+	cfg := &config.SidecarConfig{
+		CLI:         "claude-code",
+		TmuxSession: "main",
+		TTYDPort:    ttyd.Addr().(*net.TCPAddr).Port,
+	}
+	supervisor, err := NewSupervisor(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	supervisor.runTmux = func(args ...string) error {
+		if args[0] == "has-session" && !session {
+			return errors.New("can't find session: main")
+		}
+		return nil
+	}
+
+	return &Server{cfg: cfg, supervisor: supervisor, started: time.Now()}, ttyd
+}
+
+func getHealth(t *testing.T, s *Server) (int, protocol.SidecarHealth) {
+	rec := httptest.NewRecorder()
+	s.handleHealth(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	var health protocol.SidecarHealth
+	if err := json.NewDecoder(rec.Body).Decode(&health); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, health
+}
+
+func TestHealthHealthy(t *testing.T) {
+	s, _ := newTestServer(t, true)
+
+	code, health := getHealth(t, s)
+	if code != http.StatusOK || health.Status != "healthy" {
+		t.Errorf("health = %d %+v, want 200 healthy", code, health)
+	}
+}
+
+func TestHealthWithoutTmuxSession(t *testing.T) {
+	s, _ := newTestServer(t, false)
+
+	code, health := getHealth(t, s)
+	if code != http.StatusServiceUnavailable || health.Status != "unhealthy" {
+		t.Errorf("health = %d %+v, want 503 unhealthy", code, health)
+	}
+}
+
+func TestHealthWithoutTTYD(t *testing.T) {
+	s, ttyd := newTestServer(t, true)
+	ttyd.Close()
+
+	code, health := getHealth(t, s)
+	if code != http.StatusServiceUnavailable || health.Status != "unhealthy" {
+		t.Errorf("health = %d %+v, want 503 unhealthy", code, health)
+	}
+}
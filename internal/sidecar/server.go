@@ -0,0 +1,65 @@
+package sidecar
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hotschmoe/protectorate/internal/config"
+)
+
+type Server struct {
+	cfg        *config.SidecarConfig
+	http       *http.Server
+	supervisor *Supervisor
+	started    time.Time
+}
+
+func NewServer(cfg *config.SidecarConfig) (*Server, error) {
+	supervisor, err := NewSupervisor(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create supervisor: %w", err)
+	}
+
+	s := &Server{
+		cfg:        cfg,
+		supervisor: supervisor,
+		started:    time.Now(),
+	}
+
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+
+	s.http = &http.Server{
+		Addr:         fmt.Sprintf(":%d", cfg.Port),
+		Handler:      mux,
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+
+	return s, nil
+}
+
+func (s *Server) registerRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/outbox", s.handleOutbox)
+	mux.HandleFunc("/resleeve", s.handleResleeve)
+	mux.HandleFunc("/claim", s.handleClaim)
+}
+
+// Start launches the supervised processes and then serves the API.
+func (s *Server) Start() error {
+	if err := s.supervisor.Start(); err != nil {
+		return fmt.Errorf("failed to start supervisor: %w", err)
+	}
+	return s.http.ListenAndServe()
+}
+
+func (s *Server) Shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	s.supervisor.Stop()
+	return s.http.Shutdown(ctx)
+}
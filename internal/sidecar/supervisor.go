@@ -0,0 +1,293 @@
+package sidecar
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hotschmoe/protectorate/internal/config"
+	"github.com/hotschmoe/protectorate/internal/shell"
+)
+
+// cliCommands maps SLEEVE_CLI values to the command started in tmux and the
+// process name used to detect whether it is running.
+var cliCommands = map[string]struct {
+	command string
+	process string
+}{
+	"claude-code": {command: "claude --dangerously-skip-permissions", process: "claude"},
+	"gemini-cli":  {command: "gemini", process: "gemini"},
+	"opencode":    {command: "opencode", process: "opencode"},
+}
+
+const (
+	sessionCheckInterval = 2 * time.Second
+	ttydRestartDelay     = 1 * time.Second
+	ttydDialTimeout      = 2 * time.Second
+
+	// claimFile records the name a pooled sleeve was claimed as, and on a
+	// second line its workspace. It lives in the container filesystem so a
+	// restarted sleeve stays claimed, and envoy reads it to recover the
+	// claim, since container labels cannot change after creation.
+	claimFile = "/var/lib/sidecar/claim"
+)
+
+// Supervisor keeps the tmux session, the AI CLI inside it, and ttyd running.
+// It replaces the respawn loop that used to live in the sleeve entrypoint.
+type Supervisor struct {
+	cfg *config.SidecarConfig
+
+	mu      sync.Mutex
+	cli     string
+	name    string
+	claimed bool
+	ttyd    *exec.Cmd
+	stop    chan struct{}
+
+	// runTmux runs a tmux command; replaced in tests.
+	runTmux func(args ...string) error
+}
+
+func NewSupervisor(cfg *config.SidecarConfig) (*Supervisor, error) {
+	if _, ok := cliCommands[cfg.CLI]; !ok {
+		return nil, fmt.Errorf("unsupported CLI %q", cfg.CLI)
+	}
+
+	s := &Supervisor{
+		cfg:     cfg,
+		cli:     cfg.CLI,
+		name:    cfg.SleeveName,
+		claimed: !cfg.Pooled,
+		stop:    make(chan struct{}),
+	}
+	s.runTmux = s.execTmux
+
+	if cfg.Pooled {
+		if data, err := os.ReadFile(claimFile); err == nil {
+			s.claimed = true
+			s.name, _, _ = strings.Cut(strings.TrimSpace(string(data)), "\n")
+		}
+	}
+
+	return s, nil
+}
+
+// Start creates the tmux session, launches the CLI and starts ttyd. A pooled
+// sleeve gets its session and ttyd but no CLI until it is claimed.
+func (s *Supervisor) Start() error {
+	if err := s.ensureSession(); err != nil {
+		return err
+	}
+
+	go s.runTTYD()
+	go s.watchSession()
+	return nil
+}
+
+func (s *Supervisor) Stop() {
+	close(s.stop)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ttyd != nil && s.ttyd.Process != nil {
+		s.ttyd.Process.Signal(os.Interrupt)
+	}
+}
+
+// CLI returns the name of the CLI currently running in the session.
+func (s *Supervisor) CLI() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cli
+}
+
+// SleeveName returns the sleeve's current name, which changes when a pooled
+// sleeve is claimed.
+func (s *Supervisor) SleeveName() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.name
+}
+
+// Claimed reports whether the CLI should be running.
+func (s *Supervisor) Claimed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.claimed
+}
+
+// Claim turns a pooled sleeve into a named one working on workspace. Envoy
+// has already pointed the workspace mount at the real workspace; start the
+// CLI, then fix the workspace's ownership. Only the top level is fixed before
+// the CLI starts: a recursive chown takes as long as the workspace is large,
+// and would hold up the claim.
+func (s *Supervisor) Claim(name, workspace string) error {
+	s.mu.Lock()
+	if s.claimed {
+		s.mu.Unlock()
+		return fmt.Errorf("sleeve already claimed as %q", s.name)
+	}
+	s.claimed = true
+	s.name = name
+	s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(claimFile), 0755); err == nil {
+		os.WriteFile(claimFile, []byte(name+"\n"+workspace+"\n"), 0644)
+	}
+
+	owner := s.cfg.User + ":" + s.cfg.User
+	if out, err := exec.Command("chown", owner, s.cfg.WorkspacePath).CombinedOutput(); err != nil {
+		log.Printf("chown workspace: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	go func() {
+		if out, err := exec.Command("chown", "-R", owner, s.cfg.WorkspacePath).CombinedOutput(); err != nil {
+			log.Printf("chown workspace: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+	}()
+
+	return s.startCLI()
+}
+
+// CLIPid returns the pid of the running CLI, or 0 if it is not running.
+func (s *Supervisor) CLIPid() int {
+	process := cliCommands[s.CLI()].process
+
+	out, err := exec.Command("pgrep", "-n", "-u", s.cfg.User, "-x", process).Output()
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(out)))
+	return pid
+}
+
+// Resleeve performs a soft resleeve: interrupt the current CLI in tmux and
+// start cli (or the current CLI if empty) in its place. The workspace and
+// .cstack/ are untouched.
+func (s *Supervisor) Resleeve(cli string) (string, error) {
+	if cli == "" {
+		cli = s.CLI()
+	}
+	if _, ok := cliCommands[cli]; !ok {
+		return "", fmt.Errorf("unsupported CLI %q", cli)
+	}
+
+	session := s.cfg.TmuxSession
+	s.tmux("send-keys", "-t", session, "C-c")
+	time.Sleep(1 * time.Second)
+	s.tmux("send-keys", "-t", session, "C-c")
+	time.Sleep(1 * time.Second)
+
+	s.mu.Lock()
+	s.cli = cli
+	s.mu.Unlock()
+
+	if err := s.startCLI(); err != nil {
+		return "", err
+	}
+	return cli, nil
+}
+
+func (s *Supervisor) ensureSession() error {
+	if s.tmux("has-session", "-t", s.cfg.TmuxSession) == nil {
+		return nil
+	}
+
+	if err := s.tmux("new-session", "-d", "-s", s.cfg.TmuxSession); err != nil {
+		return fmt.Errorf("failed to create tmux session: %w", err)
+	}
+	if !s.Claimed() {
+		return nil
+	}
+	return s.startCLI()
+}
+
+func (s *Supervisor) startCLI() error {
+	command := fmt.Sprintf("cd %s && %s", shell.Quote(s.cfg.WorkspacePath), cliCommands[s.CLI()].command)
+	if err := s.tmux("send-keys", "-t", s.cfg.TmuxSession, command, "Enter"); err != nil {
+		return fmt.Errorf("failed to start CLI: %w", err)
+	}
+	return nil
+}
+
+// watchSession recreates the tmux session (and relaunches the CLI) if it dies.
+func (s *Supervisor) watchSession() {
+	ticker := time.NewTicker(sessionCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.ensureSession(); err != nil {
+				log.Printf("session check: %v", err)
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// runTTYD runs ttyd attached to the tmux session, restarting it if it exits.
+func (s *Supervisor) runTTYD() {
+	attach := fmt.Sprintf("tmux new-session -A -s %s", shell.Quote(s.cfg.TmuxSession))
+
+	for {
+		cmd := exec.Command("ttyd",
+			"--port", strconv.Itoa(s.cfg.TTYDPort),
+			"--writable",
+			"su", "-", s.cfg.User, "-c", attach,
+		)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+
+		s.mu.Lock()
+		s.ttyd = cmd
+		s.mu.Unlock()
+
+		err := cmd.Run()
+
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+
+		log.Printf("ttyd exited (%v), restarting", err)
+		time.Sleep(ttydRestartDelay)
+	}
+}
+
+// Healthy returns nil if the tmux session exists and ttyd is accepting
+// connections, otherwise what is wrong.
+func (s *Supervisor) Healthy() error {
+	if err := s.tmux("has-session", "-t", s.cfg.TmuxSession); err != nil {
+		return fmt.Errorf("tmux session %q not found", s.cfg.TmuxSession)
+	}
+
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(s.cfg.TTYDPort))
+	conn, err := net.DialTimeout("tcp", addr, ttydDialTimeout)
+	if err != nil {
+		return fmt.Errorf("ttyd not listening on port %d", s.cfg.TTYDPort)
+	}
+	conn.Close()
+	return nil
+}
+
+func (s *Supervisor) tmux(args ...string) error {
+	return s.runTmux(args...)
+}
+
+// execTmux runs a tmux command as the sleeve user.
+func (s *Supervisor) execTmux(args ...string) error {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = shell.Quote(a)
+	}
+	return exec.Command("su", "-", s.cfg.User, "-c", "tmux "+strings.Join(quoted, " ")).Run()
+}